@@ -53,6 +53,7 @@ func (b *Buffer) SetModified(txNum int64, lsn int64) {
 
 // assignToBlock Reads the contents of the specified file block into the contents of the buffer.
 // If the buffer was dirty(modified in-memory), then its previous contents are first flushed to disk.
+// If the block cannot be read, the buffer is left unassigned.
 func (b *Buffer) assignToBlock(block file.Block) error {
 	err := b.flush()
 	if err != nil {
@@ -61,6 +62,7 @@ func (b *Buffer) assignToBlock(block file.Block) error {
 
 	err = b.fileMgr.Read(block, b.Contents)
 	if err != nil {
+		b.Block = file.Block{}
 		return err
 	}
 
@@ -70,10 +72,18 @@ func (b *Buffer) assignToBlock(block file.Block) error {
 }
 
 // Write the buffer to its disk block if it is dirty.
+// The log records up to the buffer's logSeqNum are flushed first, and the block is synced after it is written.
 func (b *Buffer) flush() error {
 	if b.TxNum >= 0 {
-		b.log.Flush(b.logSeqNum)
-		err := b.fileMgr.Write(b.Block, b.Contents)
+		err := b.log.Flush(b.logSeqNum)
+		if err != nil {
+			return err
+		}
+		err = b.fileMgr.Write(b.Block, b.Contents)
+		if err != nil {
+			return err
+		}
+		err = b.fileMgr.Sync(b.Block.Filename)
 		if err != nil {
 			return err
 		}
@@ -1,13 +1,14 @@
 package buffer
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/naveen246/kite-db/file"
 	"github.com/naveen246/kite-db/wal"
 	"github.com/sasha-s/go-deadlock"
-	"log"
-	"slices"
+	"sync"
 	"time"
 )
 
@@ -28,51 +29,133 @@ When a client requests a buffer manager for accessing a disk-block
 	We use a map "allocatedBuffers" that maps a block to a buffer-page
 	The buffer manager checks the map and returns the page if a corresponding buffer-page is present.
 - If a buffer-page holding the contents of the disk-block is not present in Bufferpool and at least one unpinned buffer-page is present:
-	We have to pick a buffer-page from the list of unpinned buffer-pages. This can be done using LRU, LFU and other strategies
-	LRU is implemented using a slice "unpinnedBuffers".
-	When a buffer's pin count becomes 0(no longer used by any client), we add the buffer-page to the tail-end of the slice.
-	Whenever a buffer is needed, the Least Recently Used buffer-page is present at the head of the list so remove the buffer-page at the head of the list and use it.
+	We have to pick a buffer-page from the unpinned buffer-pages. This can be done using LRU, LFU and other strategies,
+	the ReplacementPolicy of the BufferPool picks it (see replacement.go), the default is LRU.
+	When a buffer's pin count becomes 0(no longer used by any client), the buffer-page is given to the ReplacementPolicy.
+	Whenever a buffer is needed, the ReplacementPolicy chooses one of the unpinned buffer-pages.
+- If all the buffer-pages are pinned:
+	The client waits on the condition variable "bufferFreed" until a buffer-page is unpinned, then tries again.
+	PinBufferContext gives up with ErrBufferAbort when its context is done, PinBuffer after MaxPinWait.
 */
 
+var (
+	ErrBufferPinned = errors.New("buffer is pinned")
+	ErrBufferAbort  = errors.New("could not get a buffer to pin the block")
+)
+
+// MaxPinWait is how long PinBuffer waits for a buffer to be unpinned when all the buffers are pinned
+const MaxPinWait = 9 * time.Second
+
 // BufferPool Manages the pinning and unpinning of buffers to blocks.
 type BufferPool struct {
 	deadlock.Mutex
-	UnpinnedBuffers []*Buffer
+	fileMgr *file.FileMgr
+	log     *wal.Log
+
+	// Policy chooses the unpinned buffer to replace, see WithReplacementPolicy
+	Policy ReplacementPolicy
 
 	// AllocatedBuffers maps Block to Buffer
 	AllocatedBuffers map[string]*Buffer
+
+	// bufferFreed is signalled when a buffer is unpinned, it uses the lock of the BufferPool
+	bufferFreed *sync.Cond
 }
 
-func NewBufferPool(fileMgr *file.FileMgr, log *wal.Log, bufCount int) *BufferPool {
-	buffers := make([]*Buffer, bufCount)
-	for i := 0; i < bufCount; i++ {
-		buffers[i] = NewBuffer(uuid.NewString(), fileMgr, log)
+// Option configures a BufferPool created by NewBufferPool
+type Option func(bm *BufferPool)
+
+// WithReplacementPolicy sets the policy that chooses the unpinned buffer to replace, the default is NewLRUPolicy().
+// A policy must not be shared by several BufferPools.
+func WithReplacementPolicy(policy ReplacementPolicy) Option {
+	return func(bm *BufferPool) {
+		bm.Policy = policy
 	}
-	return &BufferPool{
-		UnpinnedBuffers:  buffers,
+}
+
+func NewBufferPool(fileMgr *file.FileMgr, log *wal.Log, bufCount int, opts ...Option) *BufferPool {
+	bm := &BufferPool{
+		fileMgr:          fileMgr,
+		log:              log,
+		Policy:           NewLRUPolicy(),
 		AllocatedBuffers: make(map[string]*Buffer),
 	}
+	bm.bufferFreed = sync.NewCond(&bm.Mutex)
+	for _, opt := range opts {
+		opt(bm)
+	}
+	for i := 0; i < bufCount; i++ {
+		bm.Policy.Unpinned(NewBuffer(uuid.NewString(), fileMgr, log))
+	}
+	return bm
 }
 
 // Available Returns the number of available (i.e. unpinned) buffers.
 func (bm *BufferPool) Available() int {
 	bm.Lock()
 	defer bm.Unlock()
-	return len(bm.UnpinnedBuffers)
+	return bm.Policy.Available()
 }
 
 // FlushAll Flushes the dirty buffers modified by the specified transaction.
-func (bm *BufferPool) FlushAll(txNum int64) {
+// The log records of all the buffers are flushed first,
+// then the buffers are written together with FileMgr.WriteBatch, so the blocks are written in order
+// and each file is synced once. If the batch fails, the buffers remain dirty.
+func (bm *BufferPool) FlushAll(txNum int64) error {
 	bm.Lock()
 	defer bm.Unlock()
+
+	var dirty []*Buffer
+	var writes []file.BlockWrite
+	var logSeqNum int64 = -1
 	for _, buf := range bm.AllocatedBuffers {
 		if buf.TxNum == txNum {
-			err := buf.flush()
-			if err != nil {
-				log.Printf("Error flushing buffer %v: %v", buf, err)
+			dirty = append(dirty, buf)
+			writes = append(writes, file.BlockWrite{Block: buf.Block, Page: buf.Contents})
+			logSeqNum = max(logSeqNum, buf.logSeqNum)
+		}
+	}
+	if len(dirty) == 0 {
+		return nil
+	}
+
+	err := bm.log.Flush(logSeqNum)
+	if err != nil {
+		return err
+	}
+	err = bm.fileMgr.WriteBatch(writes)
+	if err != nil {
+		return fmt.Errorf("could not flush buffers of transaction %v: %w", txNum, err)
+	}
+	for _, buf := range dirty {
+		buf.TxNum = -1
+	}
+	return nil
+}
+
+// DiscardBlocks Unassigns the buffers allocated to blocks of the file numbered fromBlockNum and above,
+// without writing their contents to disk. It is used when the end of a file is truncated.
+// Returns ErrBufferPinned if any of those buffers is pinned, in which case no buffer is discarded.
+func (bm *BufferPool) DiscardBlocks(filename string, fromBlockNum int64) error {
+	bm.Lock()
+	defer bm.Unlock()
+
+	var discarded []*Buffer
+	for _, buf := range bm.AllocatedBuffers {
+		if buf.Block.Filename == filename && buf.Block.Number >= fromBlockNum {
+			if buf.IsPinned() {
+				return fmt.Errorf("%w: %v", ErrBufferPinned, buf.Block)
 			}
+			discarded = append(discarded, buf)
 		}
 	}
+
+	for _, buf := range discarded {
+		delete(bm.AllocatedBuffers, buf.Block.String())
+		buf.Block = file.Block{}
+		buf.TxNum = -1
+	}
+	return nil
 }
 
 // UnpinBuffer Unpins the specified data buffer.
@@ -83,65 +166,81 @@ func (bm *BufferPool) UnpinBuffer(buffer *Buffer) {
 	defer bm.Unlock()
 	buffer.unpin()
 	if !buffer.IsPinned() {
-		bm.UnpinnedBuffers = append(bm.UnpinnedBuffers, buffer)
+		bm.Policy.Unpinned(buffer)
+		bm.bufferFreed.Broadcast()
 	}
 }
 
 // PinBuffer Pins a buffer to the specified block, potentially waiting until a buffer becomes available.
-// If no buffer becomes available within a fixed time period, then exit with an error
-// Caller has an option to skip waiting and return immediately with nil if buffer is not available
-func (bm *BufferPool) PinBuffer(block file.Block, skipWait ...bool) *Buffer {
-	bm.Lock()
-	buf := bm.tryToPin(block)
-	bm.Unlock()
-	if buf != nil {
-		return buf
-	}
+// Returns ErrBufferAbort if no buffer becomes available within MaxPinWait.
+// Caller has an option to skip waiting and return ErrBufferAbort immediately if buffer is not available
+// If the block could not be read (for example file.ErrCorruptBlock), the error is returned without waiting.
+func (bm *BufferPool) PinBuffer(block file.Block, skipWait ...bool) (*Buffer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), MaxPinWait)
+	defer cancel()
 	if len(skipWait) > 0 && skipWait[0] {
-		return nil
+		cancel()
 	}
+	return bm.PinBufferContext(ctx, block)
+}
+
+// PinBufferContext Pins a buffer to the specified block. If all the buffers are pinned,
+// it waits until one of them is unpinned, and returns ErrBufferAbort if ctx is done before.
+// If the block could not be read (for example file.ErrCorruptBlock), the error is returned without waiting.
+func (bm *BufferPool) PinBufferContext(ctx context.Context, block file.Block) (*Buffer, error) {
+	bm.Lock()
+	defer bm.Unlock()
 
-	retries := 2
-	wait := time.Second * 3
-	for i := 0; i < retries; i++ {
-		time.Sleep(wait)
-		wait *= 2
+	// wake up the waiting loop below when ctx is done
+	stop := context.AfterFunc(ctx, func() {
 		bm.Lock()
-		buf := bm.tryToPin(block)
-		bm.Unlock()
-		if buf != nil {
-			return buf
+		defer bm.Unlock()
+		bm.bufferFreed.Broadcast()
+	})
+	defer stop()
+
+	for {
+		buf, err := bm.tryToPin(block)
+		if buf != nil || err != nil {
+			return buf, err
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w %v: %w", ErrBufferAbort, block, context.Cause(ctx))
 		}
+		bm.bufferFreed.Wait()
 	}
-	return nil
 }
 
 // tryToPin Tries to pin a buffer to the specified block.
 // If there is already a buffer allocated to that block then that buffer is used;
-// otherwise, an unpinned buffer from the pool is chosen.
-// Returns nil if there are no available buffers or if assignToBlock failed.
-func (bm *BufferPool) tryToPin(block file.Block) *Buffer {
+// otherwise, an unpinned buffer from the pool is chosen by the ReplacementPolicy.
+// Returns nil if there are no available buffers,
+// returns nil and the error if assignToBlock failed, in which case the chosen buffer is returned to the pool unassigned.
+func (bm *BufferPool) tryToPin(block file.Block) (*Buffer, error) {
 	buf := bm.prevAllocatedBuffer(block)
 	if buf == nil {
-		buf = bm.chooseUnpinnedBuffer()
+		buf = bm.Policy.Victim()
 		if buf == nil {
-			return nil
+			return nil, nil
 		}
 		delete(bm.AllocatedBuffers, buf.Block.String())
 
 		err := buf.assignToBlock(block)
 		if err != nil {
-			return nil
+			if buf.TxNum >= 0 {
+				// flush failed, the buffer still holds the modified contents of its previous block
+				bm.AllocatedBuffers[buf.Block.String()] = buf
+			}
+			bm.Policy.Unpinned(buf)
+			bm.bufferFreed.Broadcast()
+			return nil, err
 		}
 
 		bm.AllocatedBuffers[block.String()] = buf
-	} else {
-		if !buf.IsPinned() {
-			bm.removeBufferFromUnpinned(buf)
-		}
 	}
 	buf.pin()
-	return buf
+	bm.Policy.Pinned(buf)
+	return buf, nil
 }
 
 func (bm *BufferPool) prevAllocatedBuffer(block file.Block) *Buffer {
@@ -152,37 +251,12 @@ func (bm *BufferPool) prevAllocatedBuffer(block file.Block) *Buffer {
 	return nil
 }
 
-func (bm *BufferPool) removeBufferFromUnpinned(buf *Buffer) {
-	index := -1
-	for i := 0; i < len(bm.UnpinnedBuffers); i++ {
-		if bm.UnpinnedBuffers[i].ID == buf.ID {
-			index = i
-			break
-		}
-	}
-	if index != -1 {
-		bm.UnpinnedBuffers = append(bm.UnpinnedBuffers[:index], bm.UnpinnedBuffers[index+1:]...)
-	}
-}
-
-func (bm *BufferPool) chooseUnpinnedBuffer() *Buffer {
-	if len(bm.UnpinnedBuffers) > 0 {
-		buf := bm.UnpinnedBuffers[0]
-		bm.UnpinnedBuffers = slices.Delete(bm.UnpinnedBuffers, 0, 1)
-		return buf
-	}
-	return nil
-}
-
 // for debugging
 func (bm *BufferPool) PrintStatus() {
 	fmt.Println("Allocated buffers")
 	for _, buf := range bm.AllocatedBuffers {
 		fmt.Println(buf.String())
 	}
-	fmt.Println("Unpinned buffers")
-	for _, buf := range bm.UnpinnedBuffers {
-		fmt.Println(buf.String())
-	}
+	fmt.Println("Unpinned buffers:", bm.Policy.Available())
 	fmt.Println()
 }
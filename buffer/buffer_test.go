@@ -1,12 +1,15 @@
 package buffer_test
 
 import (
+	"context"
 	"github.com/naveen246/kite-db/buffer"
 	"github.com/naveen246/kite-db/file"
 	"github.com/naveen246/kite-db/server"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 const (
@@ -21,17 +24,32 @@ func createFile(fileMgr *file.FileMgr, filename string) {
 	f.Truncate(1e5)
 }
 
+// removeFile removes filename, the segment files of the log filename and dbDir
 func removeFile(filename string, dbDir string) {
 	os.Remove(filename)
+	segmentFiles, _ := filepath.Glob(filename + ".*")
+	for _, segmentFile := range segmentFiles {
+		os.Remove(segmentFile)
+	}
+	os.Remove(filepath.Join(dbDir, file.LockFile))
 	os.Remove(dbDir)
 }
 
+// pinBuffer pins a buffer to the block, which must succeed
+func pinBuffer(t testing.TB, bufPool *buffer.BufferPool, block file.Block) *buffer.Buffer {
+	buf, err := bufPool.PinBuffer(block)
+	assert.NoError(t, err)
+	return buf
+}
+
 func TestReuseAllocatedBuffer(t *testing.T) {
 	bufferCount := 8
-	db := server.NewDB(dbDir, blockTestSize, bufferCount)
+	db, err := server.NewDB(dbDir, blockTestSize, bufferCount)
+	assert.NoError(t, err)
 	createFile(db.FileMgr, filename)
 	defer removeFile(db.FileMgr.DbFilePath(filename), dbDir)
 	defer removeFile(db.FileMgr.DbFilePath(logFile), dbDir)
+	defer db.Close()
 
 	block := file.GetBlock(filename, 2)
 	pos1 := int64(88)
@@ -43,7 +61,7 @@ func TestReuseAllocatedBuffer(t *testing.T) {
 
 	// Pin a buffer to the block, change some content in memory.
 	// Notify the buffer that the buffer page is modified and then unpin the buffer.
-	buf1 := bufPool.PinBuffer(block)
+	buf1 := pinBuffer(t, bufPool, block)
 	bufPool.PrintStatus()
 	assert.Equal(t, bufferCount-1, bufPool.Available())
 	assert.Equal(t, 1, len(bufPool.AllocatedBuffers))
@@ -63,12 +81,13 @@ func TestReuseAllocatedBuffer(t *testing.T) {
 	assert.Equal(t, bufferCount, bufPool.Available())
 	assert.Equal(t, 1, len(bufPool.AllocatedBuffers))
 	verifyAllocatedBuffer(t, bufPool, block, false, 0, 1)
-	assert.False(t, bufPool.UnpinnedBuffers[bufferCount-1].IsPinned())
-	assert.Equal(t, int64(2), bufPool.UnpinnedBuffers[bufferCount-1].Block.Number)
+	lru := bufPool.Policy.(*buffer.LRUPolicy)
+	assert.False(t, lru.Buffers[bufferCount-1].IsPinned())
+	assert.Equal(t, int64(2), lru.Buffers[bufferCount-1].Block.Number)
 
 	// If we now try to pin a buffer to the same block,
 	// then the buffer that was previously allocated to the same block is selected again.
-	buf2 := bufPool.PinBuffer(block)
+	buf2 := pinBuffer(t, bufPool, block)
 	bufPool.PrintStatus()
 	assert.Equal(t, bufferCount-1, bufPool.Available())
 	assert.Equal(t, 1, len(bufPool.AllocatedBuffers))
@@ -89,10 +108,12 @@ func TestReuseAllocatedBuffer(t *testing.T) {
 
 func TestBufferPinningAndUnpinning(t *testing.T) {
 	bufferCount := 3
-	db := server.NewDB(dbDir, blockTestSize, bufferCount)
+	db, err := server.NewDB(dbDir, blockTestSize, bufferCount)
+	assert.NoError(t, err)
 	createFile(db.FileMgr, filename)
 	defer removeFile(db.FileMgr.DbFilePath(filename), dbDir)
 	defer removeFile(db.FileMgr.DbFilePath(logFile), dbDir)
+	defer db.Close()
 
 	bufPool := db.BufPool
 	bufPool.PrintStatus()
@@ -100,7 +121,7 @@ func TestBufferPinningAndUnpinning(t *testing.T) {
 	assert.Equal(t, 0, len(bufPool.AllocatedBuffers))
 
 	block1 := file.GetBlock(filename, 1)
-	buf1 := bufPool.PinBuffer(block1)
+	buf1 := pinBuffer(t, bufPool, block1)
 	bufPool.PrintStatus()
 	assert.Equal(t, bufferCount-1, bufPool.Available())
 	assert.Equal(t, 1, len(bufPool.AllocatedBuffers))
@@ -118,7 +139,7 @@ func TestBufferPinningAndUnpinning(t *testing.T) {
 	verifyAllocatedBuffer(t, bufPool, block1, false, 0, 1)
 
 	block2 := file.GetBlock(filename, 2)
-	buf2 := bufPool.PinBuffer(block2)
+	buf2 := pinBuffer(t, bufPool, block2)
 	bufPool.PrintStatus()
 	assert.Equal(t, bufferCount-1, bufPool.Available())
 	assert.Equal(t, 2, len(bufPool.AllocatedBuffers))
@@ -126,7 +147,7 @@ func TestBufferPinningAndUnpinning(t *testing.T) {
 	verifyAllocatedBuffer(t, bufPool, block2, true, 1, -1)
 
 	block3 := file.GetBlock(filename, 3)
-	bufPool.PinBuffer(block3)
+	pinBuffer(t, bufPool, block3)
 	bufPool.PrintStatus()
 	assert.Equal(t, bufferCount-2, bufPool.Available())
 	assert.Equal(t, 3, len(bufPool.AllocatedBuffers))
@@ -135,7 +156,7 @@ func TestBufferPinningAndUnpinning(t *testing.T) {
 	verifyAllocatedBuffer(t, bufPool, block3, true, 1, -1)
 
 	block4 := file.GetBlock(filename, 4)
-	bufPool.PinBuffer(block4)
+	pinBuffer(t, bufPool, block4)
 	bufPool.PrintStatus()
 	assert.Equal(t, 0, bufPool.Available())
 	assert.Equal(t, 3, len(bufPool.AllocatedBuffers))
@@ -151,7 +172,7 @@ func TestBufferPinningAndUnpinning(t *testing.T) {
 	verifyAllocatedBuffer(t, bufPool, block3, true, 1, -1)
 	verifyAllocatedBuffer(t, bufPool, block4, true, 1, -1)
 
-	buf := bufPool.PinBuffer(block1)
+	buf := pinBuffer(t, bufPool, block1)
 	page2 := buf.Contents
 	page2.SetInt(80, 9999)
 	buf.SetModified(1, 0)
@@ -172,10 +193,12 @@ func verifyAllocatedBuffer(t *testing.T, bufPool *buffer.BufferPool, block file.
 
 func TestFailedPinWhenBufferNotFree(t *testing.T) {
 	bufferCount := 3
-	db := server.NewDB(dbDir, blockTestSize, bufferCount)
+	db, err := server.NewDB(dbDir, blockTestSize, bufferCount)
+	assert.NoError(t, err)
 	createFile(db.FileMgr, filename)
 	defer removeFile(db.FileMgr.DbFilePath(filename), dbDir)
 	defer removeFile(db.FileMgr.DbFilePath(logFile), dbDir)
+	defer db.Close()
 
 	bufPool := db.BufPool
 	block0 := file.GetBlock(filename, 0)
@@ -186,9 +209,9 @@ func TestFailedPinWhenBufferNotFree(t *testing.T) {
 	assert.Equal(t, bufferCount, bufPool.Available())
 	assert.Equal(t, 0, len(bufPool.AllocatedBuffers))
 
-	bufPool.PinBuffer(block0)
-	buf1 := bufPool.PinBuffer(block1)
-	buf2 := bufPool.PinBuffer(block2)
+	pinBuffer(t, bufPool, block0)
+	buf1 := pinBuffer(t, bufPool, block1)
+	buf2 := pinBuffer(t, bufPool, block2)
 	bufPool.PrintStatus()
 	assert.Equal(t, 0, bufPool.Available())
 	assert.Equal(t, bufferCount, len(bufPool.AllocatedBuffers))
@@ -197,19 +220,20 @@ func TestFailedPinWhenBufferNotFree(t *testing.T) {
 	verifyAllocatedBuffer(t, bufPool, block2, true, 1, -1)
 
 	bufPool.UnpinBuffer(buf1)
-	bufPool.PinBuffer(block0)
-	bufPool.PinBuffer(block1)
+	pinBuffer(t, bufPool, block0)
+	pinBuffer(t, bufPool, block1)
 	bufPool.PrintStatus()
 	verifyAllocatedBuffer(t, bufPool, block0, true, 2, -1)
 	verifyAllocatedBuffer(t, bufPool, block1, true, 1, -1)
 	verifyAllocatedBuffer(t, bufPool, block2, true, 1, -1)
 
-	// This PinBuffer should fail and should return nil since all buffers are occupied
-	assert.Nil(t, bufPool.PinBuffer(block3, true))
+	// This PinBuffer should fail with ErrBufferAbort since all buffers are occupied
+	_, err = bufPool.PinBuffer(block3, true)
+	assert.ErrorIs(t, err, buffer.ErrBufferAbort)
 
 	// If we Unpin a buffer and try again, it should succeed
 	bufPool.UnpinBuffer(buf2)
-	assert.NotNil(t, bufPool.PinBuffer(block3))
+	pinBuffer(t, bufPool, block3)
 	bufPool.PrintStatus()
 	verifyAllocatedBuffer(t, bufPool, block0, true, 2, -1)
 	verifyAllocatedBuffer(t, bufPool, block1, true, 1, -1)
@@ -218,18 +242,20 @@ func TestFailedPinWhenBufferNotFree(t *testing.T) {
 
 func TestFlushAll(t *testing.T) {
 	bufferCount := 3
-	db := server.NewDB(dbDir, blockTestSize, bufferCount)
+	db, err := server.NewDB(dbDir, blockTestSize, bufferCount)
+	assert.NoError(t, err)
 	createFile(db.FileMgr, filename)
 	defer removeFile(db.FileMgr.DbFilePath(filename), dbDir)
 	defer removeFile(db.FileMgr.DbFilePath(logFile), dbDir)
+	defer db.Close()
 
 	bufPool := db.BufPool
 	block0 := file.GetBlock(filename, 0)
 	block1 := file.GetBlock(filename, 1)
 	block2 := file.GetBlock(filename, 2)
-	buf0 := bufPool.PinBuffer(block0)
-	buf1 := bufPool.PinBuffer(block1)
-	buf2 := bufPool.PinBuffer(block2)
+	buf0 := pinBuffer(t, bufPool, block0)
+	buf1 := pinBuffer(t, bufPool, block1)
+	buf2 := pinBuffer(t, bufPool, block2)
 	verifyAllocatedBuffer(t, bufPool, block0, true, 1, -1)
 	verifyAllocatedBuffer(t, bufPool, block1, true, 1, -1)
 	verifyAllocatedBuffer(t, bufPool, block2, true, 1, -1)
@@ -241,7 +267,7 @@ func TestFlushAll(t *testing.T) {
 	verifyAllocatedBuffer(t, bufPool, block1, true, 1, 1)
 	verifyAllocatedBuffer(t, bufPool, block2, true, 1, 2)
 
-	bufPool.FlushAll(1)
+	assert.NoError(t, bufPool.FlushAll(1))
 	// Only buffers with txNum = 1 should be flushed to disk and txNum changed to -1
 	verifyAllocatedBuffer(t, bufPool, block0, true, 1, -1)
 	verifyAllocatedBuffer(t, bufPool, block1, true, 1, -1)
@@ -249,7 +275,7 @@ func TestFlushAll(t *testing.T) {
 
 	buf0.SetModified(3, 0)
 	buf1.SetModified(3, 1)
-	bufPool.FlushAll(2)
+	assert.NoError(t, bufPool.FlushAll(2))
 	// Only buffers with txNum = 2 should be flushed to disk and txNum changed to -1
 	verifyAllocatedBuffer(t, bufPool, block0, true, 1, 3)
 	verifyAllocatedBuffer(t, bufPool, block1, true, 1, 3)
@@ -258,10 +284,77 @@ func TestFlushAll(t *testing.T) {
 	buf2.SetModified(3, 2)
 	verifyAllocatedBuffer(t, bufPool, block2, true, 1, 3)
 
-	bufPool.FlushAll(3)
+	assert.NoError(t, bufPool.FlushAll(3))
 	// All buffers have txNum = 3 so all buffers should be flushed to disk and txNum changed to -1
 	verifyAllocatedBuffer(t, bufPool, block0, true, 1, -1)
 	verifyAllocatedBuffer(t, bufPool, block1, true, 1, -1)
 	verifyAllocatedBuffer(t, bufPool, block2, true, 1, -1)
 
 }
+
+func TestPinCorruptBlock(t *testing.T) {
+	bufferCount := 3
+	db, err := server.NewDB(dbDir, blockTestSize, bufferCount)
+	assert.NoError(t, err)
+	createFile(db.FileMgr, filename)
+	defer removeFile(db.FileMgr.DbFilePath(filename), dbDir)
+	defer removeFile(db.FileMgr.DbFilePath(logFile), dbDir)
+	defer db.Close()
+
+	// write block1 and then corrupt its contents on disk
+	block1 := file.GetBlock(filename, 1)
+	page := file.NewPageWithSize(blockTestSize)
+	page.SetString(0, "abc")
+	db.FileMgr.Write(block1, page)
+	f, _ := os.OpenFile(db.FileMgr.DbFilePath(filename), os.O_RDWR, 0666)
+	f.WriteAt([]byte("x"), 1*db.FileMgr.FrameSize()+10)
+	f.Close()
+
+	bufPool := db.BufPool
+	_, err = bufPool.PinBuffer(block1)
+	assert.ErrorIs(t, err, file.ErrCorruptBlock)
+	assert.Equal(t, bufferCount, bufPool.Available())
+	assert.Equal(t, 0, len(bufPool.AllocatedBuffers))
+
+	block2 := file.GetBlock(filename, 2)
+	pinBuffer(t, bufPool, block2)
+	verifyAllocatedBuffer(t, bufPool, block2, true, 1, -1)
+}
+
+func TestPinBufferWaitsForUnpin(t *testing.T) {
+	bufferCount := 2
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, bufferCount)
+	assert.NoError(t, err)
+	defer db.Close()
+	for i := 0; i < 3; i++ {
+		_, err = db.FileMgr.Append(filename)
+		assert.NoError(t, err)
+	}
+
+	bufPool := db.BufPool
+	buf0 := pinBuffer(t, bufPool, file.GetBlock(filename, 0))
+	pinBuffer(t, bufPool, file.GetBlock(filename, 1))
+	block2 := file.GetBlock(filename, 2)
+
+	// the wait ends with ErrBufferAbort when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	buf, err := bufPool.PinBufferContext(ctx, block2)
+	assert.Nil(t, buf)
+	assert.ErrorIs(t, err, buffer.ErrBufferAbort)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// the waiting pin gets the buffer as soon as it is unpinned
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		bufPool.UnpinBuffer(buf0)
+	}()
+	start = time.Now()
+	buf, err = bufPool.PinBufferContext(context.Background(), block2)
+	assert.NoError(t, err)
+	assert.Equal(t, block2, buf.Block)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 0, bufPool.Available())
+}
@@ -0,0 +1,361 @@
+package buffer
+
+import "slices"
+
+/*
+When a block is not in the BufferPool, one of the unpinned buffers is replaced: its page is assigned to the new block.
+The ReplacementPolicy of the BufferPool chooses that buffer, the victim.
+
++==========+===================================================================================================+
+| Policy   | Victim                                                                                            |
++==========+===================================================================================================+
+| LRU      | the buffer unpinned the longest time ago                                                          |
+| Clock    | the next buffer after the clock hand not pinned since the hand last passed it (second chance)     |
+| LRU-K    | the buffer whose K-th most recent pin is the oldest, buffers pinned fewer than K times come first |
+| 2Q       | the oldest buffer of the A1in FIFO if it is over its share, otherwise the LRU buffer of Am        |
++----------+---------------------------------------------------------------------------------------------------+
+
+LRU is fooled by scans: a scan of more blocks than there are buffers replaces every buffer,
+including those of the blocks that are used all the time. LRU-K and 2Q only keep a block in the pool
+if it was used again after its first use, so the blocks of a scan are replaced first.
+LRU-K remembers the pins of the blocks it replaced for a while, so a block used again soon after it was replaced
+is not treated as new, 2Q remembers the blocks replaced from A1in in A1out for the same purpose.
+*/
+
+// ReplacementPolicy chooses the unpinned buffer to replace when a block that is not in the BufferPool is pinned.
+// The BufferPool calls the methods with its lock held.
+type ReplacementPolicy interface {
+	// Pinned is called every time buf is pinned, after buf is assigned to its block if it was chosen by Victim
+	Pinned(buf *Buffer)
+	// Unpinned is called when buf is no longer pinned, it can then be chosen by Victim
+	Unpinned(buf *Buffer)
+	// Victim chooses the unpinned buffer to replace, which cannot be chosen again until it is unpinned.
+	// Returns nil if all the buffers are pinned.
+	Victim() *Buffer
+	// Available returns the number of unpinned buffers
+	Available() int
+}
+
+// LRUPolicy replaces the buffer unpinned the longest time ago, it is the default ReplacementPolicy
+type LRUPolicy struct {
+	// Buffers are the unpinned buffers, the least recently used first
+	Buffers []*Buffer
+}
+
+func NewLRUPolicy() *LRUPolicy {
+	return &LRUPolicy{}
+}
+
+func (p *LRUPolicy) Pinned(buf *Buffer) {
+	for i := 0; i < len(p.Buffers); i++ {
+		if p.Buffers[i].ID == buf.ID {
+			p.Buffers = append(p.Buffers[:i], p.Buffers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *LRUPolicy) Unpinned(buf *Buffer) {
+	p.Buffers = append(p.Buffers, buf)
+}
+
+func (p *LRUPolicy) Victim() *Buffer {
+	if len(p.Buffers) == 0 {
+		return nil
+	}
+	buf := p.Buffers[0]
+	p.Buffers = p.Buffers[1:]
+	return buf
+}
+
+func (p *LRUPolicy) Available() int {
+	return len(p.Buffers)
+}
+
+// ClockPolicy keeps the buffers in a ring and a clock hand that goes around it.
+// A buffer pinned since the hand last passed it gets a second chance, the hand clears its reference bit and moves on.
+type ClockPolicy struct {
+	ring       []*Buffer
+	slots      map[*Buffer]int
+	referenced []bool
+	unpinned   []bool
+	available  int
+	hand       int
+}
+
+func NewClockPolicy() *ClockPolicy {
+	return &ClockPolicy{slots: make(map[*Buffer]int)}
+}
+
+// slot returns the position of buf in the ring, adding it to the ring the first time
+func (p *ClockPolicy) slot(buf *Buffer) int {
+	i, ok := p.slots[buf]
+	if !ok {
+		i = len(p.ring)
+		p.slots[buf] = i
+		p.ring = append(p.ring, buf)
+		p.referenced = append(p.referenced, false)
+		p.unpinned = append(p.unpinned, false)
+	}
+	return i
+}
+
+func (p *ClockPolicy) Pinned(buf *Buffer) {
+	i := p.slot(buf)
+	p.referenced[i] = true
+	if p.unpinned[i] {
+		p.unpinned[i] = false
+		p.available--
+	}
+}
+
+func (p *ClockPolicy) Unpinned(buf *Buffer) {
+	i := p.slot(buf)
+	if !p.unpinned[i] {
+		p.unpinned[i] = true
+		p.available++
+	}
+}
+
+func (p *ClockPolicy) Victim() *Buffer {
+	if p.available == 0 {
+		return nil
+	}
+	// at most two turns, the first one may clear all the reference bits
+	for {
+		i := p.hand
+		p.hand = (p.hand + 1) % len(p.ring)
+		if !p.unpinned[i] {
+			continue
+		}
+		if p.referenced[i] {
+			p.referenced[i] = false
+			continue
+		}
+		p.unpinned[i] = false
+		p.available--
+		return p.ring[i]
+	}
+}
+
+func (p *ClockPolicy) Available() int {
+	return p.available
+}
+
+// LRUKPolicy replaces the buffer whose K-th most recent pin is the oldest (LRU-2 when K is 2).
+// The buffers pinned fewer than K times are replaced first, the least recently pinned of them first.
+// The pins of a replaced block are remembered until as many other blocks have been replaced as there are buffers.
+type LRUKPolicy struct {
+	k     int
+	clock int64
+
+	// history holds the times of the K most recent pins of each block, the most recent first
+	history  map[string][]int64
+	buffers  map[*Buffer]bool
+	unpinned map[*Buffer]bool
+
+	// replaced are the blocks replaced whose history is still kept, the oldest first
+	replaced []string
+}
+
+func NewLRUKPolicy(k int) *LRUKPolicy {
+	return &LRUKPolicy{
+		k:        max(k, 1),
+		history:  make(map[string][]int64),
+		buffers:  make(map[*Buffer]bool),
+		unpinned: make(map[*Buffer]bool),
+	}
+}
+
+func (p *LRUKPolicy) Pinned(buf *Buffer) {
+	p.clock++
+	key := buf.Block.String()
+	times := p.history[key]
+	if len(times) < p.k {
+		times = append(times, 0)
+	}
+	copy(times[1:], times)
+	times[0] = p.clock
+	p.history[key] = times
+	delete(p.unpinned, buf)
+}
+
+func (p *LRUKPolicy) Unpinned(buf *Buffer) {
+	p.buffers[buf] = true
+	p.unpinned[buf] = true
+}
+
+// distance returns the time of the K-th most recent pin of the block of buf and of its most recent pin,
+// the buffer with the smallest distance is replaced
+func (p *LRUKPolicy) distance(buf *Buffer) (int64, int64) {
+	times := p.history[buf.Block.String()]
+	if len(times) == 0 {
+		return 0, 0
+	}
+	if len(times) < p.k {
+		return 0, times[0]
+	}
+	return times[p.k-1], times[0]
+}
+
+func (p *LRUKPolicy) Victim() *Buffer {
+	var victim *Buffer
+	var victimKth, victimLast int64
+	for buf := range p.unpinned {
+		kth, last := p.distance(buf)
+		if victim == nil || kth < victimKth || (kth == victimKth && last < victimLast) {
+			victim, victimKth, victimLast = buf, kth, last
+		}
+	}
+	if victim == nil {
+		return nil
+	}
+	delete(p.unpinned, victim)
+
+	if victimLast > 0 {
+		p.replaced = append(p.replaced, victim.Block.String())
+		for len(p.replaced) > len(p.buffers) {
+			forgotten := p.replaced[0]
+			p.replaced = p.replaced[1:]
+			if !p.resident(forgotten) {
+				delete(p.history, forgotten)
+			}
+		}
+	}
+	return victim
+}
+
+// resident reports whether a buffer is assigned to the block
+func (p *LRUKPolicy) resident(key string) bool {
+	for buf := range p.buffers {
+		if buf.Block.String() == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *LRUKPolicy) Available() int {
+	return len(p.unpinned)
+}
+
+// twoQEntry is the state of a buffer in TwoQPolicy
+type twoQEntry struct {
+	// block is the block the buffer was assigned to when it was last pinned, empty if it was never pinned
+	block string
+	// frequent is true if the buffer is in Am, false if it is in A1in
+	frequent bool
+	// order is when the buffer entered A1in, or when it was last pinned in Am
+	order int64
+}
+
+// TwoQPolicy is the full version of 2Q: a block pinned for the first time enters the A1in FIFO,
+// which holds a quarter of the buffers. The blocks replaced from A1in are remembered in A1out,
+// which holds half as many blocks as there are buffers, and enter the Am LRU list if they are pinned again.
+// The pins of a block in A1in are not counted, they are usually correlated.
+type TwoQPolicy struct {
+	clock    int64
+	entries  map[*Buffer]*twoQEntry
+	unpinned map[*Buffer]bool
+
+	// a1out are the blocks replaced from A1in, the oldest first
+	a1out []string
+}
+
+func NewTwoQPolicy() *TwoQPolicy {
+	return &TwoQPolicy{
+		entries:  make(map[*Buffer]*twoQEntry),
+		unpinned: make(map[*Buffer]bool),
+	}
+}
+
+func (p *TwoQPolicy) entry(buf *Buffer) *twoQEntry {
+	e, ok := p.entries[buf]
+	if !ok {
+		e = &twoQEntry{}
+		p.entries[buf] = e
+	}
+	return e
+}
+
+func (p *TwoQPolicy) Pinned(buf *Buffer) {
+	p.clock++
+	e := p.entry(buf)
+	key := buf.Block.String()
+	if e.block != key {
+		// the buffer was assigned to a new block
+		i := slices.Index(p.a1out, key)
+		e.frequent = i >= 0
+		if e.frequent {
+			p.a1out = slices.Delete(p.a1out, i, i+1)
+		}
+		e.block = key
+		e.order = p.clock
+	} else if e.frequent {
+		e.order = p.clock
+	}
+	delete(p.unpinned, buf)
+}
+
+func (p *TwoQPolicy) Unpinned(buf *Buffer) {
+	p.entry(buf)
+	p.unpinned[buf] = true
+}
+
+func (p *TwoQPolicy) Victim() *Buffer {
+	var a1inCount int
+	var unused, oldestA1in, oldestAm *Buffer
+	for buf, e := range p.entries {
+		if e.block != "" && !e.frequent {
+			a1inCount++
+		}
+		if !p.unpinned[buf] {
+			continue
+		}
+		switch {
+		case e.block == "":
+			unused = buf
+		case e.frequent:
+			if oldestAm == nil || e.order < p.entries[oldestAm].order {
+				oldestAm = buf
+			}
+		default:
+			if oldestA1in == nil || e.order < p.entries[oldestA1in].order {
+				oldestA1in = buf
+			}
+		}
+	}
+
+	victim := unused
+	if victim == nil {
+		if oldestA1in != nil && (a1inCount > max(1, len(p.entries)/4) || oldestAm == nil) {
+			victim = oldestA1in
+		} else {
+			victim = oldestAm
+		}
+	}
+	if victim == nil {
+		return nil
+	}
+	delete(p.unpinned, victim)
+
+	e := p.entries[victim]
+	if e.block != "" && !e.frequent {
+		p.addToA1out(e.block)
+	}
+	e.block = ""
+	e.frequent = false
+	return victim
+}
+
+// addToA1out remembers a block replaced from A1in, and forgets the oldest one if A1out is full
+func (p *TwoQPolicy) addToA1out(key string) {
+	p.a1out = append(p.a1out, key)
+	if len(p.a1out) > max(1, len(p.entries)/2) {
+		p.a1out = p.a1out[1:]
+	}
+}
+
+func (p *TwoQPolicy) Available() int {
+	return len(p.unpinned)
+}
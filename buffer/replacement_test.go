@@ -0,0 +1,167 @@
+package buffer_test
+
+import (
+	"fmt"
+	"github.com/naveen246/kite-db/buffer"
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/server"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+var replacementPolicies = []struct {
+	name      string
+	newPolicy func() buffer.ReplacementPolicy
+}{
+	{"LRU", func() buffer.ReplacementPolicy { return buffer.NewLRUPolicy() }},
+	{"Clock", func() buffer.ReplacementPolicy { return buffer.NewClockPolicy() }},
+	{"LRU-2", func() buffer.ReplacementPolicy { return buffer.NewLRUKPolicy(2) }},
+	{"2Q", func() buffer.ReplacementPolicy { return buffer.NewTwoQPolicy() }},
+}
+
+// newTestBufferPool returns a BufferPool using policy, with a file of blockCount blocks in memory
+func newTestBufferPool(t testing.TB, bufferCount int, blockCount int, policy buffer.ReplacementPolicy) *buffer.BufferPool {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, bufferCount)
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	for i := 0; i < blockCount; i++ {
+		_, err = db.FileMgr.Append(filename)
+		assert.NoError(t, err)
+	}
+	return buffer.NewBufferPool(db.FileMgr, db.Log, bufferCount, buffer.WithReplacementPolicy(policy))
+}
+
+// access pins and unpins the block, returns true if the block was already in the pool
+func access(t testing.TB, bufPool *buffer.BufferPool, blockNum int64) bool {
+	block := file.GetBlock(filename, blockNum)
+	_, hit := bufPool.AllocatedBuffers[block.String()]
+	buf, err := bufPool.PinBuffer(block, true)
+	assert.NoError(t, err)
+	bufPool.UnpinBuffer(buf)
+	return hit
+}
+
+func TestReplacementPolicies(t *testing.T) {
+	bufferCount := 8
+	hotBlock := int64(100)
+	scan := func(bufPool *buffer.BufferPool, from int64, count int64) {
+		for i := from; i < from+count; i++ {
+			access(t, bufPool, i)
+		}
+	}
+
+	tests := []struct {
+		name string
+		// hotBlockStays are the policies that keep the hot block in the pool after the scan
+		hotBlockStays map[string]bool
+		run           func(bufPool *buffer.BufferPool)
+	}{
+		{
+			name:          "used twice before a scan",
+			hotBlockStays: map[string]bool{"LRU-2": true},
+			run: func(bufPool *buffer.BufferPool) {
+				access(t, bufPool, hotBlock)
+				access(t, bufPool, hotBlock)
+				scan(bufPool, 0, 20)
+			},
+		},
+		{
+			name:          "used again after it was replaced",
+			hotBlockStays: map[string]bool{"LRU-2": true, "2Q": true},
+			run: func(bufPool *buffer.BufferPool) {
+				access(t, bufPool, hotBlock)
+				scan(bufPool, 0, 10)
+				assert.False(t, access(t, bufPool, hotBlock))
+				scan(bufPool, 10, 20)
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, policy := range replacementPolicies {
+			t.Run(tt.name+"/"+policy.name, func(t *testing.T) {
+				bufPool := newTestBufferPool(t, bufferCount, 200, policy.newPolicy())
+				tt.run(bufPool)
+				assert.Equal(t, bufferCount, bufPool.Available())
+				assert.Len(t, bufPool.AllocatedBuffers, bufferCount)
+				_, ok := bufPool.AllocatedBuffers[file.GetBlock(filename, hotBlock).String()]
+				assert.Equal(t, tt.hotBlockStays[policy.name], ok)
+			})
+		}
+	}
+}
+
+func TestReplacementPolicyPinnedBuffers(t *testing.T) {
+	for _, policy := range replacementPolicies {
+		t.Run(policy.name, func(t *testing.T) {
+			bufPool := newTestBufferPool(t, 3, 10, policy.newPolicy())
+			buf0 := pinBuffer(t, bufPool, file.GetBlock(filename, 0))
+			buf1 := pinBuffer(t, bufPool, file.GetBlock(filename, 1))
+			access(t, bufPool, 2)
+			access(t, bufPool, 3)
+			assert.Equal(t, 1, bufPool.Available())
+
+			// the pinned buffers are never replaced
+			pinBuffer(t, bufPool, file.GetBlock(filename, 4))
+			assert.Equal(t, 0, bufPool.Available())
+			_, err := bufPool.PinBuffer(file.GetBlock(filename, 5), true)
+			assert.ErrorIs(t, err, buffer.ErrBufferAbort)
+			assert.Same(t, buf0, bufPool.AllocatedBuffers[file.GetBlock(filename, 0).String()])
+			assert.Same(t, buf1, bufPool.AllocatedBuffers[file.GetBlock(filename, 1).String()])
+
+			bufPool.UnpinBuffer(buf1)
+			assert.Equal(t, 1, bufPool.Available())
+			_, err = bufPool.PinBuffer(file.GetBlock(filename, 5), true)
+			assert.NoError(t, err)
+			_, ok := bufPool.AllocatedBuffers[file.GetBlock(filename, 1).String()]
+			assert.False(t, ok)
+		})
+	}
+}
+
+// BenchmarkReplacementPolicies reports the hit ratio of each policy:
+// "point-lookups" pins blocks picked at random with a skewed (Zipf) distribution,
+// "scans" interleaves lookups of a small set of hot blocks with sequential scans of the whole file.
+func BenchmarkReplacementPolicies(b *testing.B) {
+	bufferCount := 64
+	var blockCount int64 = 1024
+	workloads := []struct {
+		name string
+		next func(rnd *rand.Rand) func() int64
+	}{
+		{"point-lookups", func(rnd *rand.Rand) func() int64 {
+			zipf := rand.NewZipf(rnd, 1.1, 1, uint64(blockCount-1))
+			return func() int64 {
+				return int64(zipf.Uint64())
+			}
+		}},
+		{"scans", func(rnd *rand.Rand) func() int64 {
+			var i, scanned int64
+			return func() int64 {
+				i++
+				if i%4 == 0 {
+					return rnd.Int63n(int64(bufferCount / 2))
+				}
+				scanned++
+				return scanned % blockCount
+			}
+		}},
+	}
+
+	for _, workload := range workloads {
+		for _, policy := range replacementPolicies {
+			b.Run(fmt.Sprintf("%v/%v", workload.name, policy.name), func(b *testing.B) {
+				bufPool := newTestBufferPool(b, bufferCount, int(blockCount), policy.newPolicy())
+				next := workload.next(rand.New(rand.NewSource(1)))
+				hits := 0
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if access(b, bufPool, next()) {
+						hits++
+					}
+				}
+				b.ReportMetric(float64(hits)/float64(b.N), "hit-ratio")
+			})
+		}
+	}
+}
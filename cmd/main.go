@@ -1,7 +1,32 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage:
+  kitedb wal dump [flags] DBDIR    print the records of the log of the DB in DBDIR`
 
 func main() {
-	fmt.Println("KiteDB")
+	err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command given by args, and writes its output to out
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprintln(out, "KiteDB")
+		fmt.Fprintln(out, usage)
+		return nil
+	}
+
+	if len(args) >= 2 && args[0] == "wal" && args[1] == "dump" {
+		return walDump(args[2:], out)
+	}
+	return fmt.Errorf("unknown command %q\n%v", args, usage)
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/server"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/naveen246/kite-db/wal"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// recordFilter selects the log records printed by wal dump
+type recordFilter struct {
+	txNum    *txn.TxID
+	filename string
+	blockNum int64
+	types    map[int]bool
+}
+
+func (f recordFilter) match(info txn.RecordInfo) bool {
+	if f.txNum != nil && info.TxNum != *f.txNum {
+		return false
+	}
+	if f.filename != "" && (info.Filename == nil || *info.Filename != f.filename) {
+		return false
+	}
+	if f.blockNum >= 0 && (info.BlockNum == nil || *info.BlockNum != f.blockNum) {
+		return false
+	}
+	if f.types != nil && !f.types[info.Type] {
+		return false
+	}
+	return true
+}
+
+// walDump prints the log records of a DB, from the oldest to the latest.
+// The DB directory is opened read-only, so the log of a DB that is in use can be inspected.
+func walDump(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("wal dump", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: kitedb wal dump [flags] DBDIR")
+		flags.PrintDefaults()
+	}
+	blockSize := flags.Int64("block-size", 0, "block size the DB was created with (required)")
+	logFile := flags.String("log", server.LogFile, "name of the log file")
+	txNum := flags.Int64("tx", 0, "only print the records of this transaction")
+	filename := flags.String("file", "", "only print the records of this file")
+	blockNum := flags.Int64("block", -1, "only print the records of this block number")
+	types := flags.String("type", "", "only print the records of these comma separated types, such as setint,commit")
+	from := flags.Int64("from", 0, "only print the records with LSN >= from")
+	to := flags.Int64("to", math.MaxInt64, "only print the records with LSN <= to")
+	asJSON := flags.Bool("json", false, "print each record as a JSON object on its own line")
+	keyFile := flags.String("key-file", "", "file holding the encryption key of an encrypted DB, its raw 16, 24 or 32 bytes")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("wal dump needs the DB directory")
+	}
+	if *blockSize <= 0 {
+		return errors.New("wal dump needs the -block-size of the DB")
+	}
+
+	filter := recordFilter{
+		filename: *filename,
+		blockNum: *blockNum,
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "tx" {
+			filter.txNum = (*txn.TxID)(txNum)
+		}
+	})
+	if *types != "" {
+		filter.types = make(map[int]bool)
+		for _, name := range strings.Split(*types, ",") {
+			recordType, err := txn.ParseRecordType(strings.TrimSpace(name))
+			if err != nil {
+				return err
+			}
+			filter.types[recordType] = true
+		}
+	}
+
+	fileOpts := []file.Option{file.WithReadOnly()}
+	if *keyFile != "" {
+		key, err := os.ReadFile(*keyFile)
+		if err != nil {
+			return fmt.Errorf("could not read encryption key: %w", err)
+		}
+		fileOpts = append(fileOpts, file.WithEncryptionKey(key))
+	}
+
+	fileMgr, err := file.NewFileMgr(flags.Arg(0), *blockSize, fileOpts...)
+	if err != nil {
+		return err
+	}
+	defer fileMgr.Close()
+	log, err := wal.NewLog(fileMgr, *logFile)
+	if err != nil {
+		return err
+	}
+	iter, err := log.ForwardIterator(*from)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(out)
+	for iter.HasNext() {
+		record, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		if iter.LSN() > *to {
+			break
+		}
+		info, err := txn.DescribeLogRecord(iter.LSN(), record)
+		if err != nil {
+			return fmt.Errorf("could not decode log record at LSN %v: %w", iter.LSN(), err)
+		}
+		if !filter.match(info) {
+			continue
+		}
+
+		if *asJSON {
+			err = encoder.Encode(info)
+		} else {
+			_, err = fmt.Fprintln(out, info)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/server"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const blockTestSize = 400
+
+func TestWalDump(t *testing.T) {
+	dbDir := t.TempDir()
+	db, err := server.NewDB(dbDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx1, err := db.NewTx()
+	assert.NoError(t, err)
+	block, err := tx1.Append("testfile")
+	assert.NoError(t, err)
+	tx1.Pin(block)
+	assert.NoError(t, tx1.SetInt(block, 8, 100, true))
+	assert.NoError(t, tx1.SetString(block, 40, "abc", true))
+	assert.NoError(t, tx1.Commit())
+	tx2, err := db.NewTx()
+	assert.NoError(t, err)
+	assert.NoError(t, tx2.Rollback())
+
+	// the DB is still open, the log is read without locking the directory
+	dump := func(args ...string) []string {
+		var out bytes.Buffer
+		args = append([]string{"wal", "dump", "-block-size", fmt.Sprint(blockTestSize)}, args...)
+		assert.NoError(t, run(append(args, dbDir), &out))
+		return strings.Split(strings.TrimSpace(out.String()), "\n")
+	}
+
+	var records []map[string]any
+	for _, line := range dump("-json") {
+		// tx numbers do not fit in a float64
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		var record map[string]any
+		assert.NoError(t, decoder.Decode(&record))
+		records = append(records, record)
+	}
+	assert.Len(t, records, 7)
+	types := []string{"START", "CREATEFILE", "SETINT", "SETSTRING", "COMMIT", "START", "ROLLBACK"}
+	for i, typeName := range types {
+		assert.Equal(t, typeName, records[i]["type"])
+	}
+	tx1Num, tx2Num := records[0]["tx"].(json.Number), records[6]["tx"].(json.Number)
+	assert.NotEqual(t, tx1Num, tx2Num)
+	record := records[2]
+	assert.Equal(t, tx1Num, record["tx"])
+	assert.Equal(t, "testfile", record["file"])
+	assert.Equal(t, json.Number("0"), record["block"])
+	assert.Equal(t, json.Number("8"), record["offset"])
+	assert.Equal(t, json.Number("0"), record["old_value"])
+	assert.Equal(t, json.Number("100"), record["new_value"])
+	assert.Equal(t, "", records[3]["old_value"])
+	assert.Equal(t, "abc", records[3]["new_value"])
+	assert.NotEmpty(t, records[4]["commit_time"])
+	lsn := record["lsn"].(json.Number).String()
+
+	lines := dump()
+	assert.Len(t, lines, 7)
+	assert.Contains(t, lines[2], fmt.Sprintf("<SETINT %v [file: testfile, block: 0] 8 0 100>", tx1Num))
+	assert.Contains(t, lines[6], fmt.Sprintf("<ROLLBACK %v>", tx2Num))
+
+	assert.Len(t, dump("-tx", tx2Num.String()), 2)
+	assert.Len(t, dump("-type", "setint,SetString"), 2)
+	assert.Len(t, dump("-file", "testfile"), 3)
+	assert.Len(t, dump("-file", "testfile", "-block", "0"), 2)
+
+	// the LSN range includes both ends
+	lines = dump("-from", lsn, "-to", lsn)
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "<SETINT")
+
+	assert.ErrorIs(t, run([]string{"wal", "dump", "-block-size", "400", "missing_dir"}, &bytes.Buffer{}), os.ErrNotExist)
+	assert.Error(t, run([]string{"wal", "dump", dbDir}, &bytes.Buffer{}))
+	assert.Error(t, run([]string{"wal", "dump", "-block-size", "400", "-type", "update", dbDir}, &bytes.Buffer{}))
+
+	_, err = file.NewFileMgr(dbDir, blockTestSize)
+	assert.ErrorIs(t, err, file.ErrDirLocked)
+}
+
+func TestWalDumpEncrypted(t *testing.T) {
+	dbDir := t.TempDir()
+	key := []byte("0123456789abcdef")
+	db, err := server.NewDB(dbDir, blockTestSize, 8, server.WithEncryptionKey(key))
+	assert.NoError(t, err)
+	defer db.Close()
+	tx, err := db.NewTx()
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, os.WriteFile(keyFile, key, 0600))
+	var out bytes.Buffer
+	args := []string{"wal", "dump", "-block-size", fmt.Sprint(blockTestSize)}
+	assert.NoError(t, run(append(args, "-key-file", keyFile, dbDir), &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], fmt.Sprintf("<COMMIT %v", tx.TxNum))
+
+	assert.ErrorIs(t, run(append(args, dbDir), &bytes.Buffer{}), file.ErrKeyRequired)
+	assert.NoError(t, os.WriteFile(keyFile, []byte("fedcba9876543210"), 0600))
+	assert.ErrorIs(t, run(append(args, "-key-file", keyFile, dbDir), &bytes.Buffer{}), file.ErrWrongKey)
+	assert.ErrorIs(t, run(append(args, "-key-file", "missing_key", dbDir), &bytes.Buffer{}), os.ErrNotExist)
+}
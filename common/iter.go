@@ -2,5 +2,5 @@ package common
 
 type Iterator interface {
 	HasNext() bool
-	Next() []byte
+	Next() ([]byte, error)
 }
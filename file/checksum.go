@@ -0,0 +1,77 @@
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+/*
+Every block is stored on disk as a frame, which is the block data followed by a trailer.
+The trailer holds the CRC32C checksum of the block data,
+it is computed when a block is written and verified when the block is read.
++-------------------+----------+
+| block data        | checksum |
++-------------------+----------+
+| BlockSize bytes   | 4 bytes  |
++-------------------+----------+
+
+The frame of an encrypted block is described in encryption.go.
+
+A frame that is entirely zero is a block that was appended but never written,
+such a block is valid even though the checksum does not match.
+*/
+
+const checksumSize = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var ErrCorruptBlock = errors.New("corrupt block")
+
+// CorruptBlockError is returned by FileMgr.Read
+// when the checksum stored in a block does not match the block data.
+// errors.Is(err, ErrCorruptBlock) is true for a CorruptBlockError.
+type CorruptBlockError struct {
+	Block    Block
+	Stored   uint32
+	Computed uint32
+}
+
+func (e *CorruptBlockError) Error() string {
+	return fmt.Sprintf("corrupt block %v: stored checksum %#08x, computed checksum %#08x", e.Block, e.Stored, e.Computed)
+}
+
+func (e *CorruptBlockError) Is(target error) bool {
+	return target == ErrCorruptBlock
+}
+
+// setChecksum computes the checksum of the data in frame and stores it in the trailer of frame.
+func setChecksum(frame []byte) {
+	dataEnd := len(frame) - checksumSize
+	binary.BigEndian.PutUint32(frame[dataEnd:], crc32.Checksum(frame[:dataEnd], castagnoli))
+}
+
+// verifyChecksum returns a CorruptBlockError if the checksum in the trailer of frame does not match its data.
+func verifyChecksum(block Block, frame []byte) error {
+	dataEnd := len(frame) - checksumSize
+	stored := binary.BigEndian.Uint32(frame[dataEnd:])
+	computed := crc32.Checksum(frame[:dataEnd], castagnoli)
+	if stored == computed || isZero(frame) {
+		return nil
+	}
+	return &CorruptBlockError{
+		Block:    block,
+		Stored:   stored,
+		Computed: computed,
+	}
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
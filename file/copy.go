@@ -0,0 +1,48 @@
+package file
+
+import (
+	"fmt"
+)
+
+// CopyFile copies the file filename of src to dst block by block, replacing the file in dst if it exists,
+// and syncs the copy. The blocks are decrypted and encrypted again if src or dst use an encryption key.
+// src and dst must have the same block size.
+func CopyFile(src *FileMgr, dst *FileMgr, filename string) error {
+	if src.BlockSize != dst.BlockSize {
+		return fmt.Errorf("could not copy %v from block size %v to block size %v", filename, src.BlockSize, dst.BlockSize)
+	}
+	blockCount, err := src.BlockCount(filename)
+	if err != nil {
+		return err
+	}
+
+	exists, err := dst.Exists(filename)
+	if err != nil {
+		return err
+	}
+	if exists {
+		err = dst.Truncate(filename, 0)
+	} else {
+		err = dst.Create(filename)
+	}
+	if err != nil {
+		return err
+	}
+
+	page := NewPageWithSize(src.BlockSize)
+	for blockNum := int64(0); blockNum < blockCount; blockNum++ {
+		err = src.Read(GetBlock(filename, blockNum), page)
+		if err != nil {
+			return err
+		}
+		block, err := dst.Append(filename)
+		if err != nil {
+			return fmt.Errorf("could not copy %v: %w", filename, err)
+		}
+		err = dst.Write(block, page)
+		if err != nil {
+			return err
+		}
+	}
+	return dst.Sync(filename)
+}
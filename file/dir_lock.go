@@ -0,0 +1,48 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LockFile is the file in the DB directory that is locked by the process using the DB,
+// so that two processes cannot open the same DB directory.
+const LockFile = "LOCK"
+
+var ErrDirLocked = errors.New("database directory is locked by another process")
+
+// dirLock is an advisory lock on the LockFile of a directory
+type dirLock struct {
+	file *os.File
+}
+
+// lockDir locks the LockFile of dir, it fails with ErrDirLocked if the lock is held by another process.
+// The lock is released by unlock, or when the process exits.
+func lockDir(dir string) (*dirLock, error) {
+	path := filepath.Join(dir, LockFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, filePermission)
+	if err != nil {
+		return nil, fmt.Errorf("could not open lock file %v: %w", path, err)
+	}
+
+	err = lockFile(file)
+	if err != nil {
+		file.Close()
+		if errors.Is(err, errWouldBlock) {
+			return nil, fmt.Errorf("%w: %v", ErrDirLocked, dir)
+		}
+		return nil, fmt.Errorf("could not lock %v: %w", path, err)
+	}
+	return &dirLock{file: file}, nil
+}
+
+func (l *dirLock) unlock() error {
+	err := unlockFile(l.file)
+	closeErr := l.file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
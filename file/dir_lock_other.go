@@ -0,0 +1,20 @@
+//go:build !unix
+
+package file
+
+import (
+	"errors"
+	"os"
+)
+
+// Advisory file locks are only supported on unix, elsewhere the DB directory is not locked.
+
+var errWouldBlock = errors.New("file is locked")
+
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
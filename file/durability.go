@@ -0,0 +1,39 @@
+package file
+
+// Durability decides when FileMgr asks the OS to flush (fsync) file contents to stable storage.
+// Without an fsync, a write that has returned successfully can still be lost on power failure.
+type Durability int
+
+const (
+	// SyncOnFlush syncs a file only when FileMgr.Sync is called,
+	// which is done when the log is flushed (commit/rollback) and when a dirty buffer is written to disk.
+	SyncOnFlush Durability = iota
+
+	// SyncEveryWrite syncs a file after every Write and Append.
+	SyncEveryWrite
+
+	// SyncNever never syncs files. This is only meant for tests and throwaway databases.
+	SyncNever
+)
+
+func (d Durability) String() string {
+	switch d {
+	case SyncOnFlush:
+		return "SyncOnFlush"
+	case SyncEveryWrite:
+		return "SyncEveryWrite"
+	case SyncNever:
+		return "SyncNever"
+	}
+	return "Unknown"
+}
+
+// Option configures a FileMgr created by NewFileMgr
+type Option func(f *FileMgr)
+
+// WithDurability sets the Durability of the FileMgr, the default is SyncOnFlush
+func WithDurability(durability Durability) Option {
+	return func(f *FileMgr) {
+		f.Durability = durability
+	}
+}
@@ -0,0 +1,157 @@
+package file
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+/*
+When an encryption key is given to FileMgr, every block is encrypted with AES-GCM before it is written
+and decrypted after it is read. The frame of an encrypted block is as below,
+the checksum is computed over everything that precedes it.
++-------------------+----------+----------+----------+
+| encrypted data    | GCM tag  | counter  | checksum |
++-------------------+----------+----------+----------+
+| BlockSize bytes   | 16 bytes | 8 bytes  | 4 bytes  |
++-------------------+----------+----------+----------+
+
+The nonce used to encrypt a block is derived from the filename, the block number and a write counter,
+nonce = first 12 bytes of SHA-256(filename | blockNumber | counter).
+The counter is incremented on every write and stored in the frame so that the nonce can be derived again on read.
+It starts at a random value every time a FileMgr is created, so a nonce is never reused across restarts.
+The filename and block number are also authenticated, a block copied to another position fails to decrypt.
+
+A file keyCheckFile is stored in the DB directory, holding an encrypted block with known contents.
+It is used to verify the key when an encrypted DB is opened.
+*/
+
+const (
+	gcmTagSize         = 16
+	counterSize        = 8
+	encryptionOverhead = gcmTagSize + counterSize
+
+	keyCheckFile = "encryption.check"
+	keyCheckText = "kitedb encryption key check"
+)
+
+var (
+	ErrWrongKey     = errors.New("wrong encryption key")
+	ErrKeyRequired  = errors.New("database is encrypted, an encryption key is required")
+	ErrNotEncrypted = errors.New("database is not encrypted, it cannot be opened with an encryption key")
+)
+
+// WithEncryptionKey encrypts all blocks at rest with AES-GCM using key,
+// which must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func WithEncryptionKey(key []byte) Option {
+	return func(f *FileMgr) {
+		f.encryptionKey = key
+	}
+}
+
+// blockCipher encrypts and decrypts the contents of blocks
+type blockCipher struct {
+	aead    cipher.AEAD
+	counter atomic.Uint64
+}
+
+func newBlockCipher(key []byte) (*blockCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &blockCipher{aead: aead}
+	seed := make([]byte, counterSize)
+	_, err = rand.Read(seed)
+	if err != nil {
+		return nil, err
+	}
+	c.counter.Store(binary.BigEndian.Uint64(seed))
+	return c, nil
+}
+
+// seal encrypts data (BlockSize bytes) of block into payload (BlockSize + encryptionOverhead bytes)
+func (c *blockCipher) seal(block Block, data []byte, payload []byte) {
+	counter := c.counter.Add(1)
+	ciphertextEnd := len(payload) - counterSize
+	binary.BigEndian.PutUint64(payload[ciphertextEnd:], counter)
+	c.aead.Seal(payload[:0], nonce(block, counter), data, additionalData(block))
+}
+
+// open decrypts payload (BlockSize + encryptionOverhead bytes) of block into data (BlockSize bytes).
+// A payload that fails to decrypt returns ErrWrongKey.
+func (c *blockCipher) open(block Block, payload []byte, data []byte) error {
+	ciphertextEnd := len(payload) - counterSize
+	counter := binary.BigEndian.Uint64(payload[ciphertextEnd:])
+	plaintext, err := c.aead.Open(nil, nonce(block, counter), payload[:ciphertextEnd], additionalData(block))
+	if err != nil {
+		return fmt.Errorf("could not decrypt block %v: %w", block, ErrWrongKey)
+	}
+	copy(data, plaintext)
+	return nil
+}
+
+func nonce(block Block, counter uint64) []byte {
+	h := sha256.New()
+	h.Write(additionalData(block))
+	binary.Write(h, binary.BigEndian, counter)
+	return h.Sum(nil)[:12]
+}
+
+func additionalData(block Block) []byte {
+	b := []byte(block.Filename)
+	return binary.BigEndian.AppendUint64(b, uint64(block.Number))
+}
+
+// verifyKey checks that the key given to FileMgr (if any) matches the key the DB was created with.
+// The keyCheckFile is created for a new encrypted DB.
+func (f *FileMgr) verifyKey() error {
+	blockCount, err := f.storage.BlockCount(keyCheckFile)
+	if err != nil {
+		return err
+	}
+	block := GetBlock(keyCheckFile, 0)
+
+	if f.cipher == nil {
+		if blockCount > 0 {
+			return ErrKeyRequired
+		}
+		return nil
+	}
+
+	page := NewPageWithSize(f.BlockSize)
+	if blockCount == 0 {
+		if !f.IsNew {
+			return ErrNotEncrypted
+		}
+		_, err = f.Append(keyCheckFile)
+		if err != nil {
+			return err
+		}
+		err = page.SetString(0, keyCheckText)
+		if err != nil {
+			return err
+		}
+		return f.Write(block, page)
+	}
+
+	err = f.Read(block, page)
+	if err != nil {
+		return err
+	}
+	text, err := page.GetString(0)
+	if err != nil || text != keyCheckText {
+		return ErrWrongKey
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package file
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+var encryptionTestDir = "temp_encryption_dir"
+
+func removeEncryptionTestDir(fileMgr *FileMgr) {
+	os.Remove(fileMgr.DbFilePath(tempFileName))
+	os.Remove(fileMgr.DbFilePath(keyCheckFile))
+	os.Remove(fileMgr.DbFilePath(LockFile))
+	os.Remove(fileMgr.DbDir)
+}
+
+func TestEncryptedReadWrite(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+	fileMgr, err := NewFileMgr(encryptionTestDir, blockTestSize, WithEncryptionKey(key))
+	assert.NoError(t, err)
+	defer removeEncryptionTestDir(fileMgr)
+
+	block, err := fileMgr.Append(tempFileName)
+	assert.NoError(t, err)
+	text := "customer data"
+	page := NewPageWithSize(blockTestSize)
+	page.SetString(0, text)
+	assert.NoError(t, fileMgr.Write(block, page))
+
+	// the contents of the file on disk are not readable
+	raw, err := os.ReadFile(fileMgr.DbFilePath(tempFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, fileMgr.FrameSize(), int64(len(raw)))
+	assert.False(t, bytes.Contains(raw, []byte(text)))
+
+	// writing the same page again produces a different ciphertext since the nonce is different
+	assert.NoError(t, fileMgr.Write(block, page))
+	raw2, _ := os.ReadFile(fileMgr.DbFilePath(tempFileName))
+	assert.NotEqual(t, raw, raw2)
+
+	readPage := NewPageWithSize(blockTestSize)
+	assert.NoError(t, fileMgr.Read(block, readPage))
+	actual, _ := readPage.GetString(0)
+	assert.Equal(t, text, actual)
+
+	// a block copied to another position in the file can not be decrypted
+	newBlock, _ := fileMgr.Append(tempFileName)
+	f, _ := os.OpenFile(fileMgr.DbFilePath(tempFileName), os.O_RDWR, filePermission)
+	f.WriteAt(raw2, newBlock.Number*fileMgr.FrameSize())
+	f.Close()
+	assert.ErrorIs(t, fileMgr.Read(newBlock, readPage), ErrWrongKey)
+	assert.NoError(t, fileMgr.Close())
+
+	// reopen the DB with the right key
+	fileMgr, err = NewFileMgr(encryptionTestDir, blockTestSize, WithEncryptionKey(key))
+	assert.NoError(t, err)
+	assert.NoError(t, fileMgr.Read(block, readPage))
+	actual, _ = readPage.GetString(0)
+	assert.Equal(t, text, actual)
+	fileMgr.Close()
+}
+
+func TestOpenWithWrongKey(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 16)
+	fileMgr, err := NewFileMgr(encryptionTestDir, blockTestSize, WithEncryptionKey(key))
+	assert.NoError(t, err)
+	defer removeEncryptionTestDir(fileMgr)
+	fileMgr.Close()
+
+	_, err = NewFileMgr(encryptionTestDir, blockTestSize, WithEncryptionKey(bytes.Repeat([]byte("x"), 16)))
+	assert.ErrorIs(t, err, ErrWrongKey)
+
+	_, err = NewFileMgr(encryptionTestDir, blockTestSize)
+	assert.ErrorIs(t, err, ErrKeyRequired)
+
+	_, err = NewFileMgr(encryptionTestDir, blockTestSize, WithEncryptionKey([]byte("short key")))
+	assert.Error(t, err)
+}
+
+func TestOpenUnencryptedWithKey(t *testing.T) {
+	fileMgr, err := NewFileMgr(encryptionTestDir, blockTestSize)
+	assert.NoError(t, err)
+	defer removeEncryptionTestDir(fileMgr)
+	_, err = fileMgr.Append(tempFileName)
+	assert.NoError(t, err)
+	fileMgr.Close()
+
+	_, err = NewFileMgr(encryptionTestDir, blockTestSize, WithEncryptionKey(bytes.Repeat([]byte("k"), 16)))
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+}
+
+func TestEncryptEmptyDir(t *testing.T) {
+	// a directory that exists but holds no files is a new DB, which can be encrypted
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte("k"), 16)
+	fileMgr, err := NewFileMgr(dir, blockTestSize, WithEncryptionKey(key))
+	assert.NoError(t, err)
+	assert.True(t, fileMgr.IsNew)
+	_, err = fileMgr.Append(tempFileName)
+	assert.NoError(t, err)
+	assert.NoError(t, fileMgr.Close())
+
+	fileMgr, err = NewFileMgr(dir, blockTestSize, WithEncryptionKey(key))
+	assert.NoError(t, err)
+	assert.False(t, fileMgr.IsNew)
+	assert.NoError(t, fileMgr.Close())
+	_, err = NewFileMgr(dir, blockTestSize)
+	assert.ErrorIs(t, err, ErrKeyRequired)
+}
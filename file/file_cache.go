@@ -0,0 +1,143 @@
+package file
+
+import (
+	"container/list"
+	"errors"
+	"github.com/sasha-s/go-deadlock"
+	"os"
+)
+
+const defaultMaxOpenFiles = 64
+
+// fileCache keeps a bounded number of files open,
+// so that FileMgr does not have to open and close a file every time a block is read or written.
+//
+// When the cache is full, the Least Recently Used file is evicted.
+// A file may be evicted while a reader/writer is still using it,
+// in which case the file is closed only after the last user releases it.
+type fileCache struct {
+	mu       deadlock.Mutex
+	capacity int
+	files    map[string]*openFile
+
+	// readOnly files are opened for reading only
+	readOnly bool
+
+	// lru holds the cached files, the most recently used file is at the front of the list
+	lru *list.List
+}
+
+// openFile is an *os.File shared by all clients of the fileCache.
+// refs is the number of clients currently using the file.
+type openFile struct {
+	*os.File
+	path    string
+	refs    int
+	evicted bool
+	elem    *list.Element
+}
+
+func newFileCache(capacity int) *fileCache {
+	return &fileCache{
+		capacity: capacity,
+		files:    make(map[string]*openFile),
+		lru:      list.New(),
+	}
+}
+
+// acquire returns an open file for path, opening it if it is not already cached.
+// If create is true a missing file is created, otherwise opening a missing file fails.
+// Every call to acquire must be followed by a call to release once the file is no longer used.
+func (c *fileCache) acquire(path string, create bool) (*openFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f, ok := c.files[path]; ok {
+		c.lru.MoveToFront(f.elem)
+		f.refs++
+		return f, nil
+	}
+
+	flag := os.O_RDWR
+	if c.readOnly {
+		flag = os.O_RDONLY
+	}
+	if create {
+		flag |= os.O_CREATE
+	}
+	osFile, err := os.OpenFile(path, flag, filePermission)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &openFile{
+		File: osFile,
+		path: path,
+		refs: 1,
+	}
+	f.elem = c.lru.PushFront(f)
+	c.files[path] = f
+	c.evict()
+	return f, nil
+}
+
+// release is called when a client is done using f.
+// An evicted file is closed when its last client releases it.
+func (c *fileCache) release(f *openFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f.refs--
+	if f.evicted && f.refs == 0 {
+		f.Close()
+	}
+}
+
+// evict removes the least recently used files until the cache is within its capacity.
+func (c *fileCache) evict() {
+	for c.lru.Len() > c.capacity {
+		f := c.lru.Remove(c.lru.Back()).(*openFile)
+		delete(c.files, f.path)
+		f.evicted = true
+		if f.refs == 0 {
+			f.Close()
+		}
+	}
+}
+
+// remove evicts the file with the given path from the cache, if present.
+func (c *fileCache) remove(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.files[path]
+	if !ok {
+		return
+	}
+	c.lru.Remove(f.elem)
+	delete(c.files, path)
+	f.evicted = true
+	if f.refs == 0 {
+		f.Close()
+	}
+}
+
+// closeAll evicts all files from the cache.
+// Files still in use are closed when they are released.
+func (c *fileCache) closeAll() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for c.lru.Len() > 0 {
+		f := c.lru.Remove(c.lru.Back()).(*openFile)
+		delete(c.files, f.path)
+		f.evicted = true
+		if f.refs == 0 {
+			if err := f.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -2,127 +2,276 @@ package file
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
-	"github.com/sasha-s/go-deadlock"
-	"log"
-	"os"
 	"path/filepath"
+	"slices"
+	"time"
 )
 
 // Files are conceptually divided into blocks of equal blockSize.
-// Each block in a file starts at offset - (Block.Number * FileMgr.BlockSize)
+// On disk each block is stored as a frame of FrameSize bytes
+// (block data, encrypted if an encryption key is used, followed by its checksum)
+// Each block in a file starts at offset - (Block.Number * FileMgr.FrameSize())
 
 const dirPermission = 0777
 const filePermission = 0666
 
 // FileMgr handles Read from file Block to memory(Page)
 // and Write from memory(Page) to a file Block
+//
+// The blocks are kept in a Storage, which is the OS filesystem (files in DbDir),
+// or memory if DbDir is MemoryDir.
 type FileMgr struct {
-	mu        deadlock.Mutex
 	DbDir     string
 	BlockSize int64
-	IsNew     bool
+	// IsNew is true if DbDir did not exist or held no files when the FileMgr was created
+	IsNew   bool
+	storage Storage
+
+	// Durability decides when file contents are synced to stable storage
+	Durability Durability
+
+	// cipher encrypts blocks at rest, it is nil if no encryption key is used
+	encryptionKey []byte
+	cipher        *blockCipher
+
+	// stats counts the I/O operations on each file, see Stats
+	stats *ioStats
+
+	// readOnly is set by WithReadOnly
+	readOnly bool
 }
 
-func NewFileMgr(dbDir string, blockSize int64) *FileMgr {
+// NewFileMgr creates a FileMgr for the files in dbDir, the directory is created if it does not exist.
+// The directory is locked (see LockFile) until the FileMgr is closed,
+// NewFileMgr fails with ErrDirLocked if another process is using the directory.
+// With WithReadOnly, the directory must exist and is not locked.
+// If dbDir is MemoryDir, the files are kept in memory and are lost when the FileMgr is closed.
+// If an encryption key is given, it must match the key the DB was created with.
+func NewFileMgr(dbDir string, blockSize int64, opts ...Option) (*FileMgr, error) {
 	fileMgr := &FileMgr{
 		DbDir:     dbDir,
 		BlockSize: blockSize,
-		IsNew:     !pathExists(dbDir),
+		stats:     newIOStats(),
+	}
+	for _, opt := range opts {
+		opt(fileMgr)
+	}
+
+	if fileMgr.encryptionKey != nil {
+		blockCipher, err := newBlockCipher(fileMgr.encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		fileMgr.cipher = blockCipher
 	}
 
-	if fileMgr.IsNew {
-		err := os.Mkdir(dbDir, dirPermission)
+	if dbDir == MemoryDir {
+		fileMgr.IsNew = true
+		fileMgr.storage = newMemStorage(fileMgr.FrameSize())
+	} else if fileMgr.readOnly {
+		storage, err := newReadOnlyOSStorage(dbDir, fileMgr.FrameSize())
 		if err != nil {
-			panic("Could not create DB directory")
+			return nil, err
 		}
+		fileMgr.storage = storage
+	} else {
+		storage, err := newOSStorage(dbDir, fileMgr.FrameSize(), fileMgr.Durability != SyncNever)
+		if err != nil {
+			return nil, err
+		}
+		fileMgr.storage = storage
+		// an empty directory (for example created for a restore) is a new DB too
+		filenames, err := storage.List()
+		if err != nil {
+			storage.Close()
+			return nil, err
+		}
+		fileMgr.IsNew = len(filenames) == 0
 	}
 
-	// TODO
-	return fileMgr
+	if fileMgr.readOnly {
+		fileMgr.storage = readOnlyStorage{fileMgr.storage}
+	}
+
+	err := fileMgr.verifyKey()
+	if err != nil {
+		fileMgr.Close()
+		return nil, err
+	}
+	return fileMgr, nil
 }
 
 // Read a block from file to Page(memory)
+// If the checksum of the block does not match its data, a CorruptBlockError is returned.
+// The (corrupt) block data is still copied to the page so that callers can inspect it.
+// An encrypted block that cannot be decrypted returns ErrWrongKey.
 func (f *FileMgr) Read(block Block, page *Page) error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	file, err := os.Open(f.DbFilePath(block.Filename))
+	frame := make([]byte, f.FrameSize())
+	start := time.Now()
+	err := f.storage.Read(block, frame)
 	if err != nil {
-		return err
+		return fmt.Errorf("could not read block %v, %w", block, err)
 	}
-	defer file.Close()
+	f.stats.recordRead(block.Filename, int64(len(frame)), start)
 
-	_, err = file.ReadAt(page.Buffer, block.Number*f.BlockSize)
-	if err != nil {
-		return fmt.Errorf("could not read block %v, %v", block, err)
+	err = verifyChecksum(block, frame)
+	if err != nil || f.cipher == nil || isZero(frame) {
+		copy(page.Buffer, frame[:f.BlockSize])
+		return err
 	}
-	return nil
+	return f.cipher.open(block, frame[:len(frame)-checksumSize], page.Buffer)
 }
 
 // Write a Page(memory) to a block in file
 func (f *FileMgr) Write(block Block, page *Page) error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	path := f.DbFilePath(block.Filename)
-	file, err := os.OpenFile(path, os.O_RDWR, filePermission)
+	frame := make([]byte, f.FrameSize())
+	f.encodeFrame(block, page, frame)
+	start := time.Now()
+	err := f.storage.Write(block, frame)
 	if err != nil {
-		return err
+		return fmt.Errorf("could not write to block %v, %w", block, err)
 	}
-	defer file.Close()
+	f.stats.recordWrite(block.Filename, 1, int64(len(frame)), start)
 
-	_, err = file.WriteAt(page.Buffer, block.Number*f.BlockSize)
-	if err != nil {
-		return fmt.Errorf("could not write to block %v, %v", block, err)
+	if f.Durability == SyncEveryWrite {
+		return f.sync(block.Filename)
 	}
-	// TODO file.Sync() ??
 	return nil
 }
 
-// Append empty bytes of size f.BlockSize to file
+// encodeFrame fills frame with the page data (encrypted if a cipher is set) followed by its checksum
+func (f *FileMgr) encodeFrame(block Block, page *Page, frame []byte) {
+	if f.cipher != nil {
+		data := page.Buffer
+		if int64(len(data)) != f.BlockSize {
+			data = make([]byte, f.BlockSize)
+			copy(data, page.Buffer)
+		}
+		f.cipher.seal(block, data, frame[:len(frame)-checksumSize])
+	} else {
+		copy(frame[:f.BlockSize], page.Buffer)
+	}
+	setChecksum(frame)
+}
+
+// Append empty bytes of size f.FrameSize() to file
 // and create a new block that corresponds to the bytes appended to file
 func (f *FileMgr) Append(filename string) (Block, error) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	newBlockNum := f.BlockCount(filename)
-	block := GetBlock(filename, newBlockNum)
-	b := bytes.Repeat([]byte{byte(0)}, int(f.BlockSize))
-
-	file, err := os.OpenFile(f.DbFilePath(filename), os.O_APPEND|os.O_WRONLY|os.O_CREATE, filePermission)
+	b := bytes.Repeat([]byte{byte(0)}, int(f.FrameSize()))
+	start := time.Now()
+	block, err := f.storage.Append(filename, b)
 	if err != nil {
 		return Block{}, err
 	}
-	defer file.Close()
+	f.stats.recordAppend(filename, int64(len(b)), start)
+
+	if f.Durability == SyncEveryWrite {
+		err = f.sync(filename)
+		if err != nil {
+			return Block{}, err
+		}
+	}
+	return block, nil
+}
 
-	_, err = file.Write(b)
+// Sync flushes the contents of the file to stable storage.
+// Sync is a no-op unless Durability is SyncOnFlush,
+// with SyncEveryWrite the file is already synced after every write.
+func (f *FileMgr) Sync(filename string) error {
+	if f.Durability != SyncOnFlush {
+		return nil
+	}
+	return f.sync(filename)
+}
+
+func (f *FileMgr) sync(filename string) error {
+	start := time.Now()
+	err := f.storage.Sync(filename)
 	if err != nil {
-		return Block{}, err
+		return err
 	}
+	f.stats.recordSync(filename, start)
+	return nil
+}
 
-	return block, nil
+// BlockCount returns the number of blocks in the file, a missing file has 0 blocks.
+func (f *FileMgr) BlockCount(filename string) (int64, error) {
+	blockCount, err := f.storage.BlockCount(filename)
+	if err != nil {
+		return 0, fmt.Errorf("could not get block count of %v, %w", filename, err)
+	}
+	return blockCount, nil
 }
 
-func (f *FileMgr) BlockCount(filename string) int64 {
-	path := f.DbFilePath(filename)
+// Exists reports whether the file exists
+func (f *FileMgr) Exists(filename string) (bool, error) {
+	return f.storage.Exists(filename)
+}
 
-	fileInfo, err := os.Stat(path)
-	if errors.Is(err, os.ErrNotExist) {
-		if _, err := os.Create(path); err != nil {
-			log.Fatalf("Failed to create file %v, %v\n", path, err)
-		}
-		return 0
+// Create creates an empty file if it does not already exist
+func (f *FileMgr) Create(filename string) error {
+	err := f.storage.Create(filename)
+	if err != nil {
+		return fmt.Errorf("could not create file %v, %w", filename, err)
+	}
+	return nil
+}
+
+// Truncate shrinks the file to blockCount blocks, the blocks after that are discarded
+func (f *FileMgr) Truncate(filename string, blockCount int64) error {
+	err := f.storage.Truncate(filename, blockCount)
+	if err != nil {
+		return fmt.Errorf("could not truncate file %v to %v blocks, %w", filename, blockCount, err)
 	}
+	if f.Durability == SyncEveryWrite {
+		return f.sync(filename)
+	}
+	return nil
+}
+
+// Delete removes the file from storage
+func (f *FileMgr) Delete(filename string) error {
+	return f.storage.Delete(filename)
+}
+
+// List returns the names of all the files in the DB directory, sorted by name.
+// The key check file of an encrypted DB is not listed, every FileMgr opened with a key writes its own.
+func (f *FileMgr) List() ([]string, error) {
+	filenames, err := f.storage.List()
 	if err != nil {
-		log.Fatalf("Failed to get BlockCount for %v, %v\n", filename, err)
+		return nil, fmt.Errorf("could not list files of %v, %w", f.DbDir, err)
 	}
-	return fileInfo.Size() / f.BlockSize
+	return slices.DeleteFunc(filenames, func(filename string) bool {
+		return filename == keyCheckFile
+	}), nil
 }
 
-func (f *FileMgr) DbFilePath(filename string) string {
-	return filepath.Join(f.DbDir, filename)
+// FrameSize is the number of bytes used on disk to store a block
+func (f *FileMgr) FrameSize() int64 {
+	if f.cipher != nil {
+		return f.BlockSize + encryptionOverhead + checksumSize
+	}
+	return f.BlockSize + checksumSize
 }
 
-func pathExists(path string) bool {
-	_, err := os.Stat(path)
-	return !errors.Is(err, os.ErrNotExist)
+// Close closes all the files opened by FileMgr and unlocks the DB directory.
+// FileMgr must not be used after Close.
+func (f *FileMgr) Close() error {
+	return f.storage.Close()
+}
+
+// Stats returns a snapshot of the I/O statistics of each file, collected since the FileMgr was created
+// or since the last call to ResetStats.
+func (f *FileMgr) Stats() Stats {
+	return f.stats.snapshot()
+}
+
+// ResetStats clears the I/O statistics of all files
+func (f *FileMgr) ResetStats() {
+	f.stats.reset()
+}
+
+func (f *FileMgr) DbFilePath(filename string) string {
+	return filepath.Join(f.DbDir, filename)
 }
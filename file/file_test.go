@@ -5,6 +5,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"log"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -13,28 +15,34 @@ const blockTestSize = 100
 var tempFileName = "temp_file"
 
 // createFile creates file temp_dir/filename
-// and populates file with 100 bytes each of a, b, c
+// and populates the first 3 blocks of the file with 100 bytes each of a, b, c
 func createFile(filename string) (*os.File, *FileMgr) {
-	fileMgr := NewFileMgr("temp_dir", blockTestSize)
+	fileMgr, err := NewFileMgr("temp_dir", blockTestSize)
+	if err != nil {
+		log.Fatal(err)
+	}
 	file, err := os.Create(fileMgr.DbFilePath(filename))
 	if err != nil {
 		log.Fatal(err)
 	}
 	chars := []byte("abc")
-	for _, c := range chars {
-		file.Write(bytes.Repeat([]byte{c}, blockTestSize))
+	for i, c := range chars {
+		page := NewPageWithBytes(bytes.Repeat([]byte{c}, blockTestSize))
+		fileMgr.Write(GetBlock(filename, int64(i)), page)
 	}
 	return file, fileMgr
 }
 
 func removeFile(filename string, dbDir string) {
 	os.Remove(filename)
+	os.Remove(filepath.Join(dbDir, LockFile))
 	os.Remove(dbDir)
 }
 
 func TestFileRead(t *testing.T) {
 	file, fileMgr := createFile(tempFileName)
 	defer removeFile(file.Name(), fileMgr.DbDir)
+	defer fileMgr.Close()
 
 	tests := []struct {
 		blockNum int64
@@ -60,6 +68,7 @@ func TestFileRead(t *testing.T) {
 func TestFileWrite(t *testing.T) {
 	file, fileMgr := createFile(tempFileName)
 	defer removeFile(file.Name(), fileMgr.DbDir)
+	defer fileMgr.Close()
 
 	// intially 2nd file block has 100 bytes of "b", Overwrite with 100 bytes of "o" and verify if its changed
 	block := GetBlock(tempFileName, 1)
@@ -68,28 +77,261 @@ func TestFileWrite(t *testing.T) {
 	fileMgr.Write(block, page)
 
 	actual := make([]byte, 100)
-	file.ReadAt(actual, 1*blockTestSize)
+	file.ReadAt(actual, 1*fileMgr.FrameSize())
 	assert.Equal(t, string(expected), string(actual))
 }
 
 func TestFileAppend(t *testing.T) {
 	file, fileMgr := createFile(tempFileName)
 	defer removeFile(file.Name(), fileMgr.DbDir)
+	defer fileMgr.Close()
 
-	initialBlockCount := fileMgr.BlockCount(tempFileName)
+	initialBlockCount, err := fileMgr.BlockCount(tempFileName)
+	assert.NoError(t, err)
 	fileMgr.Append(tempFileName)
 	expectedBlockCount := initialBlockCount + 1
-	actualBlockCount := fileMgr.BlockCount(tempFileName)
+	actualBlockCount, err := fileMgr.BlockCount(tempFileName)
+	assert.NoError(t, err)
 	assert.Equal(t, expectedBlockCount, actualBlockCount)
 }
 
 func TestBlockCount(t *testing.T) {
 	file, fileMgr := createFile(tempFileName)
 	defer removeFile(file.Name(), fileMgr.DbDir)
+	defer fileMgr.Close()
 
-	assert.Equal(t, int64(3), fileMgr.BlockCount(tempFileName))
+	blockCount, err := fileMgr.BlockCount(tempFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), blockCount)
 
+	// BlockCount of a missing file is 0, and the file is not created
 	newTempFile := "new_temp_file"
-	assert.Equal(t, int64(0), fileMgr.BlockCount(newTempFile))
-	os.Remove(fileMgr.DbFilePath(newTempFile))
+	blockCount, err = fileMgr.BlockCount(newTempFile)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), blockCount)
+	exists, err := fileMgr.Exists(newTempFile)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestSync(t *testing.T) {
+	file, fileMgr := createFile(tempFileName)
+	defer removeFile(file.Name(), fileMgr.DbDir)
+	assert.NoError(t, fileMgr.Close())
+
+	missingFile := "missing_file"
+	tests := []struct {
+		durability Durability
+		syncErr    bool
+	}{
+		{SyncOnFlush, true},
+		{SyncEveryWrite, false},
+		{SyncNever, false},
+	}
+
+	for _, tt := range tests {
+		fileMgr, err := NewFileMgr(fileMgr.DbDir, blockTestSize, WithDurability(tt.durability))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.durability, fileMgr.Durability)
+
+		block := GetBlock(tempFileName, 0)
+		expected := bytes.Repeat([]byte("s"), blockTestSize)
+		assert.NoError(t, fileMgr.Write(block, NewPageWithBytes(expected)))
+		assert.NoError(t, fileMgr.Sync(tempFileName))
+
+		// only SyncOnFlush actually opens the file to sync it
+		err = fileMgr.Sync(missingFile)
+		assert.Equal(t, tt.syncErr, err != nil)
+
+		page := NewPageWithSize(blockTestSize)
+		assert.NoError(t, fileMgr.Read(block, page))
+		assert.Equal(t, expected, page.Buffer)
+		fileMgr.Close()
+	}
+}
+
+func TestDirLock(t *testing.T) {
+	file, fileMgr := createFile(tempFileName)
+	defer removeFile(file.Name(), fileMgr.DbDir)
+
+	// the directory can not be opened again while it is in use
+	_, err := NewFileMgr(fileMgr.DbDir, blockTestSize)
+	assert.ErrorIs(t, err, ErrDirLocked)
+
+	// the lock is released when the FileMgr is closed
+	assert.NoError(t, fileMgr.Close())
+	fileMgr, err = NewFileMgr(fileMgr.DbDir, blockTestSize)
+	assert.NoError(t, err)
+	assert.NoError(t, fileMgr.Close())
+
+	// memory storage has no directory to lock
+	memFileMgr1, err := NewFileMgr(MemoryDir, blockTestSize)
+	assert.NoError(t, err)
+	memFileMgr2, err := NewFileMgr(MemoryDir, blockTestSize)
+	assert.NoError(t, err)
+	memFileMgr1.Close()
+	memFileMgr2.Close()
+}
+
+func TestReadOnly(t *testing.T) {
+	file, fileMgr := createFile(tempFileName)
+	defer removeFile(file.Name(), fileMgr.DbDir)
+	defer fileMgr.Close()
+
+	// a read-only FileMgr does not lock the directory, so it can be opened while the directory is in use
+	readOnly, err := NewFileMgr(fileMgr.DbDir, blockTestSize, WithReadOnly())
+	assert.NoError(t, err)
+	defer readOnly.Close()
+	assert.True(t, readOnly.ReadOnly())
+	assert.False(t, fileMgr.ReadOnly())
+
+	page := NewPageWithSize(blockTestSize)
+	assert.NoError(t, readOnly.Read(GetBlock(tempFileName, 1), page))
+	assert.Equal(t, bytes.Repeat([]byte("b"), blockTestSize), page.Buffer)
+	filenames, err := readOnly.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tempFileName}, filenames)
+
+	assert.ErrorIs(t, readOnly.Write(GetBlock(tempFileName, 1), page), ErrReadOnly)
+	_, err = readOnly.Append(tempFileName)
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.ErrorIs(t, readOnly.Truncate(tempFileName, 1), ErrReadOnly)
+	assert.ErrorIs(t, readOnly.Delete(tempFileName), ErrReadOnly)
+	assert.ErrorIs(t, readOnly.Create("new_file"), ErrReadOnly)
+	count, _ := readOnly.BlockCount(tempFileName)
+	assert.Equal(t, int64(3), count)
+
+	// the directory of a read-only FileMgr must exist
+	_, err = NewFileMgr("missing_dir", blockTestSize, WithReadOnly())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.False(t, pathExists("missing_dir"))
+}
+
+func TestCopyFile(t *testing.T) {
+	file, fileMgr := createFile(tempFileName)
+	defer removeFile(file.Name(), fileMgr.DbDir)
+	defer fileMgr.Close()
+
+	dst, err := NewFileMgr(MemoryDir, blockTestSize, WithEncryptionKey(bytes.Repeat([]byte("k"), 32)))
+	assert.NoError(t, err)
+	defer dst.Close()
+
+	// the copy replaces the blocks of an existing file
+	for i := 0; i < 5; i++ {
+		_, err = dst.Append(tempFileName)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, CopyFile(fileMgr, dst, tempFileName))
+	count, err := dst.BlockCount(tempFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	page := NewPageWithSize(blockTestSize)
+	for i, c := range []byte("abc") {
+		assert.NoError(t, dst.Read(GetBlock(tempFileName, int64(i)), page))
+		assert.Equal(t, bytes.Repeat([]byte{c}, blockTestSize), page.Buffer)
+	}
+
+	other, err := NewFileMgr(MemoryDir, 2*blockTestSize)
+	assert.NoError(t, err)
+	defer other.Close()
+	assert.Error(t, CopyFile(fileMgr, other, tempFileName))
+}
+
+func TestCorruptBlock(t *testing.T) {
+	file, fileMgr := createFile(tempFileName)
+	defer removeFile(file.Name(), fileMgr.DbDir)
+	defer fileMgr.Close()
+
+	// a block that was appended but never written is not corrupt
+	block, err := fileMgr.Append(tempFileName)
+	assert.NoError(t, err)
+	page := NewPageWithSize(blockTestSize)
+	assert.NoError(t, fileMgr.Read(block, page))
+	assert.Equal(t, make([]byte, blockTestSize), page.Buffer)
+
+	// flip a bit in the 2nd block
+	offset := 1*fileMgr.FrameSize() + 10
+	b := make([]byte, 1)
+	file.ReadAt(b, offset)
+	b[0] ^= 1
+	file.WriteAt(b, offset)
+
+	err = fileMgr.Read(GetBlock(tempFileName, 0), page)
+	assert.NoError(t, err)
+
+	block = GetBlock(tempFileName, 1)
+	err = fileMgr.Read(block, page)
+	assert.ErrorIs(t, err, ErrCorruptBlock)
+	var corruptErr *CorruptBlockError
+	assert.ErrorAs(t, err, &corruptErr)
+	assert.Equal(t, block, corruptErr.Block)
+
+	// once the block is written again, it can be read without errors
+	assert.NoError(t, fileMgr.Write(block, NewPageWithBytes(bytes.Repeat([]byte("b"), blockTestSize))))
+	assert.NoError(t, fileMgr.Read(block, page))
+}
+
+func TestFileHandleCache(t *testing.T) {
+	fileMgr, err := NewFileMgr("temp_dir", blockTestSize)
+	assert.NoError(t, err)
+	files := newFileCache(2)
+	fileMgr.storage.(*osStorage).files = files
+	filenames := []string{"temp_file1", "temp_file2", "temp_file3"}
+	defer func() {
+		fileMgr.Close()
+		for _, filename := range filenames {
+			os.Remove(fileMgr.DbFilePath(filename))
+		}
+		os.Remove(filepath.Join(fileMgr.DbDir, LockFile))
+		os.Remove(fileMgr.DbDir)
+	}()
+
+	for _, filename := range filenames {
+		_, err := fileMgr.Append(filename)
+		assert.NoError(t, err)
+	}
+
+	// only the 2 most recently used files are kept open
+	assert.Equal(t, 2, files.lru.Len())
+	assert.NotContains(t, files.files, fileMgr.DbFilePath(filenames[0]))
+	assert.Contains(t, files.files, fileMgr.DbFilePath(filenames[1]))
+	assert.Contains(t, files.files, fileMgr.DbFilePath(filenames[2]))
+
+	// an evicted file is opened again when it is accessed
+	expected := bytes.Repeat([]byte("x"), blockTestSize)
+	block := GetBlock(filenames[0], 0)
+	assert.NoError(t, fileMgr.Write(block, NewPageWithBytes(expected)))
+	page := NewPageWithSize(blockTestSize)
+	assert.NoError(t, fileMgr.Read(block, page))
+	assert.Equal(t, expected, page.Buffer)
+	assert.Contains(t, files.files, fileMgr.DbFilePath(filenames[0]))
+	assert.NotContains(t, files.files, fileMgr.DbFilePath(filenames[1]))
+
+	assert.NoError(t, fileMgr.Close())
+	assert.Equal(t, 0, files.lru.Len())
+}
+
+func TestConcurrentReadWrite(t *testing.T) {
+	file, fileMgr := createFile(tempFileName)
+	defer removeFile(file.Name(), fileMgr.DbDir)
+	defer fileMgr.Close()
+
+	// each goroutine repeatedly writes and reads back its own block
+	chars := []byte("xyz")
+	wg := sync.WaitGroup{}
+	for i, c := range chars {
+		wg.Add(1)
+		go func(blockNum int64, c byte) {
+			defer wg.Done()
+			block := GetBlock(tempFileName, blockNum)
+			expected := bytes.Repeat([]byte{c}, blockTestSize)
+			page := NewPageWithSize(blockTestSize)
+			for j := 0; j < 100; j++ {
+				assert.NoError(t, fileMgr.Write(block, NewPageWithBytes(expected)))
+				assert.NoError(t, fileMgr.Read(block, page))
+				assert.Equal(t, expected, page.Buffer)
+			}
+		}(int64(i), c)
+	}
+	wg.Wait()
 }
@@ -0,0 +1,145 @@
+package file
+
+import (
+	"fmt"
+	"github.com/sasha-s/go-deadlock"
+	"io"
+	"os"
+	"slices"
+)
+
+// memStorage keeps every file as a byte slice in memory.
+// It is used for databases that do not need to outlive the process, such as unit tests and caches.
+type memStorage struct {
+	mu        deadlock.RWMutex
+	frameSize int64
+	files     map[string][]byte
+}
+
+func newMemStorage(frameSize int64) *memStorage {
+	return &memStorage{
+		frameSize: frameSize,
+		files:     make(map[string][]byte),
+	}
+}
+
+func (s *memStorage) Read(block Block, b []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.files[block.Filename]
+	if !ok {
+		return fmt.Errorf("open %v: %w", block.Filename, os.ErrNotExist)
+	}
+	offset := block.Number * s.frameSize
+	if offset < 0 || offset+int64(len(b)) > int64(len(data)) {
+		return io.EOF
+	}
+	copy(b, data[offset:])
+	return nil
+}
+
+// Write grows the file if b is written past the end of the file
+func (s *memStorage) Write(block Block, b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.files[block.Filename]
+	if !ok {
+		return fmt.Errorf("open %v: %w", block.Filename, os.ErrNotExist)
+	}
+	offset := block.Number * s.frameSize
+	if offset < 0 {
+		return fmt.Errorf("negative offset %v", offset)
+	}
+	end := offset + int64(len(b))
+	if end > int64(len(data)) {
+		data = append(data, make([]byte, end-int64(len(data)))...)
+	}
+	copy(data[offset:], b)
+	s.files[block.Filename] = data
+	return nil
+}
+
+func (s *memStorage) Append(filename string, b []byte) (Block, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.files[filename]
+	block := GetBlock(filename, int64(len(data))/s.frameSize)
+	s.files[filename] = append(data, b...)
+	return block, nil
+}
+
+func (s *memStorage) BlockCount(filename string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.files[filename])) / s.frameSize, nil
+}
+
+func (s *memStorage) Truncate(filename string, blockCount int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.files[filename]
+	if !ok {
+		return fmt.Errorf("truncate %v: %w", filename, os.ErrNotExist)
+	}
+	size := blockCount * s.frameSize
+	if size < int64(len(data)) {
+		s.files[filename] = data[:size]
+	}
+	return nil
+}
+
+func (s *memStorage) Exists(filename string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.files[filename]
+	return ok, nil
+}
+
+func (s *memStorage) Create(filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[filename]; !ok {
+		s.files[filename] = []byte{}
+	}
+	return nil
+}
+
+func (s *memStorage) Delete(filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[filename]; !ok {
+		return fmt.Errorf("remove %v: %w", filename, os.ErrNotExist)
+	}
+	delete(s.files, filename)
+	return nil
+}
+
+// List returns the names of the files held in memory, sorted by name
+func (s *memStorage) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	filenames := make([]string, 0, len(s.files))
+	for filename := range s.files {
+		filenames = append(filenames, filename)
+	}
+	slices.Sort(filenames)
+	return filenames, nil
+}
+
+// Sync does nothing since memory is not stable storage
+func (s *memStorage) Sync(filename string) error {
+	return nil
+}
+
+// Close discards all files
+func (s *memStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.files)
+	return nil
+}
@@ -0,0 +1,210 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sasha-s/go-deadlock"
+	"os"
+	"path/filepath"
+)
+
+// osStorage stores each file as a file in the directory dir of the OS filesystem.
+//
+// Open files are kept in a fileCache and shared by all clients.
+// Reads and writes are positional (ReadAt / WriteAt) and can run concurrently,
+// only Append is serialized since it depends on the current size of the file.
+type osStorage struct {
+	mu        deadlock.Mutex
+	dir       string
+	frameSize int64
+	files     *fileCache
+	lock      *dirLock
+
+	// syncDir indicates whether the directory is synced after a file is created
+	syncDir bool
+}
+
+// newOSStorage creates the directory dir if it does not exist, and locks it until the storage is closed.
+func newOSStorage(dir string, frameSize int64, syncDir bool) (*osStorage, error) {
+	if !pathExists(dir) {
+		err := os.Mkdir(dir, dirPermission)
+		if err != nil {
+			return nil, fmt.Errorf("could not create DB directory %v: %w", dir, err)
+		}
+	}
+
+	lock, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &osStorage{
+		dir:       dir,
+		frameSize: frameSize,
+		files:     newFileCache(defaultMaxOpenFiles),
+		lock:      lock,
+		syncDir:   syncDir,
+	}, nil
+}
+
+// newReadOnlyOSStorage opens the existing directory dir without locking it, so that the files of a DB
+// can be inspected while another process is using it. The storage must only be used through a readOnlyStorage.
+func newReadOnlyOSStorage(dir string, frameSize int64) (*osStorage, error) {
+	if !pathExists(dir) {
+		return nil, fmt.Errorf("could not open DB directory %v: %w", dir, os.ErrNotExist)
+	}
+
+	files := newFileCache(defaultMaxOpenFiles)
+	files.readOnly = true
+	return &osStorage{
+		dir:       dir,
+		frameSize: frameSize,
+		files:     files,
+	}, nil
+}
+
+func (s *osStorage) Read(block Block, b []byte) error {
+	file, err := s.files.acquire(s.path(block.Filename), false)
+	if err != nil {
+		return err
+	}
+	defer s.files.release(file)
+
+	_, err = file.ReadAt(b, block.Number*s.frameSize)
+	return err
+}
+
+func (s *osStorage) Write(block Block, b []byte) error {
+	file, err := s.files.acquire(s.path(block.Filename), false)
+	if err != nil {
+		return err
+	}
+	defer s.files.release(file)
+
+	_, err = file.WriteAt(b, block.Number*s.frameSize)
+	return err
+}
+
+func (s *osStorage) Append(filename string, b []byte) (Block, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.Create(filename)
+	if err != nil {
+		return Block{}, err
+	}
+	blockCount, err := s.BlockCount(filename)
+	if err != nil {
+		return Block{}, err
+	}
+
+	block := GetBlock(filename, blockCount)
+	err = s.Write(block, b)
+	if err != nil {
+		return Block{}, err
+	}
+	return block, nil
+}
+
+func (s *osStorage) BlockCount(filename string) (int64, error) {
+	fileInfo, err := os.Stat(s.path(filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fileInfo.Size() / s.frameSize, nil
+}
+
+func (s *osStorage) Truncate(filename string, blockCount int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.files.acquire(s.path(filename), false)
+	if err != nil {
+		return err
+	}
+	defer s.files.release(file)
+	return file.Truncate(blockCount * s.frameSize)
+}
+
+func (s *osStorage) Exists(filename string) (bool, error) {
+	_, err := os.Stat(s.path(filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Create creates the file and syncs the directory so that the new file survives a crash
+func (s *osStorage) Create(filename string) error {
+	path := s.path(filename)
+	if pathExists(path) {
+		return nil
+	}
+
+	file, err := s.files.acquire(path, true)
+	if err != nil {
+		return err
+	}
+	s.files.release(file)
+
+	if !s.syncDir {
+		return nil
+	}
+	dir, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func (s *osStorage) Delete(filename string) error {
+	path := s.path(filename)
+	s.files.remove(path)
+	return os.Remove(path)
+}
+
+// List skips directories and the lock file of the directory
+func (s *osStorage) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var filenames []string
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == LockFile {
+			continue
+		}
+		filenames = append(filenames, entry.Name())
+	}
+	return filenames, nil
+}
+
+func (s *osStorage) Sync(filename string) error {
+	file, err := s.files.acquire(s.path(filename), false)
+	if err != nil {
+		return err
+	}
+	defer s.files.release(file)
+	return file.Sync()
+}
+
+// Close closes all the files opened by the storage and unlocks the directory
+func (s *osStorage) Close() error {
+	if s.lock == nil {
+		return s.files.closeAll()
+	}
+	return errors.Join(s.files.closeAll(), s.lock.unlock())
+}
+
+func (s *osStorage) path(filename string) string {
+	return filepath.Join(s.dir, filename)
+}
+
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
@@ -4,9 +4,20 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"math"
+	"time"
 )
 
-const IntSize = 8
+// Number of bytes used to store each fixed size type in a Page
+const (
+	IntSize     = 8
+	Int32Size   = 4
+	Int16Size   = 2
+	BoolSize    = 1
+	Float64Size = 8
+	UUIDSize    = 16
+	TimeSize    = 8
+)
 
 var ErrOutOfBounds = errors.New("offset out of bounds")
 
@@ -18,6 +29,14 @@ var ErrOutOfBounds = errors.New("offset out of bounds")
 // | 8 bytes |
 // +---------+
 //
+// Other fixed size types are stored as below, all numbers are stored in big endian order
+// Int32   - 4 bytes
+// Int16   - 2 bytes
+// Bool    - 1 byte, 1 for true and 0 for false
+// Float64 - 8 bytes, IEEE 754 binary representation
+// UUID    - 16 bytes, stored as is
+// Time    - 8 bytes, microseconds since the Unix epoch (UTC), so sub-microsecond precision is lost
+//
 // bytes- first we store len(bytes) as Int and then append actual bytes
 // string - convert string to bytes and then store it as bytes as given above
 // bytes and string are stored as given below
@@ -76,7 +95,7 @@ func (p *Page) GetBytes(offset int64) ([]byte, error) {
 	}
 	offsetStart := offset + IntSize
 	offsetEnd := offsetStart + length
-	if offsetEnd > p.Size {
+	if length < 0 || offsetEnd > p.Size {
 		return nil, ErrOutOfBounds
 	}
 	return p.Buffer[offsetStart:offsetEnd], nil
@@ -109,6 +128,125 @@ func (p *Page) SetString(offset int64, value string) error {
 	return p.SetBytes(offset, []byte(value))
 }
 
+func (p *Page) GetInt32(offset int64) (int32, error) {
+	b, err := p.slice(offset, Int32Size)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(b)), nil
+}
+
+func (p *Page) SetInt32(offset int64, value int32) error {
+	b, err := p.slice(offset, Int32Size)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(b, uint32(value))
+	return nil
+}
+
+func (p *Page) GetInt16(offset int64) (int16, error) {
+	b, err := p.slice(offset, Int16Size)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(b)), nil
+}
+
+func (p *Page) SetInt16(offset int64, value int16) error {
+	b, err := p.slice(offset, Int16Size)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint16(b, uint16(value))
+	return nil
+}
+
+func (p *Page) GetBool(offset int64) (bool, error) {
+	b, err := p.slice(offset, BoolSize)
+	if err != nil {
+		return false, err
+	}
+	return b[0] != 0, nil
+}
+
+func (p *Page) SetBool(offset int64, value bool) error {
+	b, err := p.slice(offset, BoolSize)
+	if err != nil {
+		return err
+	}
+	b[0] = 0
+	if value {
+		b[0] = 1
+	}
+	return nil
+}
+
+func (p *Page) GetFloat64(offset int64) (float64, error) {
+	b, err := p.slice(offset, Float64Size)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+}
+
+func (p *Page) SetFloat64(offset int64, value float64) error {
+	b, err := p.slice(offset, Float64Size)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint64(b, math.Float64bits(value))
+	return nil
+}
+
+func (p *Page) GetUUID(offset int64) ([UUIDSize]byte, error) {
+	var uuid [UUIDSize]byte
+	b, err := p.slice(offset, UUIDSize)
+	if err != nil {
+		return uuid, err
+	}
+	copy(uuid[:], b)
+	return uuid, nil
+}
+
+func (p *Page) SetUUID(offset int64, value [UUIDSize]byte) error {
+	b, err := p.slice(offset, UUIDSize)
+	if err != nil {
+		return err
+	}
+	copy(b, value[:])
+	return nil
+}
+
+// GetTime returns the time stored at offset in UTC
+func (p *Page) GetTime(offset int64) (time.Time, error) {
+	b, err := p.slice(offset, TimeSize)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMicro(int64(binary.BigEndian.Uint64(b))).UTC(), nil
+}
+
+// SetTime stores value at offset with microsecond precision
+func (p *Page) SetTime(offset int64, value time.Time) error {
+	b, err := p.slice(offset, TimeSize)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint64(b, uint64(value.UnixMicro()))
+	return nil
+}
+
+// slice returns the size bytes of the page starting at offset, or ErrOutOfBounds
+func (p *Page) slice(offset int64, size int64) ([]byte, error) {
+	offsetEnd := offset + size
+	if offset < 0 || offsetEnd > p.Size {
+		return nil, ErrOutOfBounds
+	}
+	return p.Buffer[offset:offsetEnd], nil
+}
+
+// MaxLen Returns the number of bytes needed to store a string (or bytes) of length strLen in a Page
 func MaxLen(strLen int) int64 {
 	return IntSize + int64(strLen)
 }
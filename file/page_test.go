@@ -2,7 +2,9 @@ package file
 
 import (
 	"github.com/stretchr/testify/assert"
+	"math"
 	"testing"
+	"time"
 )
 
 func TestGetInt(t *testing.T) {
@@ -85,6 +87,11 @@ func TestGetBytes(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, tt.expected, actual)
 	}
+
+	// a corrupt (negative) length is out of bounds
+	page = NewPageWithBytes(Int64ToBytes(-1))
+	_, err := page.GetBytes(0)
+	assert.ErrorIs(t, err, ErrOutOfBounds)
 }
 
 func TestSetBytes(t *testing.T) {
@@ -140,3 +147,96 @@ func TestSetAndGetString(t *testing.T) {
 		assert.Equal(t, data[i], actual)
 	}
 }
+
+func TestSetAndGetFixedSizeTypes(t *testing.T) {
+	uuid := [UUIDSize]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	now := time.Date(2024, 3, 15, 10, 30, 45, 123456000, time.UTC)
+
+	page := NewPageWithSize(100)
+	var offset int64 = 3
+
+	assert.NoError(t, page.SetInt32(offset, math.MinInt32))
+	actualInt32, err := page.GetInt32(offset)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(math.MinInt32), actualInt32)
+
+	offset += Int32Size
+	assert.NoError(t, page.SetInt16(offset, -1234))
+	actualInt16, err := page.GetInt16(offset)
+	assert.NoError(t, err)
+	assert.Equal(t, int16(-1234), actualInt16)
+
+	offset += Int16Size
+	assert.NoError(t, page.SetBool(offset, true))
+	actualBool, err := page.GetBool(offset)
+	assert.NoError(t, err)
+	assert.True(t, actualBool)
+	assert.NoError(t, page.SetBool(offset, false))
+	actualBool, _ = page.GetBool(offset)
+	assert.False(t, actualBool)
+
+	offset += BoolSize
+	assert.NoError(t, page.SetFloat64(offset, -3.75))
+	actualFloat, err := page.GetFloat64(offset)
+	assert.NoError(t, err)
+	assert.Equal(t, -3.75, actualFloat)
+
+	offset += Float64Size
+	assert.NoError(t, page.SetUUID(offset, uuid))
+	actualUUID, err := page.GetUUID(offset)
+	assert.NoError(t, err)
+	assert.Equal(t, uuid, actualUUID)
+
+	offset += UUIDSize
+	assert.NoError(t, page.SetTime(offset, now))
+	actualTime, err := page.GetTime(offset)
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(actualTime))
+
+	// sub-microsecond precision is not stored
+	assert.NoError(t, page.SetTime(offset, now.Add(999)))
+	actualTime, _ = page.GetTime(offset)
+	assert.True(t, now.Equal(actualTime))
+}
+
+func TestFixedSizeTypesOutOfBounds(t *testing.T) {
+	page := NewPageWithSize(10)
+
+	tests := []struct {
+		name string
+		size int64
+		set  func(offset int64) error
+		get  func(offset int64) error
+	}{
+		{"int32", Int32Size,
+			func(offset int64) error { return page.SetInt32(offset, 1) },
+			func(offset int64) error { _, err := page.GetInt32(offset); return err }},
+		{"int16", Int16Size,
+			func(offset int64) error { return page.SetInt16(offset, 1) },
+			func(offset int64) error { _, err := page.GetInt16(offset); return err }},
+		{"bool", BoolSize,
+			func(offset int64) error { return page.SetBool(offset, true) },
+			func(offset int64) error { _, err := page.GetBool(offset); return err }},
+		{"float64", Float64Size,
+			func(offset int64) error { return page.SetFloat64(offset, 1) },
+			func(offset int64) error { _, err := page.GetFloat64(offset); return err }},
+		{"uuid", UUIDSize,
+			func(offset int64) error { return page.SetUUID(offset, [UUIDSize]byte{}) },
+			func(offset int64) error { _, err := page.GetUUID(offset); return err }},
+		{"time", TimeSize,
+			func(offset int64) error { return page.SetTime(offset, time.Now()) },
+			func(offset int64) error { _, err := page.GetTime(offset); return err }},
+	}
+
+	for _, tt := range tests {
+		lastOffset := page.Size - tt.size
+		if lastOffset >= 0 {
+			assert.NoError(t, tt.set(lastOffset), tt.name)
+			assert.NoError(t, tt.get(lastOffset), tt.name)
+		}
+		assert.ErrorIs(t, tt.set(lastOffset+1), ErrOutOfBounds, tt.name)
+		assert.ErrorIs(t, tt.get(lastOffset+1), ErrOutOfBounds, tt.name)
+		assert.ErrorIs(t, tt.set(-1), ErrOutOfBounds, tt.name)
+		assert.ErrorIs(t, tt.get(-1), ErrOutOfBounds, tt.name)
+	}
+}
@@ -0,0 +1,53 @@
+package file
+
+import (
+	"errors"
+)
+
+// ErrReadOnly is returned when a file of a FileMgr opened with WithReadOnly is changed
+var ErrReadOnly = errors.New("database is opened read-only")
+
+// WithReadOnly opens the existing DB directory for reading only.
+// The directory is not locked, so a DB can be inspected while another process is using it,
+// in which case the blocks being written by that process may be read partly written.
+// Every change to a file (Write, Append, Truncate, Create, Delete) fails with ErrReadOnly.
+func WithReadOnly() Option {
+	return func(f *FileMgr) {
+		f.readOnly = true
+	}
+}
+
+// readOnlyStorage rejects every change to the files of the Storage it wraps
+type readOnlyStorage struct {
+	Storage
+}
+
+func (s readOnlyStorage) Write(block Block, b []byte) error {
+	return ErrReadOnly
+}
+
+func (s readOnlyStorage) Append(filename string, b []byte) (Block, error) {
+	return Block{}, ErrReadOnly
+}
+
+func (s readOnlyStorage) Truncate(filename string, blockCount int64) error {
+	return ErrReadOnly
+}
+
+func (s readOnlyStorage) Create(filename string) error {
+	return ErrReadOnly
+}
+
+func (s readOnlyStorage) Delete(filename string) error {
+	return ErrReadOnly
+}
+
+// Sync does nothing, since there are no changes to flush
+func (s readOnlyStorage) Sync(filename string) error {
+	return nil
+}
+
+// ReadOnly reports whether the FileMgr was opened with WithReadOnly
+func (f *FileMgr) ReadOnly() bool {
+	return f.readOnly
+}
@@ -0,0 +1,227 @@
+package file
+
+import (
+	"fmt"
+	"github.com/sasha-s/go-deadlock"
+	"strings"
+	"time"
+)
+
+/*
+FileMgr keeps I/O statistics for each file: the number of reads, writes, appends and syncs,
+the number of bytes read and written, and a latency histogram for each kind of operation.
+
+A latency histogram has exponential buckets, the upper bound of bucket i is 2^i microseconds.
+The last bucket holds all the operations slower than the upper bound of the bucket before it.
++---------+---------+---------+-----+-----------+------------+
+| <= 1µs  | <= 2µs  | <= 4µs  | ... | <= 2^20µs | > 2^20µs   |
++---------+---------+---------+-----+-----------+------------+
+| Bucket 0| Bucket 1| Bucket 2| ... | Bucket 20 | Bucket 21  |
++---------+---------+---------+-----+-----------+------------+
+*/
+
+const histogramBuckets = 22
+
+// Histogram is a snapshot of the latencies of an operation
+type Histogram struct {
+	// Counts[i] is the number of operations with latency <= BucketBound(i),
+	// and > BucketBound(i-1). The last bucket has no upper bound.
+	Counts [histogramBuckets]int64
+	Count  int64
+	Sum    time.Duration
+	Max    time.Duration
+}
+
+// BucketBound returns the upper bound of bucket i of a Histogram
+func BucketBound(i int) time.Duration {
+	return time.Microsecond << i
+}
+
+func (h *Histogram) record(d time.Duration) {
+	i := 0
+	for i < histogramBuckets-1 && d > BucketBound(i) {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+	h.Max = max(h.Max, d)
+}
+
+func (h *Histogram) add(other Histogram) {
+	for i := range h.Counts {
+		h.Counts[i] += other.Counts[i]
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	h.Max = max(h.Max, other.Max)
+}
+
+// Mean returns the average latency, 0 if there are no operations
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Percentile returns the upper bound of the bucket that holds the p-th percentile (0 < p <= 100) latency.
+// The bound is capped at Max, and the last bucket (which has no upper bound) reports Max.
+func (h Histogram) Percentile(p float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := int64(float64(h.Count)*p/100 + 0.5)
+	rank = max(rank, 1)
+	var seen int64
+	for i, count := range h.Counts {
+		seen += count
+		if seen >= rank && i < histogramBuckets-1 {
+			return min(BucketBound(i), h.Max)
+		}
+	}
+	return h.Max
+}
+
+// FileStats holds the I/O statistics of a file
+type FileStats struct {
+	Reads        int64
+	Writes       int64
+	Appends      int64
+	Syncs        int64
+	BytesRead    int64
+	BytesWritten int64
+
+	ReadLatency   Histogram
+	WriteLatency  Histogram
+	AppendLatency Histogram
+	SyncLatency   Histogram
+}
+
+func (s *FileStats) add(other FileStats) {
+	s.Reads += other.Reads
+	s.Writes += other.Writes
+	s.Appends += other.Appends
+	s.Syncs += other.Syncs
+	s.BytesRead += other.BytesRead
+	s.BytesWritten += other.BytesWritten
+	s.ReadLatency.add(other.ReadLatency)
+	s.WriteLatency.add(other.WriteLatency)
+	s.AppendLatency.add(other.AppendLatency)
+	s.SyncLatency.add(other.SyncLatency)
+}
+
+func (s FileStats) String() string {
+	return fmt.Sprintf("reads: %v (%v bytes, mean %v, p99 %v), writes: %v (%v bytes, mean %v, p99 %v), appends: %v, syncs: %v (mean %v, p99 %v)",
+		s.Reads, s.BytesRead, s.ReadLatency.Mean(), s.ReadLatency.Percentile(99),
+		s.Writes, s.BytesWritten, s.WriteLatency.Mean(), s.WriteLatency.Percentile(99),
+		s.Appends, s.Syncs, s.SyncLatency.Mean(), s.SyncLatency.Percentile(99))
+}
+
+// Stats is a snapshot of the I/O statistics of FileMgr, Files maps a filename to its statistics
+type Stats struct {
+	Files map[string]FileStats
+	Since time.Time
+}
+
+// Total returns the statistics of all the files combined
+func (s Stats) Total() FileStats {
+	var total FileStats
+	for _, fileStats := range s.Files {
+		total.add(fileStats)
+	}
+	return total
+}
+
+func (s Stats) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "I/O stats since %v\n", s.Since.Format(time.RFC3339))
+	for filename, fileStats := range s.Files {
+		fmt.Fprintf(&sb, "%v: %v\n", filename, fileStats)
+	}
+	fmt.Fprintf(&sb, "total: %v\n", s.Total())
+	return sb.String()
+}
+
+// ioStats collects the statistics of FileMgr
+type ioStats struct {
+	mu    deadlock.Mutex
+	files map[string]*FileStats
+	since time.Time
+}
+
+func newIOStats() *ioStats {
+	return &ioStats{
+		files: make(map[string]*FileStats),
+		since: time.Now(),
+	}
+}
+
+func (s *ioStats) fileStats(filename string) *FileStats {
+	fileStats, ok := s.files[filename]
+	if !ok {
+		fileStats = &FileStats{}
+		s.files[filename] = fileStats
+	}
+	return fileStats
+}
+
+func (s *ioStats) recordRead(filename string, bytes int64, start time.Time) {
+	elapsed := time.Since(start)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fileStats := s.fileStats(filename)
+	fileStats.Reads++
+	fileStats.BytesRead += bytes
+	fileStats.ReadLatency.record(elapsed)
+}
+
+// recordWrite records a write of one or more blocks, Writes counts the blocks written
+func (s *ioStats) recordWrite(filename string, blocks int64, bytes int64, start time.Time) {
+	elapsed := time.Since(start)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fileStats := s.fileStats(filename)
+	fileStats.Writes += blocks
+	fileStats.BytesWritten += bytes
+	fileStats.WriteLatency.record(elapsed)
+}
+
+func (s *ioStats) recordAppend(filename string, bytes int64, start time.Time) {
+	elapsed := time.Since(start)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fileStats := s.fileStats(filename)
+	fileStats.Appends++
+	fileStats.BytesWritten += bytes
+	fileStats.AppendLatency.record(elapsed)
+}
+
+func (s *ioStats) recordSync(filename string, start time.Time) {
+	elapsed := time.Since(start)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fileStats := s.fileStats(filename)
+	fileStats.Syncs++
+	fileStats.SyncLatency.record(elapsed)
+}
+
+func (s *ioStats) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make(map[string]FileStats, len(s.files))
+	for filename, fileStats := range s.files {
+		files[filename] = *fileStats
+	}
+	return Stats{
+		Files: files,
+		Since: s.since,
+	}
+}
+
+func (s *ioStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.files)
+	s.since = time.Now()
+}
@@ -0,0 +1,73 @@
+package file
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	fileMgr, err := NewFileMgr(MemoryDir, blockTestSize, WithDurability(SyncEveryWrite))
+	assert.NoError(t, err)
+	defer fileMgr.Close()
+
+	otherFile := "other_file"
+	page := NewPageWithSize(blockTestSize)
+	block, err := fileMgr.Append(tempFileName)
+	assert.NoError(t, err)
+	assert.NoError(t, fileMgr.Write(block, page))
+	assert.NoError(t, fileMgr.Write(block, page))
+	assert.NoError(t, fileMgr.Read(block, page))
+	otherBlock, err := fileMgr.Append(otherFile)
+	assert.NoError(t, err)
+	assert.NoError(t, fileMgr.Read(otherBlock, page))
+
+	stats := fileMgr.Stats()
+	fileStats := stats.Files[tempFileName]
+	assert.Equal(t, int64(1), fileStats.Appends)
+	assert.Equal(t, int64(2), fileStats.Writes)
+	assert.Equal(t, int64(1), fileStats.Reads)
+	assert.Equal(t, int64(3), fileStats.Syncs)
+	assert.Equal(t, fileMgr.FrameSize(), fileStats.BytesRead)
+	assert.Equal(t, 3*fileMgr.FrameSize(), fileStats.BytesWritten)
+	assert.Equal(t, int64(2), fileStats.WriteLatency.Count)
+	assert.Equal(t, int64(3), fileStats.SyncLatency.Count)
+
+	total := stats.Total()
+	assert.Equal(t, int64(2), total.Reads)
+	assert.Equal(t, int64(2), total.Appends)
+	assert.Equal(t, int64(2), total.ReadLatency.Count)
+
+	// the snapshot does not change when more I/O is done
+	assert.NoError(t, fileMgr.Read(block, page))
+	assert.Equal(t, int64(1), stats.Files[tempFileName].Reads)
+	assert.Equal(t, int64(2), fileMgr.Stats().Files[tempFileName].Reads)
+
+	fileMgr.ResetStats()
+	stats = fileMgr.Stats()
+	assert.Empty(t, stats.Files)
+	assert.Equal(t, int64(0), stats.Total().Reads)
+}
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	assert.Equal(t, time.Duration(0), h.Mean())
+	assert.Equal(t, time.Duration(0), h.Percentile(50))
+
+	for i := 0; i < 98; i++ {
+		h.record(3 * time.Microsecond)
+	}
+	h.record(100 * time.Microsecond)
+	h.record(10 * time.Second)
+
+	assert.Equal(t, int64(100), h.Count)
+	assert.Equal(t, int64(98), h.Counts[2])
+	assert.Equal(t, int64(1), h.Counts[7])
+	assert.Equal(t, int64(1), h.Counts[histogramBuckets-1])
+	assert.Equal(t, 10*time.Second, h.Max)
+
+	assert.Equal(t, 4*time.Microsecond, h.Percentile(50))
+	assert.Equal(t, 128*time.Microsecond, h.Percentile(99))
+	assert.Equal(t, 10*time.Second, h.Percentile(100))
+	assert.Equal(t, (98*3*time.Microsecond+100*time.Microsecond+10*time.Second)/100, h.Mean())
+}
@@ -0,0 +1,46 @@
+package file
+
+// MemoryDir is the dbDir used to create a FileMgr whose files are kept in memory instead of on disk.
+const MemoryDir = ":memory:"
+
+// Storage is where FileMgr keeps the blocks of its files.
+//
+// A Storage deals in frames (the bytes that are stored for a block, see FileMgr.FrameSize),
+// all frames of a Storage have the same size, which is fixed when the Storage is created.
+// Implementations must be safe for concurrent use.
+type Storage interface {
+	// Read reads the frame of block into b
+	Read(block Block, b []byte) error
+
+	// Write writes the frame b to block.
+	// b may also hold several consecutive frames, which are written to block and the blocks that follow it.
+	Write(block Block, b []byte) error
+
+	// Append adds the frame b to the end of the file and returns the newly added block.
+	// The file is created if it does not exist.
+	Append(filename string, b []byte) (Block, error)
+
+	// BlockCount returns the number of blocks in the file, which is 0 if the file does not exist
+	BlockCount(filename string) (int64, error)
+
+	// Truncate shrinks the file to blockCount blocks
+	Truncate(filename string, blockCount int64) error
+
+	// Exists reports whether the file exists
+	Exists(filename string) (bool, error)
+
+	// Create creates an empty file if it does not already exist
+	Create(filename string) error
+
+	// Delete removes the file
+	Delete(filename string) error
+
+	// List returns the names of all the files, sorted by name
+	List() ([]string, error)
+
+	// Sync flushes the contents of the file to stable storage
+	Sync(filename string) error
+
+	// Close releases the resources held by the Storage
+	Close() error
+}
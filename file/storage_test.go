@@ -0,0 +1,98 @@
+package file
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	dbDir := "temp_storage_dir"
+	osStore, err := newOSStorage(dbDir, blockTestSize, false)
+	assert.NoError(t, err)
+	defer removeFile(filepath.Join(dbDir, LockFile), dbDir)
+
+	storages := map[string]Storage{
+		"os":     osStore,
+		"memory": newMemStorage(blockTestSize),
+	}
+
+	for name, storage := range storages {
+		count, err := storage.BlockCount(tempFileName)
+		assert.NoError(t, err, name)
+		assert.Equal(t, int64(0), count, name)
+
+		// reading or writing a file that does not exist fails
+		b := make([]byte, blockTestSize)
+		assert.ErrorIs(t, storage.Read(GetBlock(tempFileName, 0), b), os.ErrNotExist, name)
+		assert.ErrorIs(t, storage.Write(GetBlock(tempFileName, 0), b), os.ErrNotExist, name)
+
+		exists, err := storage.Exists(tempFileName)
+		assert.NoError(t, err, name)
+		assert.False(t, exists, name)
+		assert.NoError(t, storage.Create(tempFileName), name)
+		assert.NoError(t, storage.Create(tempFileName), name)
+		exists, _ = storage.Exists(tempFileName)
+		assert.True(t, exists, name)
+		filenames, err := storage.List()
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{tempFileName}, filenames, name)
+
+		for i, c := range []byte("abc") {
+			block, err := storage.Append(tempFileName, bytes.Repeat([]byte{c}, blockTestSize))
+			assert.NoError(t, err, name)
+			assert.Equal(t, GetBlock(tempFileName, int64(i)), block, name)
+		}
+		count, _ = storage.BlockCount(tempFileName)
+		assert.Equal(t, int64(3), count, name)
+
+		expected := bytes.Repeat([]byte("x"), blockTestSize)
+		assert.NoError(t, storage.Write(GetBlock(tempFileName, 1), expected), name)
+		assert.NoError(t, storage.Sync(tempFileName), name)
+
+		assert.NoError(t, storage.Read(GetBlock(tempFileName, 1), b), name)
+		assert.Equal(t, expected, b, name)
+		assert.NoError(t, storage.Read(GetBlock(tempFileName, 2), b), name)
+		assert.Equal(t, bytes.Repeat([]byte("c"), blockTestSize), b, name)
+
+		// reading past the end of the file fails
+		assert.Error(t, storage.Read(GetBlock(tempFileName, 3), b), name)
+
+		assert.NoError(t, storage.Truncate(tempFileName, 2), name)
+		count, _ = storage.BlockCount(tempFileName)
+		assert.Equal(t, int64(2), count, name)
+		assert.Error(t, storage.Read(GetBlock(tempFileName, 2), b), name)
+		assert.NoError(t, storage.Read(GetBlock(tempFileName, 1), b), name)
+		assert.Equal(t, expected, b, name)
+
+		assert.NoError(t, storage.Delete(tempFileName), name)
+		count, _ = storage.BlockCount(tempFileName)
+		assert.Equal(t, int64(0), count, name)
+		assert.Error(t, storage.Delete(tempFileName), name)
+		filenames, _ = storage.List()
+		assert.Empty(t, filenames, name)
+		assert.NoError(t, storage.Close(), name)
+	}
+}
+
+func TestMemoryFileMgr(t *testing.T) {
+	fileMgr, err := NewFileMgr(MemoryDir, blockTestSize)
+	assert.NoError(t, err)
+	assert.True(t, fileMgr.IsNew)
+	assert.False(t, pathExists(MemoryDir))
+
+	blockCount, err := fileMgr.BlockCount(tempFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), blockCount)
+	block, err := fileMgr.Append(tempFileName)
+	assert.NoError(t, err)
+
+	expected := bytes.Repeat([]byte("m"), blockTestSize)
+	assert.NoError(t, fileMgr.Write(block, NewPageWithBytes(expected)))
+	page := NewPageWithSize(blockTestSize)
+	assert.NoError(t, fileMgr.Read(block, page))
+	assert.Equal(t, expected, page.Buffer)
+	assert.NoError(t, fileMgr.Close())
+}
@@ -0,0 +1,79 @@
+package file
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// BlockWrite is a Page to be written to a Block by WriteBatch
+type BlockWrite struct {
+	Block Block
+	Page  *Page
+}
+
+// WriteBatch writes many pages to their blocks with as few writes to storage as possible.
+// The writes are sorted by file and block number, and the frames of adjacent blocks are
+// coalesced into a single write. Each file that is written is synced once, after all its blocks are written
+// (unless Durability is SyncNever).
+// If the same block appears more than once, the last write to it in writes is used.
+func (f *FileMgr) WriteBatch(writes []BlockWrite) error {
+	if len(writes) == 0 {
+		return nil
+	}
+
+	sorted := slices.Clone(writes)
+	slices.SortStableFunc(sorted, func(a, b BlockWrite) int {
+		if c := cmp.Compare(a.Block.Filename, b.Block.Filename); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Block.Number, b.Block.Number)
+	})
+	sorted = dedupeWrites(sorted)
+
+	frameSize := f.FrameSize()
+	for start := 0; start < len(sorted); {
+		// sorted[start:end] is a run of adjacent blocks of the same file
+		end := start + 1
+		for end < len(sorted) && sorted[end].Block.Filename == sorted[start].Block.Filename &&
+			sorted[end].Block.Number == sorted[end-1].Block.Number+1 {
+			end++
+		}
+
+		frames := make([]byte, int64(end-start)*frameSize)
+		for i, write := range sorted[start:end] {
+			f.encodeFrame(write.Block, write.Page, frames[int64(i)*frameSize:int64(i+1)*frameSize])
+		}
+
+		first := sorted[start].Block
+		writeStart := time.Now()
+		err := f.storage.Write(first, frames)
+		if err != nil {
+			return fmt.Errorf("could not write %v blocks from block %v, %w", end-start, first, err)
+		}
+		f.stats.recordWrite(first.Filename, int64(end-start), int64(len(frames)), writeStart)
+
+		lastOfFile := end == len(sorted) || sorted[end].Block.Filename != first.Filename
+		if lastOfFile && f.Durability != SyncNever {
+			err = f.sync(first.Filename)
+			if err != nil {
+				return err
+			}
+		}
+		start = end
+	}
+	return nil
+}
+
+// dedupeWrites removes all but the last write to each block from writes sorted by block
+func dedupeWrites(writes []BlockWrite) []BlockWrite {
+	deduped := writes[:0]
+	for i, write := range writes {
+		if i+1 < len(writes) && writes[i+1].Block == write.Block {
+			continue
+		}
+		deduped = append(deduped, write)
+	}
+	return deduped
+}
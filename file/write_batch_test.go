@@ -0,0 +1,62 @@
+package file
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWriteBatch(t *testing.T) {
+	fileMgr, err := NewFileMgr(MemoryDir, blockTestSize)
+	assert.NoError(t, err)
+	defer fileMgr.Close()
+
+	otherFile := "other_file"
+	for i := 0; i < 5; i++ {
+		fileMgr.Append(tempFileName)
+		fileMgr.Append(otherFile)
+	}
+	fileMgr.ResetStats()
+
+	page := func(c byte) *Page {
+		return NewPageWithBytes(bytes.Repeat([]byte{c}, blockTestSize))
+	}
+	writes := []BlockWrite{
+		{GetBlock(tempFileName, 4), page('e')},
+		{GetBlock(otherFile, 1), page('x')},
+		{GetBlock(tempFileName, 1), page('b')},
+		{GetBlock(tempFileName, 0), page('z')},
+		{GetBlock(tempFileName, 0), page('a')},
+		{GetBlock(tempFileName, 2), page('c')},
+	}
+	assert.NoError(t, fileMgr.WriteBatch(writes))
+
+	// the last write to a block wins
+	expected := map[Block]byte{
+		GetBlock(tempFileName, 0): 'a',
+		GetBlock(tempFileName, 1): 'b',
+		GetBlock(tempFileName, 2): 'c',
+		GetBlock(tempFileName, 3): 0,
+		GetBlock(tempFileName, 4): 'e',
+		GetBlock(otherFile, 1):    'x',
+	}
+	readPage := NewPageWithSize(blockTestSize)
+	for block, c := range expected {
+		assert.NoError(t, fileMgr.Read(block, readPage))
+		assert.Equal(t, bytes.Repeat([]byte{c}, blockTestSize), readPage.Buffer, block)
+	}
+
+	// blocks 0-2 are written together, then block 4, and each file is synced once
+	stats := fileMgr.Stats()
+	fileStats := stats.Files[tempFileName]
+	assert.Equal(t, int64(4), fileStats.Writes)
+	assert.Equal(t, int64(2), fileStats.WriteLatency.Count)
+	assert.Equal(t, 4*fileMgr.FrameSize(), fileStats.BytesWritten)
+	assert.Equal(t, int64(1), fileStats.Syncs)
+	assert.Equal(t, int64(1), stats.Files[otherFile].Writes)
+	assert.Equal(t, int64(1), stats.Files[otherFile].Syncs)
+
+	// the order of writes given by the caller is not changed
+	assert.Equal(t, GetBlock(tempFileName, 4), writes[0].Block)
+	assert.NoError(t, fileMgr.WriteBatch(nil))
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"fmt"
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/naveen246/kite-db/wal"
+	"strings"
+)
+
+/*
+Point-in-time recovery restores a DB from a base backup and the archive of its log.
+
+1. The DB is created with WithArchiveDir, so every completed segment of its log is copied to the archive.
+2. Backup copies the data files of the DB to a backup directory, along with the LSN of the log when it started.
+3. Restore copies the backup to a new DB directory and replays the archived log records
+   up to a target LSN or commit time (see txn.Redo).
+
+The archive must hold the records from before the backup started, so archiving must be enabled before Backup.
+Only the records of completed segments are in the archive, so a target after the last archived record
+restores the DB to that record.
+*/
+
+// BackupLabelFile is the file of a backup that holds the LSN of the DB log when the backup started,
+// the LSN of the Start record of the oldest transaction running then, and the LSN of the DB log when the backup ended
+const BackupLabelFile = "backup_label"
+
+// restoreBufferCount is the number of buffers of the DB while its log is replayed by Restore
+const restoreBufferCount = 16
+
+// Backup copies the data files of the DB to backupDir, which must not hold any files,
+// and returns the LSN of the DB log when the backup started. The DB can be used during the backup.
+// The backup is encrypted with the key of the DB, if it has one.
+func (db *DB) Backup(backupDir string) (int64, error) {
+	backup, err := file.NewFileMgr(backupDir, db.FileMgr.BlockSize, db.cfg.fileOpts...)
+	if err != nil {
+		return 0, err
+	}
+	defer backup.Close()
+	err = checkEmpty(backup)
+	if err != nil {
+		return 0, err
+	}
+
+	// every change logged up to backupLSN by a finished transaction is already on disk
+	backupLSN := db.Log.LatestLSN()
+	startLSN, err := txn.OldestActiveStart(db.Log, backupLSN)
+	if err != nil {
+		return 0, err
+	}
+	filenames, err := db.FileMgr.List()
+	if err != nil {
+		return 0, err
+	}
+	for _, filename := range filenames {
+		if strings.HasPrefix(filename, LogFile+".") {
+			continue
+		}
+		err = file.CopyFile(db.FileMgr, backup, filename)
+		if err != nil {
+			return 0, fmt.Errorf("could not backup %v: %w", filename, err)
+		}
+	}
+
+	label := backupLabel{lsn: backupLSN, startLSN: startLSN, endLSN: db.Log.LatestLSN()}
+	block, err := backup.Append(BackupLabelFile)
+	if err != nil {
+		return 0, err
+	}
+	page := file.NewPageWithSize(backup.BlockSize)
+	for i, lsn := range []int64{label.lsn, label.startLSN, label.endLSN} {
+		err = page.SetInt(int64(i)*file.IntSize, lsn)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = backup.Write(block, page)
+	if err != nil {
+		return 0, err
+	}
+	return backupLSN, backup.Sync(BackupLabelFile)
+}
+
+// Restore creates a DB in dbDir, which must not hold any files, from the backup in backupDir
+// and the log archived in archiveDir, recovered to target (see txn.RecoveryTarget).
+// The opts are those the DB was created with, the archive dir of the restored DB must be a new directory.
+// Returns the LSN of the last archived record that was replayed.
+func Restore(dbDir string, backupDir string, archiveDir string, blockSize int64, target txn.RecoveryTarget, opts ...Option) (int64, error) {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	readOnlyOpts := append(cfg.fileOpts[:len(cfg.fileOpts):len(cfg.fileOpts)], file.WithReadOnly())
+
+	backup, err := file.NewFileMgr(backupDir, blockSize, readOnlyOpts...)
+	if err != nil {
+		return 0, err
+	}
+	defer backup.Close()
+	label, err := readBackupLabel(backup)
+	if err != nil {
+		return 0, err
+	}
+
+	archive, err := file.NewFileMgr(archiveDir, blockSize, readOnlyOpts...)
+	if err != nil {
+		return 0, err
+	}
+	defer archive.Close()
+	archiveLog, err := wal.NewLog(archive, LogFile, cfg.logOpts...)
+	if err != nil {
+		return 0, err
+	}
+
+	err = copyBackup(backup, dbDir, cfg)
+	if err != nil {
+		return 0, err
+	}
+	db, err := NewDB(dbDir, blockSize, restoreBufferCount, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	tx, err := db.NewTx()
+	if err != nil {
+		return 0, err
+	}
+	lsn, err := tx.Redo(archiveLog, label.lsn, target)
+	if err != nil {
+		return 0, fmt.Errorf("could not replay archived log: %w", err)
+	}
+	return lsn, tx.Commit()
+}
+
+// copyBackup copies the data files of backup to dbDir
+func copyBackup(backup *file.FileMgr, dbDir string, cfg *config) error {
+	fileMgr, err := file.NewFileMgr(dbDir, backup.BlockSize, cfg.fileOpts...)
+	if err != nil {
+		return err
+	}
+	defer fileMgr.Close()
+	err = checkEmpty(fileMgr)
+	if err != nil {
+		return err
+	}
+
+	filenames, err := backup.List()
+	if err != nil {
+		return err
+	}
+	for _, filename := range filenames {
+		if filename == BackupLabelFile {
+			continue
+		}
+		err = file.CopyFile(backup, fileMgr, filename)
+		if err != nil {
+			return fmt.Errorf("could not restore %v: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// backupLabel holds the LSNs of the DB log saved by Backup
+type backupLabel struct {
+	// lsn is the latest LSN when the backup started, it is returned by Backup
+	lsn int64
+	// startLSN is the LSN of the Start record of the oldest transaction running when the backup started (see txn.OldestActiveStart)
+	startLSN int64
+	// endLSN is the latest LSN when the backup ended, the changes logged after it are not in the backup
+	endLSN int64
+}
+
+// readBackupLabel returns the LSNs saved in the label of the backup
+func readBackupLabel(backup *file.FileMgr) (backupLabel, error) {
+	blockCount, err := backup.BlockCount(BackupLabelFile)
+	if err != nil {
+		return backupLabel{}, err
+	}
+	if blockCount == 0 {
+		return backupLabel{}, fmt.Errorf("%v is not a backup, %v is missing", backup.DbDir, BackupLabelFile)
+	}
+	page := file.NewPageWithSize(backup.BlockSize)
+	err = backup.Read(file.GetBlock(BackupLabelFile, 0), page)
+	if err != nil {
+		return backupLabel{}, err
+	}
+	var lsns [3]int64
+	for i := range lsns {
+		lsns[i], err = page.GetInt(int64(i) * file.IntSize)
+		if err != nil {
+			return backupLabel{}, err
+		}
+	}
+	return backupLabel{lsn: lsns[0], startLSN: lsns[1], endLSN: lsns[2]}, nil
+}
+
+// checkEmpty returns an error if the directory of fileMgr holds any files
+func checkEmpty(fileMgr *file.FileMgr) error {
+	filenames, err := fileMgr.List()
+	if err != nil {
+		return err
+	}
+	if len(filenames) > 0 {
+		return fmt.Errorf("directory %v is not empty", fileMgr.DbDir)
+	}
+	return nil
+}
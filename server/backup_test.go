@@ -0,0 +1,160 @@
+package server_test
+
+import (
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/server"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPointInTimeRecovery(t *testing.T) {
+	dir := t.TempDir()
+	archiveDir := filepath.Join(dir, "archive")
+	opts := []server.Option{server.WithLogSegmentSize(2)}
+	db, err := server.NewDB(filepath.Join(dir, "db"), blockTestSize, 8, append(opts, server.WithArchiveDir(archiveDir))...)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	initial := []int64{0, 1, 2, 3, 4, 5}
+	appendBlocks(t, db)
+	tx1, tx2 := setData(t, db, initial, initial, "abc", "def")
+	assert.NoError(t, tx1.Commit())
+	assert.NoError(t, tx2.Commit())
+
+	// tx3 is running during the backup, its changes are in the backup but are undone unless it commits
+	data1 := []int64{10, 11, 12, 13, 14, 15}
+	tx3, tx4 := setData(t, db, data1, initial, "ghi", "def")
+	assert.NoError(t, tx4.Commit())
+	assert.NoError(t, db.BufPool.FlushAll(int64(tx3.TxNum)))
+	backupLSN, err := db.Backup(filepath.Join(dir, "backup"))
+	assert.NoError(t, err)
+	_, err = db.Backup(filepath.Join(dir, "backup"))
+	assert.Error(t, err)
+	assert.NoError(t, tx3.Commit())
+	time.Sleep(time.Millisecond)
+	commitTime := time.Now()
+	time.Sleep(time.Millisecond)
+
+	data2 := []int64{20, 21, 22, 23, 24, 25}
+	tx5, tx6 := setData(t, db, data2, data2, "jkl", "mno")
+	assert.NoError(t, tx5.Commit())
+	assert.NoError(t, tx6.Commit())
+	commitLSN := tx6.CommitLSN()
+
+	// tx7 does not finish, tx8 rolls back, their changes are undone even though they reached the disk
+	data3 := []int64{30, 31, 32, 33, 34, 35}
+	tx7, tx8 := setData(t, db, data3, data3, "pqr", "stu")
+	assert.NoError(t, db.BufPool.FlushAll(int64(tx7.TxNum)))
+	assert.NoError(t, tx8.Rollback())
+	tx7.ReleaseLocks()
+	assert.NoError(t, db.Close())
+
+	restore := func(target txn.RecoveryTarget, b0Data []int64, b1Data []int64, str1 string, str2 string) {
+		restoreDir := filepath.Join(t.TempDir(), "restored")
+		lsn, err := server.Restore(restoreDir, filepath.Join(dir, "backup"), archiveDir, blockTestSize, target, opts...)
+		assert.NoError(t, err)
+		if target.LSN > 0 {
+			assert.LessOrEqual(t, lsn, target.LSN)
+		}
+		restored, err := server.NewDB(restoreDir, blockTestSize, 8, opts...)
+		assert.NoError(t, err)
+		defer restored.Close()
+		verifyData(t, restored, b0Data, b1Data, str1, str2)
+	}
+	restore(txn.RecoveryTarget{LSN: backupLSN}, initial, initial, "abc", "def")
+	restore(txn.RecoveryTarget{Time: commitTime}, data1, initial, "ghi", "def")
+	restore(txn.RecoveryTarget{LSN: commitLSN - 1}, data2, initial, "jkl", "def")
+	restore(txn.RecoveryTarget{LSN: commitLSN}, data2, data2, "jkl", "mno")
+	restore(txn.RecoveryTarget{}, data2, data2, "jkl", "mno")
+
+	// the restored DB directory must be new
+	_, err = server.Restore(filepath.Join(dir, "db"), filepath.Join(dir, "backup"), archiveDir, blockTestSize, txn.RecoveryTarget{}, opts...)
+	assert.Error(t, err)
+	_, err = server.Restore(filepath.Join(t.TempDir(), "restored"), archiveDir, archiveDir, blockTestSize, txn.RecoveryTarget{}, opts...)
+	assert.Error(t, err)
+}
+
+func TestPointInTimeRecoveryAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	archiveDir := filepath.Join(dir, "archive")
+	opts := []server.Option{server.WithLogSegmentSize(2)}
+	db, err := server.NewDB(filepath.Join(dir, "db"), blockTestSize, 8, append(opts, server.WithArchiveDir(archiveDir))...)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx := newTx(t, db)
+	block, err := tx.Append(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	_, err = db.Backup(filepath.Join(dir, "backup"))
+	assert.NoError(t, err)
+
+	// tx1 does not finish, the DB crashes and recover rolls it back
+	tx1 := newTx(t, db)
+	tx1.Pin(block)
+	assert.NoError(t, tx1.SetInt(block, 0, 5, true))
+	assert.NoError(t, db.BufPool.FlushAll(int64(tx1.TxNum)))
+	tx1.ReleaseLocks()
+	tx2 := newTx(t, db)
+	assert.NoError(t, tx2.Recover())
+	assert.NoError(t, tx2.Commit())
+
+	tx3 := newTx(t, db)
+	tx3.Pin(block)
+	assert.NoError(t, tx3.SetInt(block, 0, 7, true))
+	assert.NoError(t, tx3.Commit())
+	assert.NoError(t, db.Close())
+
+	restoreDir := filepath.Join(t.TempDir(), "restored")
+	_, err = server.Restore(restoreDir, filepath.Join(dir, "backup"), archiveDir, blockTestSize, txn.RecoveryTarget{}, opts...)
+	assert.NoError(t, err)
+	restored, err := server.NewDB(restoreDir, blockTestSize, 8, opts...)
+	assert.NoError(t, err)
+	defer restored.Close()
+	page := file.NewPageWithSize(blockTestSize)
+	assert.NoError(t, restored.FileMgr.Read(block, page))
+	val, err := page.GetInt(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), val)
+}
+
+func TestEncryptedBackup(t *testing.T) {
+	dir := t.TempDir()
+	archiveDir := filepath.Join(dir, "archive")
+	opts := []server.Option{server.WithLogSegmentSize(2), server.WithEncryptionKey([]byte("0123456789abcdef"))}
+	db, err := server.NewDB(filepath.Join(dir, "db"), blockTestSize, 8, append(opts, server.WithArchiveDir(archiveDir))...)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx := newTx(t, db)
+	block, err := tx.Append(filename)
+	assert.NoError(t, err)
+	tx.Pin(block)
+	assert.NoError(t, tx.SetInt(block, 0, 5, true))
+	assert.NoError(t, tx.Commit())
+	_, err = db.Backup(filepath.Join(dir, "backup"))
+	assert.NoError(t, err)
+
+	tx = newTx(t, db)
+	tx.Pin(block)
+	assert.NoError(t, tx.SetInt(block, 0, 7, true))
+	assert.NoError(t, tx.Commit())
+	assert.NoError(t, db.Close())
+
+	restoreDir := filepath.Join(t.TempDir(), "restored")
+	_, err = server.Restore(restoreDir, filepath.Join(dir, "backup"), archiveDir, blockTestSize, txn.RecoveryTarget{}, opts...)
+	assert.NoError(t, err)
+	_, err = server.NewDB(restoreDir, blockTestSize, 8, server.WithLogSegmentSize(2))
+	assert.ErrorIs(t, err, file.ErrKeyRequired)
+	restored, err := server.NewDB(restoreDir, blockTestSize, 8, opts...)
+	assert.NoError(t, err)
+	defer restored.Close()
+	page := file.NewPageWithSize(blockTestSize)
+	assert.NoError(t, restored.FileMgr.Read(block, page))
+	val, err := page.GetInt(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), val)
+}
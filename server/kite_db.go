@@ -1,34 +1,138 @@
 package server
 
 import (
+	"errors"
 	"github.com/naveen246/kite-db/buffer"
 	"github.com/naveen246/kite-db/file"
 	"github.com/naveen246/kite-db/txn"
 	"github.com/naveen246/kite-db/wal"
+	"time"
 )
 
-var (
-	logFile = "simpledb.log"
-)
+// LogFile is the name of the log of a DB, the log is stored in the segment files LogFile.0000, LogFile.0001, ...
+const LogFile = "simpledb.log"
 
 type DB struct {
 	FileMgr *file.FileMgr
 	Log     *wal.Log
 	BufPool *buffer.BufferPool
+
+	// archive holds the completed log segments, if the DB was created with WithArchiveDir
+	archive *file.FileMgr
+	cfg     *config
+}
+
+// config holds the settings applied by Option when a DB is created
+type config struct {
+	fileOpts   []file.Option
+	logOpts    []wal.Option
+	archiveDir string
+}
+
+// Option configures a DB created by NewDB
+type Option func(c *config)
+
+// WithDurability sets when the data files and the log file are synced to stable storage,
+// the default is file.SyncOnFlush
+func WithDurability(durability file.Durability) Option {
+	return func(c *config) {
+		c.fileOpts = append(c.fileOpts, file.WithDurability(durability))
+	}
+}
+
+// WithEncryptionKey encrypts the data files and the log file at rest with AES-GCM,
+// see file.WithEncryptionKey. A DB created with a key must always be opened with the same key.
+func WithEncryptionKey(key []byte) Option {
+	return func(c *config) {
+		c.fileOpts = append(c.fileOpts, file.WithEncryptionKey(key))
+	}
+}
+
+// WithGroupCommit sets how long a committing transaction waits for other commits to share its log flush,
+// and the number of waiting commits after which the log is flushed without waiting longer, see wal.WithGroupCommit
+func WithGroupCommit(maxDelay time.Duration, maxBatch int) Option {
+	return func(c *config) {
+		c.logOpts = append(c.logOpts, wal.WithGroupCommit(maxDelay, maxBatch))
+	}
+}
+
+// WithAsyncCommit makes committing transactions return without waiting for the log to be flushed,
+// the log is flushed in the background every flushInterval instead. The commits of the last flushInterval
+// can be lost in a crash, see wal.WithAsyncCommit and wal.Log.WaitDurable.
+func WithAsyncCommit(flushInterval time.Duration) Option {
+	return func(c *config) {
+		c.logOpts = append(c.logOpts, wal.WithAsyncCommit(flushInterval))
+	}
+}
+
+// WithArchiveDir copies every completed segment file of the log to archiveDir, see wal.WithArchive.
+// The archive and a Backup of the DB are what Restore needs to recover the DB to a point in time.
+func WithArchiveDir(archiveDir string) Option {
+	return func(c *config) {
+		c.archiveDir = archiveDir
+	}
+}
+
+// WithLogSegmentSize sets the number of blocks in a segment file of the log, see wal.WithSegmentSize
+func WithLogSegmentSize(blocks int64) Option {
+	return func(c *config) {
+		c.logOpts = append(c.logOpts, wal.WithSegmentSize(blocks))
+	}
 }
 
-func NewDB(dbDir string, blockSize int64, bufferCount int) *DB {
-	fileMgr := file.NewFileMgr(dbDir, blockSize)
-	log := wal.NewLog(fileMgr, logFile)
+// NewDB opens the database in dbDir, creating it if it does not exist.
+// If dbDir is file.MemoryDir (":memory:"), the database is kept entirely in memory.
+func NewDB(dbDir string, blockSize int64, bufferCount int, opts ...Option) (*DB, error) {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	fileMgr, err := file.NewFileMgr(dbDir, blockSize, cfg.fileOpts...)
+	if err != nil {
+		return nil, err
+	}
+	logOpts := cfg.logOpts
+	var archive *file.FileMgr
+	if cfg.archiveDir != "" {
+		archive, err = file.NewFileMgr(cfg.archiveDir, blockSize, cfg.fileOpts...)
+		if err != nil {
+			fileMgr.Close()
+			return nil, err
+		}
+		logOpts = append(logOpts[:len(logOpts):len(logOpts)], wal.WithArchive(archive))
+	}
+	log, err := wal.NewLog(fileMgr, LogFile, logOpts...)
+	if err != nil {
+		fileMgr.Close()
+		if archive != nil {
+			archive.Close()
+		}
+		return nil, err
+	}
 	bufferPool := buffer.NewBufferPool(fileMgr, log, bufferCount)
 	txn.ResetLockTable()
 	return &DB{
 		FileMgr: fileMgr,
 		Log:     log,
 		BufPool: bufferPool,
+		archive: archive,
+		cfg:     cfg,
+	}, nil
+}
+
+// Close flushes the log, closes the files of the DB and releases the lock on the DB directory.
+// The DB must not be used after Close.
+func (db *DB) Close() error {
+	logErr := db.Log.Close()
+	var archiveErr error
+	if db.archive != nil {
+		archiveErr = db.archive.Close()
 	}
+	return errors.Join(logErr, db.FileMgr.Close(), archiveErr)
 }
 
-func (db *DB) NewTx() *txn.Transaction {
+// NewTx starts a new transaction
+func (db *DB) NewTx() (*txn.Transaction, error) {
 	return txn.NewTransaction(db.FileMgr, db.Log, db.BufPool)
 }
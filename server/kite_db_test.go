@@ -0,0 +1,73 @@
+package server_test
+
+import (
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/server"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var (
+	blockTestSize int64 = 400
+	filename            = "testFile"
+)
+
+func newTx(t *testing.T, db *server.DB) *txn.Transaction {
+	tx, err := db.NewTx()
+	assert.NoError(t, err)
+	return tx
+}
+
+// appendBlocks appends the blocks 0 and 1 of filename, used by setData and verifyData
+func appendBlocks(t *testing.T, db *server.DB) {
+	tx := newTx(t, db)
+	for i := 0; i < 2; i++ {
+		_, err := tx.Append(filename)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tx.Commit())
+}
+
+func setData(t *testing.T, db *server.DB, b0Data []int64, b1Data []int64, str1 string, str2 string) (*txn.Transaction, *txn.Transaction) {
+	block0 := file.GetBlock(filename, 0)
+	block1 := file.GetBlock(filename, 1)
+	tx1 := newTx(t, db)
+	tx2 := newTx(t, db)
+	tx1.Pin(block0)
+	tx2.Pin(block1)
+
+	var pos int64 = 0
+	for i := 0; i < len(b0Data); i++ {
+		tx1.SetInt(block0, pos, int(b0Data[i]), true)
+		tx2.SetInt(block1, pos, int(b1Data[i]), true)
+		pos += file.IntSize
+	}
+	tx1.SetString(block0, 60, str1, true)
+	tx2.SetString(block1, 60, str2, true)
+	return tx1, tx2
+}
+
+func verifyData(t *testing.T, db *server.DB, b0Data []int64, b1Data []int64, str1 string, str2 string) {
+	fm := db.FileMgr
+	page0 := file.NewPageWithSize(fm.BlockSize)
+	page1 := file.NewPageWithSize(fm.BlockSize)
+
+	block0 := file.GetBlock(filename, 0)
+	block1 := file.GetBlock(filename, 1)
+	fm.Read(block0, page0)
+	fm.Read(block1, page1)
+	var pos int64 = 0
+	for i := 0; i < len(b0Data); i++ {
+		val, _ := page0.GetInt(pos)
+		assert.Equal(t, b0Data[i], val)
+		val, _ = page1.GetInt(pos)
+		assert.Equal(t, b1Data[i], val)
+		pos += file.IntSize
+	}
+
+	val, _ := page0.GetString(60)
+	assert.Equal(t, str1, val)
+	val, _ = page1.GetString(60)
+	assert.Equal(t, str2, val)
+}
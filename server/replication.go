@@ -0,0 +1,468 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/naveen246/kite-db/wal"
+	"github.com/sasha-s/go-deadlock"
+	"io"
+	log2 "log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+A primary DB streams the records of its log to follower DBs over TCP, and each follower applies them
+to its own data files (see txn.Applier). The followers serve read-only transactions.
+
+A follower connects to the primary and sends the LSN to stream from (8 bytes).
+The primary then sends every record of its log with an LSN >= that LSN, followed by the records appended later,
+each record in a message. When there are no new records, the primary sends heartbeats, which are messages with LSN 0.
+If the records from the requested LSN are no longer in the log (its segments were removed after a checkpoint,
+see wal.Log.FirstLSN), the primary sends an error message, a message with LSN 0 whose record is the reason,
+and closes the connection. The follower then stops with wal.ErrLogRemoved.
+Only records that were flushed are sent, the primary does not flush its log to send them
+(see wal.Log.FlushedIterator), so with async commit the records are sent after the background flush.
+
++=========+============+========+==============+
+| LSN     | primaryLSN | length | record       |
++=========+============+========+==============+
+| 8 bytes | 8 bytes    | 4 bytes| length bytes |
++---------+------------+--------+--------------+
+
+primaryLSN is the latest LSN of the primary log when the message is sent, the follower uses it to report its lag.
+
+The follower saves the position it reached in its ReplicaStateFile after every primary transaction it applies,
+and resumes streaming from there when it is opened again. A new follower starts from an empty DB directory
+and streams the primary log from its first record, so the primary must still have all its log segments.
+A follower seeded from a backup of the primary (see NewFollowerFromBackup) starts from the data files of the backup
+and streams the primary log from the Start record of the oldest transaction running when the backup started.
+*/
+
+// ReplicaStateFile is the file of a follower that holds the position it reached in the primary log
+const ReplicaStateFile = "replica_state"
+
+const (
+	// walPollInterval is how often the primary checks its log for new flushed records to send
+	walPollInterval = 10 * time.Millisecond
+	// messageHeaderSize is the size of the LSN, primaryLSN and length of a message
+	messageHeaderSize = 2*file.IntSize + file.Int32Size
+)
+
+// WALServer streams the log of a primary DB to its followers
+type WALServer struct {
+	db       *DB
+	listener net.Listener
+
+	mu     deadlock.Mutex
+	conns  map[net.Conn]bool
+	closed chan struct{}
+	wg     sync.WaitGroup
+}
+
+// ServeWAL listens on the TCP address addr and streams the log of the DB to the followers that connect to it,
+// until Close is called. Use port 0 to listen on any free port, see Addr.
+func (db *DB) ServeWAL(addr string) (*WALServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &WALServer{
+		db:       db,
+		listener: listener,
+		conns:    make(map[net.Conn]bool),
+		closed:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the WALServer listens on
+func (s *WALServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops listening and disconnects the followers
+func (s *WALServer) Close() error {
+	s.mu.Lock()
+	close(s.closed)
+	err := s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *WALServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		select {
+		case <-s.closed:
+			s.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			err := s.stream(conn)
+			if err != nil && !errors.Is(err, net.ErrClosed) {
+				log2.Printf("Stopped streaming log to %v: %v\n", conn.RemoteAddr(), err)
+			}
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// stream sends the records of the log from the LSN requested by the follower, then the records appended later
+func (s *WALServer) stream(conn net.Conn) error {
+	request := make([]byte, file.IntSize)
+	_, err := io.ReadFull(conn, request)
+	if err != nil {
+		return err
+	}
+	next := int64(binary.BigEndian.Uint64(request))
+	checked := next - 1
+
+	log := s.db.Log
+	writer := bufio.NewWriter(conn)
+	first := log.FirstLSN()
+	if next < first {
+		reason := fmt.Sprintf("could not stream log from LSN %v, the log starts at LSN %v", next, first)
+		err = writeMessage(writer, 0, log.LatestLSN(), []byte(reason))
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%v: %w", reason, wal.ErrLogRemoved)
+	}
+	ticker := time.NewTicker(walPollInterval)
+	defer ticker.Stop()
+	for {
+		flushed := log.FlushedLSN()
+		if flushed > checked {
+			iter, err := log.FlushedIterator(next)
+			if err != nil {
+				return err
+			}
+			for iter.HasNext() {
+				record, err := iter.Next()
+				if err != nil {
+					return err
+				}
+				err = writeMessage(writer, iter.LSN(), log.LatestLSN(), record)
+				if err != nil {
+					return err
+				}
+				next = iter.LSN() + 1
+			}
+			checked = flushed
+		} else {
+			err = writeMessage(writer, 0, log.LatestLSN(), nil)
+			if err != nil {
+				return err
+			}
+		}
+		err = writer.Flush()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-s.closed:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func writeMessage(writer *bufio.Writer, lsn int64, primaryLSN int64, record []byte) error {
+	header := make([]byte, messageHeaderSize)
+	binary.BigEndian.PutUint64(header, uint64(lsn))
+	binary.BigEndian.PutUint64(header[file.IntSize:], uint64(primaryLSN))
+	binary.BigEndian.PutUint32(header[2*file.IntSize:], uint32(len(record)))
+	_, err := writer.Write(header)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(record)
+	return err
+}
+
+// Follower is a DB that applies the log records streamed by a primary DB (see ServeWAL),
+// and serves read-only transactions.
+type Follower struct {
+	DB      *DB
+	conn    net.Conn
+	applier *txn.Applier
+
+	// lastLSN is the LSN of the last record received from the primary,
+	// primaryLSN the latest LSN of the primary log when that record was sent
+	lastLSN    atomic.Int64
+	primaryLSN atomic.Int64
+
+	// seedLSN is saved with the position of the follower, see txn.NewApplier
+	seedLSN int64
+
+	mu      deadlock.Mutex
+	err     error
+	closing bool
+	done    chan struct{}
+}
+
+// NewFollower opens the DB in dbDir as a follower of the primary DB listening on primaryAddr.
+// The DB in dbDir must have been created by NewFollower or NewFollowerFromBackup, or be empty.
+func NewFollower(dbDir string, blockSize int64, bufferCount int, primaryAddr string, opts ...Option) (*Follower, error) {
+	db, err := NewDB(dbDir, blockSize, bufferCount, opts...)
+	if err != nil {
+		return nil, err
+	}
+	state, err := readReplicaState(db.FileMgr)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	conn, err := net.Dial("tcp", primaryAddr)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not connect to primary %v: %w", primaryAddr, err)
+	}
+	request := make([]byte, file.IntSize)
+	binary.BigEndian.PutUint64(request, uint64(state.resumeLSN))
+	_, err = conn.Write(request)
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, err
+	}
+
+	f := &Follower{
+		DB:      db,
+		conn:    conn,
+		applier: txn.NewApplier(db.FileMgr, db.Log, db.BufPool, state.appliedLSN, state.resumeLSN, state.seedLSN),
+		seedLSN: state.seedLSN,
+		done:    make(chan struct{}),
+	}
+	f.lastLSN.Store(state.resumeLSN - 1)
+	go f.receive()
+	return f, nil
+}
+
+// NewFollowerFromBackup creates a follower in dbDir, which must not hold any files, from the backup of the primary DB
+// in backupDir (see DB.Backup), and opens it like NewFollower. The follower streams the primary log from
+// the Start record of the oldest transaction running when the backup started, so a follower can be created
+// as long as the primary still has the log segment of that record.
+// The opts are those the primary DB was created with.
+func NewFollowerFromBackup(dbDir string, backupDir string, blockSize int64, bufferCount int, primaryAddr string, opts ...Option) (*Follower, error) {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	backup, err := file.NewFileMgr(backupDir, blockSize, append(cfg.fileOpts[:len(cfg.fileOpts):len(cfg.fileOpts)], file.WithReadOnly())...)
+	if err != nil {
+		return nil, err
+	}
+	defer backup.Close()
+	label, err := readBackupLabel(backup)
+	if err != nil {
+		return nil, err
+	}
+	err = copyBackup(backup, dbDir, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	fileMgr, err := file.NewFileMgr(dbDir, blockSize, cfg.fileOpts...)
+	if err != nil {
+		return nil, err
+	}
+	err = writeReplicaState(fileMgr, replicaState{appliedLSN: label.lsn, resumeLSN: label.startLSN, seedLSN: label.endLSN})
+	if err != nil {
+		fileMgr.Close()
+		return nil, err
+	}
+	err = fileMgr.Close()
+	if err != nil {
+		return nil, err
+	}
+	return NewFollower(dbDir, blockSize, bufferCount, primaryAddr, opts...)
+}
+
+// receive applies the records sent by the primary until the connection is closed
+func (f *Follower) receive() {
+	defer close(f.done)
+	reader := bufio.NewReader(f.conn)
+	header := make([]byte, messageHeaderSize)
+	for {
+		_, err := io.ReadFull(reader, header)
+		if err != nil {
+			f.stop(err)
+			return
+		}
+		lsn := int64(binary.BigEndian.Uint64(header))
+		f.primaryLSN.Store(int64(binary.BigEndian.Uint64(header[file.IntSize:])))
+		record := make([]byte, binary.BigEndian.Uint32(header[2*file.IntSize:]))
+		_, err = io.ReadFull(reader, record)
+		if err != nil {
+			f.stop(err)
+			return
+		}
+		if lsn == 0 && len(record) > 0 {
+			f.stop(fmt.Errorf("primary %v: %s: %w", f.conn.RemoteAddr(), record, wal.ErrLogRemoved))
+			return
+		}
+		if lsn == 0 {
+			continue
+		}
+		committed, err := f.applier.Apply(lsn, record)
+		if err == nil && committed {
+			err = writeReplicaState(f.DB.FileMgr, replicaState{f.applier.AppliedLSN(), f.applier.ResumeLSN(), f.seedLSN})
+		}
+		if err != nil {
+			f.stop(fmt.Errorf("could not apply log record at LSN %v: %w", lsn, err))
+			return
+		}
+		f.lastLSN.Store(lsn)
+	}
+}
+
+// stop records the error that stopped the replication, unless the follower is closing
+func (f *Follower) stop(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closing {
+		f.err = err
+		log2.Printf("Stopped following the primary: %v\n", err)
+	}
+}
+
+// Err returns the error that stopped the replication, nil while the follower is replicating
+func (f *Follower) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// NewReadOnlyTx starts a read-only transaction, which sees the primary transactions applied so far
+func (f *Follower) NewReadOnlyTx() (*txn.Transaction, error) {
+	return txn.NewReadOnlyTransaction(f.DB.FileMgr, f.DB.Log, f.DB.BufPool), nil
+}
+
+// LastLSN returns the LSN of the last primary log record applied by the follower
+func (f *Follower) LastLSN() int64 {
+	return f.lastLSN.Load()
+}
+
+// Lag returns how far the follower is behind the primary, in LSNs,
+// as of the last message received from the primary
+func (f *Follower) Lag() int64 {
+	return max(0, f.primaryLSN.Load()-f.lastLSN.Load())
+}
+
+// WaitForLSN waits until the follower has applied the primary log record at lsn, or timeout expires
+func (f *Follower) WaitForLSN(lsn int64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for f.lastLSN.Load() < lsn {
+		err := f.Err()
+		if err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("follower did not reach LSN %v in %v, it is at LSN %v", lsn, timeout, f.lastLSN.Load())
+		}
+		time.Sleep(walPollInterval)
+	}
+	return nil
+}
+
+// Close disconnects from the primary and closes the DB of the follower
+func (f *Follower) Close() error {
+	f.mu.Lock()
+	f.closing = true
+	f.mu.Unlock()
+	f.conn.Close()
+	<-f.done
+	return f.DB.Close()
+}
+
+// replicaState is the position of the follower in the primary log, see txn.NewApplier
+type replicaState struct {
+	appliedLSN int64
+	resumeLSN  int64
+	seedLSN    int64
+}
+
+// readReplicaState returns the position saved by writeReplicaState,
+// a new follower starts from the first record of the primary log
+func readReplicaState(fileMgr *file.FileMgr) (replicaState, error) {
+	blockCount, err := fileMgr.BlockCount(ReplicaStateFile)
+	if err != nil || blockCount == 0 {
+		return replicaState{}, err
+	}
+	page := file.NewPageWithSize(fileMgr.BlockSize)
+	err = fileMgr.Read(file.GetBlock(ReplicaStateFile, 0), page)
+	if err != nil {
+		return replicaState{}, err
+	}
+	var lsns [3]int64
+	for i := range lsns {
+		lsns[i], err = page.GetInt(int64(i) * file.IntSize)
+		if err != nil {
+			return replicaState{}, err
+		}
+	}
+	return replicaState{appliedLSN: lsns[0], resumeLSN: lsns[1], seedLSN: lsns[2]}, nil
+}
+
+// writeReplicaState saves the position of the follower in the primary log
+func writeReplicaState(fileMgr *file.FileMgr, state replicaState) error {
+	page := file.NewPageWithSize(fileMgr.BlockSize)
+	for i, lsn := range []int64{state.appliedLSN, state.resumeLSN, state.seedLSN} {
+		err := page.SetInt(int64(i)*file.IntSize, lsn)
+		if err != nil {
+			return err
+		}
+	}
+
+	block := file.GetBlock(ReplicaStateFile, 0)
+	blockCount, err := fileMgr.BlockCount(ReplicaStateFile)
+	if err != nil {
+		return err
+	}
+	if blockCount == 0 {
+		block, err = fileMgr.Append(ReplicaStateFile)
+		if err != nil {
+			return err
+		}
+	}
+	err = fileMgr.Write(block, page)
+	if err != nil {
+		return err
+	}
+	return fileMgr.Sync(ReplicaStateFile)
+}
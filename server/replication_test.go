@@ -0,0 +1,157 @@
+package server_test
+
+import (
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/server"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/naveen246/kite-db/wal"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplication(t *testing.T) {
+	primary, err := server.NewDB(t.TempDir(), blockTestSize, 8)
+	assert.NoError(t, err)
+	defer primary.Close()
+	walServer, err := primary.ServeWAL("127.0.0.1:0")
+	assert.NoError(t, err)
+	defer walServer.Close()
+
+	followerDir := t.TempDir()
+	follower, err := server.NewFollower(followerDir, blockTestSize, 8, walServer.Addr().String())
+	assert.NoError(t, err)
+
+	initial := []int64{0, 1, 2, 3, 4, 5}
+	appendBlocks(t, primary)
+	tx1, tx2 := setData(t, primary, initial, initial, "abc", "def")
+	assert.NoError(t, tx1.Commit())
+	assert.NoError(t, tx2.Commit())
+
+	assert.NoError(t, follower.WaitForLSN(tx2.CommitLSN(), 5*time.Second))
+	verifyData(t, follower.DB, initial, initial, "abc", "def")
+
+	readTx, err := follower.NewReadOnlyTx()
+	assert.NoError(t, err)
+	block0 := file.GetBlock(filename, 0)
+	readTx.Pin(block0)
+	val, err := readTx.GetInt(block0, file.IntSize)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, val)
+	str, err := readTx.GetString(block0, 60)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", str)
+	assert.ErrorIs(t, readTx.SetInt(block0, 0, 100, true), txn.ErrReadOnlyTx)
+	_, err = readTx.Append(filename)
+	assert.ErrorIs(t, err, txn.ErrReadOnlyTx)
+	assert.ErrorIs(t, readTx.CreateFile("otherfile"), txn.ErrReadOnlyTx)
+	assert.NoError(t, readTx.Commit())
+
+	// the changes of a transaction that rolls back are not applied
+	data1 := []int64{10, 11, 12, 13, 14, 15}
+	tx3, tx4 := setData(t, primary, data1, data1, "ghi", "jkl")
+	assert.NoError(t, tx3.Rollback())
+	assert.NoError(t, tx4.Commit())
+	assert.NoError(t, follower.WaitForLSN(tx4.CommitLSN(), 5*time.Second))
+	verifyData(t, follower.DB, initial, data1, "abc", "jkl")
+	assert.Eventually(t, func() bool {
+		return follower.Lag() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, follower.Err())
+	assert.NoError(t, follower.Close())
+
+	// a follower that restarts resumes from where it stopped
+	data2 := []int64{20, 21, 22, 23, 24, 25}
+	tx5, tx6 := setData(t, primary, data2, data2, "mno", "pqr")
+	assert.NoError(t, tx5.Commit())
+	assert.NoError(t, tx6.Commit())
+	follower, err = server.NewFollower(followerDir, blockTestSize, 8, walServer.Addr().String())
+	assert.NoError(t, err)
+	defer follower.Close()
+	assert.Greater(t, follower.LastLSN(), tx2.CommitLSN())
+	assert.NoError(t, follower.WaitForLSN(tx6.CommitLSN(), 5*time.Second))
+	verifyData(t, follower.DB, data2, data2, "mno", "pqr")
+}
+
+func TestReplicationLogRemoved(t *testing.T) {
+	primary, err := server.NewDB(t.TempDir(), blockTestSize, 8, server.WithLogSegmentSize(2))
+	assert.NoError(t, err)
+	defer primary.Close()
+	appendBlocks(t, primary)
+	for i := 0; i < 5; i++ {
+		tx1, tx2 := setData(t, primary, []int64{0, 1, 2, 3, 4, 5}, []int64{0, 1, 2, 3, 4, 5}, "abc", "def")
+		assert.NoError(t, tx1.Commit())
+		assert.NoError(t, tx2.Commit())
+	}
+
+	// the checkpoint of recover removes the first segments of the log
+	tx := newTx(t, primary)
+	assert.NoError(t, tx.Recover())
+	assert.NoError(t, tx.Commit())
+	assert.Greater(t, primary.Log.FirstLSN(), int64(0))
+
+	// a new follower needs the log from its first record
+	walServer, err := primary.ServeWAL("127.0.0.1:0")
+	assert.NoError(t, err)
+	defer walServer.Close()
+	follower, err := server.NewFollower(t.TempDir(), blockTestSize, 8, walServer.Addr().String())
+	assert.NoError(t, err)
+	defer follower.Close()
+	err = follower.WaitForLSN(primary.Log.LatestLSN(), 5*time.Second)
+	assert.ErrorIs(t, err, wal.ErrLogRemoved)
+	assert.ErrorIs(t, follower.Err(), wal.ErrLogRemoved)
+}
+
+func TestFollowerFromBackup(t *testing.T) {
+	dir := t.TempDir()
+	opts := []server.Option{server.WithLogSegmentSize(2)}
+	primary, err := server.NewDB(filepath.Join(dir, "primary"), blockTestSize, 8, opts...)
+	assert.NoError(t, err)
+	defer primary.Close()
+	appendBlocks(t, primary)
+	initial := []int64{0, 1, 2, 3, 4, 5}
+	for i := 0; i < 5; i++ {
+		tx1, tx2 := setData(t, primary, initial, initial, "abc", "def")
+		assert.NoError(t, tx1.Commit())
+		assert.NoError(t, tx2.Commit())
+	}
+	tx := newTx(t, primary)
+	assert.NoError(t, tx.Recover())
+	assert.NoError(t, tx.Commit())
+	assert.Greater(t, primary.Log.FirstLSN(), int64(0))
+
+	// tx1 and tx2 are running during the backup, their changes are in the backup
+	// but only those of tx2 are applied, as tx1 rolls back
+	data1 := []int64{10, 11, 12, 13, 14, 15}
+	tx1, tx2 := setData(t, primary, data1, data1, "ghi", "jkl")
+	assert.NoError(t, primary.BufPool.FlushAll(int64(tx1.TxNum)))
+	assert.NoError(t, primary.BufPool.FlushAll(int64(tx2.TxNum)))
+	backupDir := filepath.Join(dir, "backup")
+	backupLSN, err := primary.Backup(backupDir)
+	assert.NoError(t, err)
+	assert.NoError(t, tx1.Rollback())
+	assert.NoError(t, tx2.Commit())
+	assert.Greater(t, tx2.CommitLSN(), backupLSN)
+
+	walServer, err := primary.ServeWAL("127.0.0.1:0")
+	assert.NoError(t, err)
+	defer walServer.Close()
+	followerDir := filepath.Join(dir, "follower")
+	follower, err := server.NewFollowerFromBackup(followerDir, backupDir, blockTestSize, 8, walServer.Addr().String(), opts...)
+	assert.NoError(t, err)
+	assert.NoError(t, follower.WaitForLSN(tx2.CommitLSN(), 5*time.Second))
+	verifyData(t, follower.DB, initial, data1, "abc", "jkl")
+	assert.NoError(t, follower.Close())
+
+	// the seeded follower resumes from where it stopped
+	data2 := []int64{20, 21, 22, 23, 24, 25}
+	tx3, tx4 := setData(t, primary, data2, data2, "mno", "pqr")
+	assert.NoError(t, tx3.Commit())
+	assert.NoError(t, tx4.Commit())
+	follower, err = server.NewFollower(followerDir, blockTestSize, 8, walServer.Addr().String(), opts...)
+	assert.NoError(t, err)
+	defer follower.Close()
+	assert.NoError(t, follower.WaitForLSN(tx4.CommitLSN(), 5*time.Second))
+	verifyData(t, follower.DB, data2, data2, "mno", "pqr")
+}
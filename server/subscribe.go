@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/naveen246/kite-db/wal"
+	"github.com/sasha-s/go-deadlock"
+	"time"
+)
+
+// Subscription delivers the transactions committed in a DB, see DB.Subscribe
+type Subscription struct {
+	// C receives the committed transactions in the order they committed, it is closed when the subscription ends
+	C <-chan txn.CommittedTx
+
+	db      *DB
+	fromLSN int64
+	ch      chan txn.CommittedTx
+
+	mu     deadlock.Mutex
+	err    error
+	closed chan struct{}
+	done   chan struct{}
+}
+
+// Subscribe delivers every transaction committed after fromLSN to the C channel of the Subscription,
+// with the values it changed (see txn.ChangeFeed). The transactions that roll back are skipped.
+// To resume after a restart, pass the CommitLSN of the last transaction processed.
+// Returns wal.ErrLogRemoved if fromLSN is older than the first LSN of the log, whose older segments were removed after a checkpoint,
+// the subscription ends with the same error if a transaction committed after fromLSN started in the removed segments.
+// So fromLSN 0 gets every transaction committed since the DB was created, as long as no segment was removed (see wal.Log.FirstLSN).
+// Pass the LatestLSN of the log to only get the transactions committed from now on.
+// Only the transactions whose Commit record was flushed are delivered, the log is not flushed to deliver them
+// (see wal.Log.FlushedIterator), so with async commit they are delivered after the background flush.
+// The Subscription must be closed before the DB.
+func (db *DB) Subscribe(fromLSN int64) (*Subscription, error) {
+	if fromLSN < 0 {
+		return nil, fmt.Errorf("invalid LSN %v to subscribe from", fromLSN)
+	}
+	first := db.Log.FirstLSN()
+	if fromLSN < first {
+		return nil, fmt.Errorf("could not subscribe from LSN %v, the log starts at LSN %v: %w", fromLSN, first, wal.ErrLogRemoved)
+	}
+	ch := make(chan txn.CommittedTx)
+	s := &Subscription{
+		C:       ch,
+		db:      db,
+		fromLSN: fromLSN,
+		ch:      ch,
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Err returns the error that ended the subscription, nil if it is running or was closed
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription and closes C, returns the error that ended it before Close if any
+func (s *Subscription) Close() error {
+	close(s.closed)
+	<-s.done
+	return s.Err()
+}
+
+// run reads the flushed records of the log from its start and delivers the committed transactions
+// until the subscription is closed
+func (s *Subscription) run() {
+	defer close(s.done)
+	defer close(s.ch)
+
+	log := s.db.Log
+	feed := txn.NewChangeFeed(s.fromLSN)
+	var next int64
+	var checked int64 = -1
+	ticker := time.NewTicker(walPollInterval)
+	defer ticker.Stop()
+	for {
+		flushed := log.FlushedLSN()
+		if flushed > checked {
+			iter, err := log.FlushedIterator(next)
+			if err != nil {
+				s.stop(err)
+				return
+			}
+			for iter.HasNext() {
+				record, err := iter.Next()
+				if err != nil {
+					s.stop(err)
+					return
+				}
+				tx, err := feed.Add(iter.LSN(), record)
+				if err != nil {
+					s.stop(fmt.Errorf("could not read log record at LSN %v: %w", iter.LSN(), err))
+					return
+				}
+				next = iter.LSN() + 1
+				if tx == nil {
+					continue
+				}
+				select {
+				case s.ch <- *tx:
+				case <-s.closed:
+					return
+				}
+			}
+			checked = flushed
+		}
+
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Subscription) stop(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
@@ -0,0 +1,143 @@
+package server_test
+
+import (
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/server"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/naveen246/kite-db/wal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func receiveTx(t *testing.T, sub *server.Subscription) txn.CommittedTx {
+	select {
+	case tx, ok := <-sub.C:
+		assert.True(t, ok)
+		return tx
+	case <-time.After(5 * time.Second):
+		t.Fatal("no committed transaction received")
+		return txn.CommittedTx{}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	db, err := server.NewDB(t.TempDir(), blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Subscribe(-1)
+	assert.Error(t, err)
+
+	// the transaction that only appends blocks does not change any value
+	appendBlocks(t, db)
+	initial := []int64{0, 1, 2, 3, 4, 5}
+	tx1, tx2 := setData(t, db, initial, initial, "abc", "def")
+	assert.NoError(t, tx1.Rollback())
+	assert.NoError(t, tx2.Commit())
+
+	sub, err := db.Subscribe(0)
+	assert.NoError(t, err)
+	committed := receiveTx(t, sub)
+	assert.Equal(t, tx2.TxNum, committed.TxNum)
+	assert.Equal(t, tx2.CommitLSN(), committed.CommitLSN)
+	assert.False(t, committed.CommitTime.IsZero())
+	assert.Len(t, committed.Changes, len(initial)+1)
+	block1 := file.GetBlock(filename, 1)
+	change := committed.Changes[1]
+	assert.Equal(t, block1, change.Block)
+	assert.Equal(t, int64(file.IntSize), change.Offset)
+	assert.Equal(t, 0, change.OldValue)
+	assert.Equal(t, 1, change.NewValue)
+	change = committed.Changes[len(initial)]
+	assert.Equal(t, int64(60), change.Offset)
+	assert.Equal(t, "", change.OldValue)
+	assert.Equal(t, "def", change.NewValue)
+	for i := 1; i < len(committed.Changes); i++ {
+		assert.Greater(t, committed.Changes[i].LSN, committed.Changes[i-1].LSN)
+	}
+
+	// transactions committed after Subscribe are delivered in commit order
+	data := []int64{10, 11, 12, 13, 14, 15}
+	tx3, tx4 := setData(t, db, data, data, "ghi", "jkl")
+	assert.NoError(t, tx4.Commit())
+	assert.NoError(t, tx3.Commit())
+	committed = receiveTx(t, sub)
+	assert.Equal(t, tx4.TxNum, committed.TxNum)
+	assert.Equal(t, 1, committed.Changes[1].OldValue)
+	assert.Equal(t, 11, committed.Changes[1].NewValue)
+	committed = receiveTx(t, sub)
+	assert.Equal(t, tx3.TxNum, committed.TxNum)
+	assert.Equal(t, "", committed.Changes[len(data)].OldValue)
+	assert.Equal(t, "ghi", committed.Changes[len(data)].NewValue)
+	assert.NoError(t, sub.Close())
+	_, ok := <-sub.C
+	assert.False(t, ok)
+
+	// resume after the first transaction processed
+	sub, err = db.Subscribe(tx2.CommitLSN())
+	assert.NoError(t, err)
+	defer sub.Close()
+	assert.Equal(t, tx4.TxNum, receiveTx(t, sub).TxNum)
+	assert.Equal(t, tx3.TxNum, receiveTx(t, sub).TxNum)
+	assert.NoError(t, sub.Err())
+}
+
+func TestSubscribeAfterCrash(t *testing.T) {
+	db, err := server.NewDB(t.TempDir(), blockTestSize, 8, server.WithLogSegmentSize(2), server.WithAsyncCommit(time.Hour))
+	assert.NoError(t, err)
+	defer db.Close()
+	appendBlocks(t, db)
+	initial := []int64{0, 1, 2, 3, 4, 5}
+	for i := 0; i < 5; i++ {
+		tx1, tx2 := setData(t, db, initial, initial, "abc", "def")
+		assert.NoError(t, tx1.Commit())
+		assert.NoError(t, tx2.Commit())
+	}
+
+	// tx1 does not finish, the DB crashes and the checkpoint of recover removes the first segments of the log
+	block := file.GetBlock(filename, 0)
+	tx1 := newTx(t, db)
+	tx1.Pin(block)
+	assert.NoError(t, tx1.SetInt(block, 0, 5, true))
+	tx1.ReleaseLocks()
+	tx := newTx(t, db)
+	assert.NoError(t, tx.Recover())
+	assert.NoError(t, tx.Commit())
+	first := db.Log.FirstLSN()
+	assert.Greater(t, first, int64(0))
+	_, err = db.Subscribe(0)
+	assert.ErrorIs(t, err, wal.ErrLogRemoved)
+	_, err = db.Subscribe(first - 1)
+	assert.ErrorIs(t, err, wal.ErrLogRemoved)
+
+	// a transaction committed after first started in the removed segments, so its changes cannot be delivered
+	sub, err := db.Subscribe(first)
+	assert.NoError(t, err)
+	for range sub.C {
+	}
+	assert.ErrorIs(t, sub.Err(), wal.ErrLogRemoved)
+	assert.ErrorIs(t, sub.Close(), wal.ErrLogRemoved)
+
+	// the changes of tx1 are dropped at the CheckPoint, the subscription from the latest LSN gets the next transactions
+	sub, err = db.Subscribe(db.Log.LatestLSN())
+	assert.NoError(t, err)
+	defer sub.Close()
+	tx3 := newTx(t, db)
+	tx3.Pin(block)
+	assert.NoError(t, tx3.SetInt(block, 0, 7, true))
+	assert.NoError(t, tx3.Commit())
+
+	// the subscription does not flush the log, the commit of tx3 is delivered once it is flushed
+	select {
+	case <-sub.C:
+		assert.Fail(t, "transaction delivered before its Commit record was flushed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Less(t, db.Log.FlushedLSN(), tx3.CommitLSN())
+	assert.NoError(t, db.Log.Flush(tx3.CommitLSN()))
+	committed := receiveTx(t, sub)
+	assert.Equal(t, tx3.TxNum, committed.TxNum)
+	assert.Len(t, committed.Changes, 1)
+	assert.Equal(t, 7, committed.Changes[0].NewValue)
+	assert.NoError(t, sub.Err())
+}
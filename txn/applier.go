@@ -0,0 +1,242 @@
+package txn
+
+import (
+	"errors"
+	"github.com/naveen246/kite-db/buffer"
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/wal"
+	"math"
+	"time"
+)
+
+/*
+An Applier applies the log records of a primary DB to the data files of a follower DB (see server.Follower).
+
+The records of a transaction are kept until its Commit record arrives, then all its changes are redone
+in a single transaction of the follower, so the read-only transactions of the follower only see committed changes.
+The records of a transaction that rolls back, or that had not finished when the primary crashed
+(its records are followed by the CheckPoint record of the recovery), are discarded. Since transactions are applied in the order
+they committed on the primary, which is the order their locks serialized them in, the follower
+goes through the same states as the primary.
+
+The applying transaction locks all the blocks of the primary transaction before changing any of them.
+If a read-only transaction holds one of the locks, the locks are released and requested again a bit later,
+so the changes of a primary transaction are never seen half applied.
+
+A follower seeded from a backup of the primary (see server.NewFollowerFromBackup) starts with data files
+that may hold changes of transactions that were running while the backup was taken. The records of such a transaction
+that commits are all redone, and the changes of such a transaction that rolls back or does not finish are undone:
+the records it wrote up to seedLSN, the latest LSN of the primary log when the backup ended, are undone
+when its Rollback record (or the CheckPoint record) arrives.
+*/
+
+// applyRetryDelay is how long the Applier waits before requesting the locks again
+const applyRetryDelay = 10 * time.Millisecond
+
+// Applier applies the records of a primary log to a follower DB, see above
+type Applier struct {
+	fileMgr *file.FileMgr
+	log     *wal.Log
+	bufPool *buffer.BufferPool
+
+	// the records of the primary transactions that have not finished, in the order they were written
+	active map[TxID][]loggedRecord
+
+	// appliedLSN is the LSN of the last Commit record applied, lastLSN the LSN of the last record passed to Apply
+	appliedLSN int64
+	lastLSN    int64
+
+	// seedLSN is the latest LSN of the primary log when the backup the follower was seeded from ended, 0 if it was not seeded
+	seedLSN int64
+}
+
+// NewApplier creates an Applier that changes the files of fileMgr through transactions logged in log.
+// A follower that restarts passes the AppliedLSN and ResumeLSN returned before it stopped,
+// and streams the primary log from resumeLSN, the transactions committed at or before appliedLSN are skipped.
+// seedLSN is 0 unless the follower was seeded from a backup, see above.
+func NewApplier(fileMgr *file.FileMgr, log *wal.Log, bufPool *buffer.BufferPool, appliedLSN int64, resumeLSN int64, seedLSN int64) *Applier {
+	return &Applier{
+		fileMgr:    fileMgr,
+		log:        log,
+		bufPool:    bufPool,
+		active:     make(map[TxID][]loggedRecord),
+		appliedLSN: appliedLSN,
+		lastLSN:    resumeLSN - 1,
+		seedLSN:    seedLSN,
+	}
+}
+
+// Apply processes the record at lsn of the primary log, the records must be passed in LSN order.
+// Returns true if the record committed a primary transaction, whose changes are now applied.
+func (a *Applier) Apply(lsn int64, bytes []byte) (bool, error) {
+	record, err := createLogRecord(bytes)
+	if err != nil {
+		return false, err
+	}
+	a.lastLSN = lsn
+
+	txNum := record.txNumber()
+	switch record.recordType() {
+	case CheckPoint:
+		// written by recover once it rolled back the transactions that did not finish when the primary crashed
+		if lsn > a.appliedLSN {
+			err = a.rollback(unfinishedRecords(a.active))
+		}
+		clear(a.active)
+	case Commit:
+		records := a.active[txNum]
+		delete(a.active, txNum)
+		if lsn <= a.appliedLSN {
+			// applied before the follower restarted
+			return false, nil
+		}
+		err = a.commit(records)
+		if err != nil {
+			return false, err
+		}
+		a.appliedLSN = lsn
+		return true, nil
+	case Rollback:
+		// a transaction that rolled back at or before appliedLSN was undone on the primary before the follower's files
+		// were seeded or before the follower restarted, undoing it again could overwrite a later commit
+		if lsn > a.appliedLSN {
+			err = a.rollback(a.active[txNum])
+		}
+		delete(a.active, txNum)
+	default:
+		a.active[txNum] = append(a.active[txNum], loggedRecord{lsn, record})
+	}
+	return false, err
+}
+
+// commit redoes the records of a committed primary transaction in a transaction of the follower
+func (a *Applier) commit(records []loggedRecord) error {
+	return a.run(records, func(tx *Transaction) error {
+		return tx.redoCommitted(records, math.MaxInt64)
+	})
+}
+
+// rollback undoes the changes of primary transactions that did not commit and may be in the files of a seeded follower:
+// the records written up to seedLSN, whose block exists. A follower that was not seeded never applied them.
+func (a *Applier) rollback(records []loggedRecord) error {
+	var seeded []loggedRecord
+	for _, logged := range records {
+		if logged.lsn > a.seedLSN {
+			continue
+		}
+		exists, err := a.blockExists(logged.record)
+		if err != nil {
+			return err
+		}
+		if exists {
+			seeded = append(seeded, logged)
+		}
+	}
+	if len(seeded) == 0 {
+		return nil
+	}
+	return a.run(seeded, func(tx *Transaction) error {
+		return undoRecords(tx, seeded)
+	})
+}
+
+// blockExists reports whether the block changed by a SetInt or SetString record is in the files of the follower,
+// it is true for the other records
+func (a *Applier) blockExists(record LogRecord) (bool, error) {
+	var block file.Block
+	switch r := record.(type) {
+	case *SetIntRecord:
+		block = r.block
+	case *SetStringRecord:
+		block = r.block
+	default:
+		return true, nil
+	}
+	blockCount, err := a.fileMgr.BlockCount(block.Filename)
+	if err != nil {
+		return false, err
+	}
+	return block.Number < blockCount, nil
+}
+
+// run calls apply in a transaction of the follower that holds the locks of the records,
+// and commits it
+func (a *Applier) run(records []loggedRecord, apply func(tx *Transaction) error) error {
+	for {
+		tx, err := NewTransaction(a.fileMgr, a.log, a.bufPool)
+		if err != nil {
+			return err
+		}
+		err = tx.lockRecords(records)
+		if errors.Is(err, ErrLockAbort) {
+			err = tx.Rollback()
+			if err != nil {
+				return err
+			}
+			time.Sleep(applyRetryDelay)
+			continue
+		}
+		if err == nil {
+			err = apply(tx)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+}
+
+// lockRecords Obtain an xLock on the blocks changed by the records and on the "end of the file" of their files
+func (tx *Transaction) lockRecords(records []loggedRecord) error {
+	for _, logged := range records {
+		var filename string
+		switch r := logged.record.(type) {
+		case *SetIntRecord:
+			filename = r.block.Filename
+			err := tx.concurMgr.xLock(r.block, tx.TxNum)
+			if err != nil {
+				return err
+			}
+		case *SetStringRecord:
+			filename = r.block.Filename
+			err := tx.concurMgr.xLock(r.block, tx.TxNum)
+			if err != nil {
+				return err
+			}
+		case *CreateFileRecord:
+			filename = r.filename
+		case *DropFileRecord:
+			filename = r.filename
+		case *TruncateFileRecord:
+			filename = r.filename
+		default:
+			continue
+		}
+		err := tx.concurMgr.xLock(file.GetBlock(filename, EndOfFile), tx.TxNum)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppliedLSN returns the LSN of the Commit record of the last primary transaction applied
+func (a *Applier) AppliedLSN() int64 {
+	return a.appliedLSN
+}
+
+// LastLSN returns the LSN of the last record passed to Apply
+func (a *Applier) LastLSN() int64 {
+	return a.lastLSN
+}
+
+// ResumeLSN returns the LSN to stream the primary log from when the follower restarts:
+// the first record of the oldest primary transaction that has not finished, or the record after the last one applied.
+func (a *Applier) ResumeLSN() int64 {
+	resumeLSN := a.lastLSN + 1
+	for _, records := range a.active {
+		resumeLSN = min(resumeLSN, records[0].lsn)
+	}
+	return resumeLSN
+}
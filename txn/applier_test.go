@@ -0,0 +1,53 @@
+package txn_test
+
+import (
+	"github.com/naveen246/kite-db/server"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestApplierCheckPoint(t *testing.T) {
+	primary, err := server.NewDB(t.TempDir(), blockTestSize, 8)
+	assert.NoError(t, err)
+	defer primary.Close()
+	tx := newTx(t, primary)
+	block, err := tx.Append(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+
+	// tx1 does not finish, the primary crashes and recover rolls it back
+	tx1 := newTx(t, primary)
+	tx1.Pin(block)
+	assert.NoError(t, tx1.SetInt(block, 0, 5, true))
+	tx1.ReleaseLocks()
+	tx2 := newTx(t, primary)
+	assert.NoError(t, tx2.Recover())
+	assert.NoError(t, tx2.Commit())
+	tx3 := newTx(t, primary)
+	tx3.Pin(block)
+	assert.NoError(t, tx3.SetInt(block, 0, 7, true))
+	assert.NoError(t, tx3.Commit())
+
+	follower, err := server.NewDB(t.TempDir(), blockTestSize, 8)
+	assert.NoError(t, err)
+	defer follower.Close()
+	applier := txn.NewApplier(follower.FileMgr, follower.Log, follower.BufPool, 0, 0, 0)
+	iter, err := primary.Log.ForwardIterator(0)
+	assert.NoError(t, err)
+	for iter.HasNext() {
+		record, err := iter.Next()
+		assert.NoError(t, err)
+		_, err = applier.Apply(iter.LSN(), record)
+		assert.NoError(t, err)
+	}
+
+	// the records of tx1 are dropped at the CheckPoint, they do not hold back where the follower resumes
+	assert.Equal(t, applier.LastLSN()+1, applier.ResumeLSN())
+	readTx := newTx(t, follower)
+	readTx.Pin(block)
+	val, err := readTx.GetInt(block, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, val)
+	assert.NoError(t, readTx.Commit())
+}
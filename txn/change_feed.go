@@ -0,0 +1,97 @@
+package txn
+
+import (
+	"fmt"
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/wal"
+	"time"
+)
+
+/*
+A ChangeFeed turns the records of a log into the committed transactions and the values they changed,
+for consumers that keep a copy of the data elsewhere (see server.DB.Subscribe).
+
+The changes of a transaction are kept until its Commit record, so transactions are emitted in the order they committed,
+and the changes of the transactions that roll back or do not finish are never emitted.
+A transaction that had not finished when the DB crashed is dropped at the CheckPoint record written by recover.
+Only the SetInt and SetString changes are emitted, the transactions that did not change any value are skipped.
+
+A consumer resumes by passing the CommitLSN of the last transaction it processed as fromLSN,
+the log is still read from its start since a transaction committed after fromLSN may have changed values before it.
+If the first segments of the log were removed, a transaction committed after fromLSN may have started in them,
+its changes cannot all be emitted, so Add returns wal.ErrLogRemoved when it commits.
+*/
+
+// Change is a value changed by a committed transaction. OldValue and NewValue are an int or a string.
+type Change struct {
+	LSN      int64
+	Block    file.Block
+	Offset   int64
+	OldValue any
+	NewValue any
+}
+
+// CommittedTx is a committed transaction along with its changes, in the order they were made
+type CommittedTx struct {
+	TxNum      TxID
+	CommitLSN  int64
+	CommitTime time.Time
+	Changes    []Change
+}
+
+// ChangeFeed collects the changes of the transactions from the records of a log, see above
+type ChangeFeed struct {
+	fromLSN int64
+
+	// the changes of the transactions that have not finished, from their Start record
+	active map[TxID][]Change
+}
+
+// NewChangeFeed creates a ChangeFeed that emits the transactions committed after fromLSN
+func NewChangeFeed(fromLSN int64) *ChangeFeed {
+	return &ChangeFeed{
+		fromLSN: fromLSN,
+		active:  make(map[TxID][]Change),
+	}
+}
+
+// Add processes the record at lsn of the log, the records must be passed in LSN order from the start of the log.
+// Returns the transaction committed by the record, or nil if the record does not commit a transaction to emit.
+func (f *ChangeFeed) Add(lsn int64, bytes []byte) (*CommittedTx, error) {
+	record, err := createLogRecord(bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	txNum := record.txNumber()
+	switch r := record.(type) {
+	case *CheckpointRecord:
+		clear(f.active)
+	case *StartRecord:
+		f.active[txNum] = nil
+	case *SetIntRecord:
+		f.addChange(txNum, Change{lsn, r.block, r.offset, r.oldVal, r.newVal})
+	case *SetStringRecord:
+		f.addChange(txNum, Change{lsn, r.block, r.offset, r.oldVal, r.newVal})
+	case *RollbackRecord:
+		delete(f.active, txNum)
+	case *CommitRecord:
+		changes, started := f.active[txNum]
+		delete(f.active, txNum)
+		if lsn > f.fromLSN && !started {
+			return nil, fmt.Errorf("transaction %v committed at LSN %v started before the first record of the log: %w", txNum, lsn, wal.ErrLogRemoved)
+		}
+		if lsn > f.fromLSN && len(changes) > 0 {
+			return &CommittedTx{txNum, lsn, r.commitTime, changes}, nil
+		}
+	}
+	return nil, nil
+}
+
+// addChange adds a change to the transaction, unless its Start record was not read
+func (f *ChangeFeed) addChange(txNum TxID, change Change) {
+	changes, started := f.active[txNum]
+	if started {
+		f.active[txNum] = append(changes, change)
+	}
+}
@@ -0,0 +1,74 @@
+package txn_test
+
+import (
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/server"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/naveen246/kite-db/wal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// feedLog passes the records of the log from lsn to the feed and returns the transactions it emits
+func feedLog(t *testing.T, db *server.DB, feed *txn.ChangeFeed, lsn int64) ([]txn.CommittedTx, error) {
+	iter, err := db.Log.ForwardIterator(lsn)
+	assert.NoError(t, err)
+	var committed []txn.CommittedTx
+	for iter.HasNext() {
+		record, err := iter.Next()
+		assert.NoError(t, err)
+		tx, err := feed.Add(iter.LSN(), record)
+		if err != nil {
+			return committed, err
+		}
+		if tx != nil {
+			committed = append(committed, *tx)
+		}
+	}
+	return committed, nil
+}
+
+func TestChangeFeed(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+	tx := newTx(t, db)
+	block, err := tx.Append(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+
+	// tx1 rolls back and tx3 does not finish, only the changes of tx2 are emitted
+	tx1 := newTx(t, db)
+	tx1.Pin(block)
+	assert.NoError(t, tx1.SetInt(block, 0, 5, true))
+	assert.NoError(t, tx1.Rollback())
+	tx2 := newTx(t, db)
+	tx2.Pin(block)
+	assert.NoError(t, tx2.SetInt(block, 0, 7, true))
+	assert.NoError(t, tx2.SetString(block, 60, "abc", true))
+	assert.NoError(t, tx2.Commit())
+	tx3 := newTx(t, db)
+	tx3.Pin(block)
+	assert.NoError(t, tx3.SetInt(block, file.IntSize, 9, true))
+
+	committed, err := feedLog(t, db, txn.NewChangeFeed(0), 0)
+	assert.NoError(t, err)
+	assert.Len(t, committed, 1)
+	assert.Equal(t, tx2.TxNum, committed[0].TxNum)
+	assert.Equal(t, tx2.CommitLSN(), committed[0].CommitLSN)
+	assert.Equal(t, []txn.Change{
+		{LSN: committed[0].Changes[0].LSN, Block: block, Offset: 0, OldValue: 0, NewValue: 7},
+		{LSN: committed[0].Changes[1].LSN, Block: block, Offset: 60, OldValue: "", NewValue: "abc"},
+	}, committed[0].Changes)
+	assert.NoError(t, tx3.Commit())
+
+	// the transactions committed at or before fromLSN are not emitted
+	committed, err = feedLog(t, db, txn.NewChangeFeed(tx2.CommitLSN()), 0)
+	assert.NoError(t, err)
+	assert.Len(t, committed, 1)
+	assert.Equal(t, tx3.TxNum, committed[0].TxNum)
+
+	// the Start record of tx2 is not read, so its changes cannot all be emitted
+	_, err = feedLog(t, db, txn.NewChangeFeed(0), tx2.CommitLSN())
+	assert.ErrorIs(t, err, wal.ErrLogRemoved)
+}
@@ -17,17 +17,19 @@ import (
 // Txn B tries to write to block2 and read block1
 // Txn C tries to write to block1 and read block2
 func TestConcurrency(t *testing.T) {
-	db := server.NewDB(dbDir, blockTestSize, 8)
+	db, err := server.NewDB(dbDir, blockTestSize, 8)
+	assert.NoError(t, err)
 	createFile(db.FileMgr, filename)
 	defer removeFile(db.FileMgr.DbFilePath(filename), dbDir)
 	defer removeFile(db.FileMgr.DbFilePath(db.Log.LogFile), dbDir)
+	defer db.Close()
 
 	block1 := file.GetBlock(filename, 1)
 	block2 := file.GetBlock(filename, 2)
 
-	txA := db.NewTx()
-	txB := db.NewTx()
-	txC := db.NewTx()
+	txA := newTx(t, db)
+	txB := newTx(t, db)
+	txC := newTx(t, db)
 	ch := make(chan string, 3)
 
 	wg := sync.WaitGroup{}
@@ -52,7 +54,7 @@ func TestConcurrency(t *testing.T) {
 		fmt.Println("Tx A: receive sLock on block2")
 
 		ch <- "txA commit"
-		txA.Commit()
+		assert.NoError(t, txA.Commit())
 		fmt.Println("Tx A: commit")
 	}(txA)
 
@@ -76,7 +78,7 @@ func TestConcurrency(t *testing.T) {
 		fmt.Println("Tx B: receive sLock on block1")
 
 		ch <- "txB commit"
-		txB.Commit()
+		assert.NoError(t, txB.Commit())
 		fmt.Println("Tx B: commit")
 	}(txB)
 
@@ -116,7 +118,7 @@ func TestConcurrency(t *testing.T) {
 			break
 		}
 		ch <- "txC commit"
-		txC.Commit()
+		assert.NoError(t, txC.Commit())
 		fmt.Println("Tx C: commit")
 	}(txC)
 
@@ -0,0 +1,243 @@
+package txn
+
+import (
+	"errors"
+	"fmt"
+	"github.com/naveen246/kite-db/file"
+	"os"
+)
+
+// CreateFile Create a new empty file.
+// This method first obtains an xLock on the "end of the file" (eofBlock).
+// The file is removed if the transaction is rolled back.
+func (tx *Transaction) CreateFile(filename string) error {
+	if tx.readOnly {
+		return ErrReadOnlyTx
+	}
+	eofBlock := file.GetBlock(filename, EndOfFile)
+	err := tx.concurMgr.xLock(eofBlock, tx.TxNum)
+	if err != nil {
+		return err
+	}
+
+	exists, err := tx.fileMgr.Exists(filename)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %v", ErrFileExists, filename)
+	}
+	return tx.createFile(filename)
+}
+
+// createFile Write a CreateFile record to the log and flush it before creating the file,
+// so that the file is removed by recovery if the transaction does not complete.
+func (tx *Transaction) createFile(filename string) error {
+	lsn, err := writeCreateFileRecToLog(tx.recoveryMgr.log, tx.TxNum, filename)
+	if err != nil {
+		return err
+	}
+	err = tx.recoveryMgr.log.Flush(lsn)
+	if err != nil {
+		return err
+	}
+	return tx.fileMgr.Create(filename)
+}
+
+// DropFile Remove the file, along with its free space map.
+// This method first obtains an xLock on the "end of the file" (eofBlock) and on each block of the file and of its free space map,
+// so no other transaction is using the file when it is removed.
+// The file is removed only when the transaction commits, so nothing has to be undone on rollback.
+func (tx *Transaction) DropFile(filename string) error {
+	if tx.readOnly {
+		return ErrReadOnlyTx
+	}
+	eofBlock := file.GetBlock(filename, EndOfFile)
+	err := tx.concurMgr.xLock(eofBlock, tx.TxNum)
+	if err != nil {
+		return err
+	}
+
+	exists, err := tx.fileMgr.Exists(filename)
+	if err != nil {
+		return err
+	}
+	if !exists || tx.pendingDrops[filename] {
+		return fmt.Errorf("%w: %v", ErrFileNotFound, filename)
+	}
+
+	for _, name := range []string{filename, FreeSpaceMapFile(filename)} {
+		err = tx.xLockFile(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = writeDropFileRecToLog(tx.recoveryMgr.log, tx.TxNum, filename)
+	if err != nil {
+		return err
+	}
+	tx.pendingDrops[filename] = true
+	delete(tx.pendingTruncates, filename)
+	return nil
+}
+
+// Truncate Shrink the file to blockCount blocks.
+// This method first obtains an xLock on the "end of the file" (eofBlock) and on each block that is removed.
+// The file is truncated only when the transaction commits, so nothing has to be undone on rollback.
+// Until then, Size returns the truncated size and the file cannot be extended by this transaction.
+func (tx *Transaction) Truncate(filename string, blockCount int64) error {
+	if tx.readOnly {
+		return ErrReadOnlyTx
+	}
+	eofBlock := file.GetBlock(filename, EndOfFile)
+	err := tx.concurMgr.xLock(eofBlock, tx.TxNum)
+	if err != nil {
+		return err
+	}
+
+	exists, err := tx.fileMgr.Exists(filename)
+	if err != nil {
+		return err
+	}
+	if !exists || tx.pendingDrops[filename] {
+		return fmt.Errorf("%w: %v", ErrFileNotFound, filename)
+	}
+
+	currentBlockCount, err := tx.blockCount(filename)
+	if err != nil {
+		return err
+	}
+	if blockCount < 0 || blockCount > currentBlockCount {
+		return fmt.Errorf("cannot truncate %v with %v blocks to %v blocks", filename, currentBlockCount, blockCount)
+	}
+	if blockCount == currentBlockCount {
+		return nil
+	}
+
+	for blockNum := blockCount; blockNum < currentBlockCount; blockNum++ {
+		err = tx.concurMgr.xLock(file.GetBlock(filename, blockNum), tx.TxNum)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = writeTruncateFileRecToLog(tx.recoveryMgr.log, tx.TxNum, filename, blockCount)
+	if err != nil {
+		return err
+	}
+	tx.pendingTruncates[filename] = blockCount
+	return nil
+}
+
+// xLockFile Obtain an xLock on the "end of the file" (eofBlock) and on each block of the file.
+func (tx *Transaction) xLockFile(filename string) error {
+	err := tx.concurMgr.xLock(file.GetBlock(filename, EndOfFile), tx.TxNum)
+	if err != nil {
+		return err
+	}
+	blockCount, err := tx.fileMgr.BlockCount(filename)
+	if err != nil {
+		return err
+	}
+	for blockNum := int64(0); blockNum < blockCount; blockNum++ {
+		err = tx.concurMgr.xLock(file.GetBlock(filename, blockNum), tx.TxNum)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockCount Return the number of blocks in the file, as seen by this transaction.
+func (tx *Transaction) blockCount(filename string) (int64, error) {
+	if tx.pendingDrops[filename] {
+		return 0, nil
+	}
+	blockCount, err := tx.fileMgr.BlockCount(filename)
+	if err != nil {
+		return 0, err
+	}
+	if truncated, ok := tx.pendingTruncates[filename]; ok {
+		return min(blockCount, truncated), nil
+	}
+	return blockCount, nil
+}
+
+// applyPendingFileOps Remove the files dropped and truncate the files truncated by the committed transaction.
+// All the operations are attempted, the errors are joined. The operations that failed are applied again by recovery.
+func (tx *Transaction) applyPendingFileOps() error {
+	var errs []error
+	for filename := range tx.pendingDrops {
+		err := tx.dropFile(filename)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for filename, blockCount := range tx.pendingTruncates {
+		err := tx.truncateFile(filename, blockCount)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not truncate file %v: %w", filename, err))
+		}
+	}
+
+	clear(tx.pendingDrops)
+	clear(tx.pendingTruncates)
+	return errors.Join(errs...)
+}
+
+// dropFile Remove the file and its free space map. Both removals are attempted, the errors are joined.
+func (tx *Transaction) dropFile(filename string) error {
+	var errs []error
+	for _, name := range []string{filename, FreeSpaceMapFile(filename)} {
+		err := tx.removeFile(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not drop file %v: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// truncateFile Discard the buffers assigned to the blocks removed and truncate the file to blockCount blocks,
+// if it has more blocks.
+func (tx *Transaction) truncateFile(filename string, blockCount int64) error {
+	err := tx.bufferPool.DiscardBlocks(filename, blockCount)
+	if err != nil {
+		return err
+	}
+	currentBlockCount, err := tx.fileMgr.BlockCount(filename)
+	if err != nil || currentBlockCount <= blockCount {
+		return err
+	}
+	return tx.fileMgr.Truncate(filename, blockCount)
+}
+
+// removeFile Discard the buffers assigned to blocks of the file and remove the file, if it exists.
+func (tx *Transaction) removeFile(filename string) error {
+	err := tx.bufferPool.DiscardBlocks(filename, 0)
+	if err != nil {
+		return err
+	}
+	err = tx.fileMgr.Delete(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// extendTo Append blocks to the file until it has the specified block.
+// It is used to redo the changes to blocks that were appended after a backup of the file.
+func (tx *Transaction) extendTo(block file.Block) error {
+	blockCount, err := tx.fileMgr.BlockCount(block.Filename)
+	if err != nil {
+		return err
+	}
+	for ; blockCount <= block.Number; blockCount++ {
+		_, err = tx.fileMgr.Append(block.Filename)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
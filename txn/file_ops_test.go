@@ -0,0 +1,210 @@
+package txn_test
+
+import (
+	"github.com/naveen246/kite-db/buffer"
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/server"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func fileExists(t *testing.T, db *server.DB, filename string) bool {
+	exists, err := db.FileMgr.Exists(filename)
+	assert.NoError(t, err)
+	return exists
+}
+
+func TestCreateFile(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// a file created by a rolled back transaction is removed
+	tx1 := newTx(t, db)
+	assert.NoError(t, tx1.CreateFile(filename))
+	assert.True(t, fileExists(t, db, filename))
+	_, err = tx1.Append(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, tx1.Rollback())
+	assert.False(t, fileExists(t, db, filename))
+
+	tx2 := newTx(t, db)
+	assert.NoError(t, tx2.CreateFile(filename))
+	assert.ErrorIs(t, tx2.CreateFile(filename), txn.ErrFileExists)
+	assert.NoError(t, tx2.Commit())
+	assert.True(t, fileExists(t, db, filename))
+
+	// a file created by appending to it is also removed on rollback
+	tx3 := newTx(t, db)
+	_, err = tx3.Append("otherFile")
+	assert.NoError(t, err)
+	assert.True(t, fileExists(t, db, "otherFile"))
+	assert.NoError(t, tx3.Rollback())
+	assert.False(t, fileExists(t, db, "otherFile"))
+}
+
+func TestDropFile(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx1 := newTx(t, db)
+	block, err := tx1.AllocateBlock(filename, 10)
+	assert.NoError(t, err)
+	tx1.Pin(block)
+	assert.NoError(t, tx1.SetInt(block, 0, 42, true))
+	assert.NoError(t, tx1.Commit())
+
+	// the file is only removed when the transaction commits
+	tx2 := newTx(t, db)
+	assert.NoError(t, tx2.DropFile(filename))
+	assert.True(t, fileExists(t, db, filename))
+	size, _ := tx2.Size(filename)
+	assert.Equal(t, 0, size)
+	assert.NoError(t, tx2.Rollback())
+	assert.True(t, fileExists(t, db, filename))
+
+	tx3 := newTx(t, db)
+	assert.NoError(t, tx3.DropFile(filename))
+	assert.ErrorIs(t, tx3.DropFile(filename), txn.ErrFileNotFound)
+	assert.NoError(t, tx3.Commit())
+	assert.False(t, fileExists(t, db, filename))
+	assert.False(t, fileExists(t, db, txn.FreeSpaceMapFile(filename)))
+
+	tx4 := newTx(t, db)
+	assert.ErrorIs(t, tx4.DropFile(filename), txn.ErrFileNotFound)
+	assert.NoError(t, tx4.Commit())
+
+	// a file cannot be dropped while an older transaction reads it or its free space map
+	tx5 := newTx(t, db)
+	block, err = tx5.AllocateBlock(filename, 10)
+	assert.NoError(t, err)
+	assert.NoError(t, tx5.Commit())
+	fsmBlock := file.GetBlock(txn.FreeSpaceMapFile(filename), 0)
+	for _, readBlock := range []file.Block{block, fsmBlock} {
+		tx6 := newTx(t, db)
+		assert.NoError(t, tx6.Pin(readBlock))
+		_, err = tx6.GetInt(readBlock, 0)
+		assert.NoError(t, err)
+		tx7 := newTx(t, db)
+		assert.ErrorIs(t, tx7.DropFile(filename), txn.ErrLockAbort)
+		assert.NoError(t, tx7.Rollback())
+		assert.NoError(t, tx6.Commit())
+	}
+	tx8 := newTx(t, db)
+	assert.NoError(t, tx8.DropFile(filename))
+	assert.NoError(t, tx8.Commit())
+	assert.False(t, fileExists(t, db, filename))
+}
+
+func TestTruncateFile(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx1 := newTx(t, db)
+	for i := 0; i < 5; i++ {
+		_, err = tx1.Append(filename)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tx1.Commit())
+
+	// a rolled back truncate does not change the file
+	tx2 := newTx(t, db)
+	assert.NoError(t, tx2.Truncate(filename, 2))
+	size, _ := tx2.Size(filename)
+	assert.Equal(t, 2, size)
+	blockCount, err := db.FileMgr.BlockCount(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), blockCount)
+	assert.NoError(t, tx2.Rollback())
+	blockCount, err = db.FileMgr.BlockCount(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), blockCount)
+
+	tx3 := newTx(t, db)
+	assert.Error(t, tx3.Truncate(filename, 6))
+	assert.NoError(t, tx3.Truncate(filename, 3))
+	_, err = tx3.Append(filename)
+	assert.ErrorIs(t, err, txn.ErrPendingTruncate)
+	assert.NoError(t, tx3.Commit())
+	blockCount, err = db.FileMgr.BlockCount(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), blockCount)
+}
+
+func TestRecoverCreateFile(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx1 := newTx(t, db)
+	assert.NoError(t, tx1.CreateFile(filename))
+	tx1.ReleaseLocks()
+
+	// tx1 did not complete, so recovery removes the file it created
+	tx2 := newTx(t, db)
+	assert.NoError(t, tx2.Recover())
+	assert.False(t, fileExists(t, db, filename))
+}
+
+func TestRecoverTruncateFile(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx1 := newTx(t, db)
+	for i := 0; i < 5; i++ {
+		_, err = tx1.Append(filename)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tx1.Commit())
+
+	// tx3 commits, but the file cannot be truncated while tx2 has one of the removed blocks pinned
+	tx2 := newTx(t, db)
+	assert.NoError(t, tx2.Pin(file.GetBlock(filename, 4)))
+	tx3 := newTx(t, db)
+	assert.NoError(t, tx3.Truncate(filename, 2))
+	assert.ErrorIs(t, tx3.Commit(), buffer.ErrBufferPinned)
+	assert.Greater(t, tx3.CommitLSN(), int64(0))
+	blockCount, err := db.FileMgr.BlockCount(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), blockCount)
+	assert.NoError(t, tx2.Commit())
+
+	// recovery truncates the file, as tx3 committed
+	tx4 := newTx(t, db)
+	assert.NoError(t, tx4.Recover())
+	blockCount, err = db.FileMgr.BlockCount(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), blockCount)
+}
+
+func TestRecoverDropFile(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx1 := newTx(t, db)
+	_, err = tx1.AllocateBlock(filename, 10)
+	assert.NoError(t, err)
+	assert.NoError(t, tx1.Commit())
+	fsmFile := txn.FreeSpaceMapFile(filename)
+	assert.True(t, fileExists(t, db, fsmFile))
+
+	// tx3 commits, but the free space map cannot be removed while tx2 has one of its blocks pinned
+	tx2 := newTx(t, db)
+	assert.NoError(t, tx2.Pin(file.GetBlock(fsmFile, 0)))
+	tx3 := newTx(t, db)
+	assert.NoError(t, tx3.DropFile(filename))
+	assert.ErrorIs(t, tx3.Commit(), buffer.ErrBufferPinned)
+	assert.False(t, fileExists(t, db, filename))
+	assert.True(t, fileExists(t, db, fsmFile))
+	assert.NoError(t, tx2.Commit())
+
+	// recovery removes the free space map, as tx3 committed
+	tx4 := newTx(t, db)
+	assert.NoError(t, tx4.Recover())
+	assert.False(t, fileExists(t, db, fsmFile))
+}
@@ -0,0 +1,241 @@
+package txn
+
+import (
+	"errors"
+	"fmt"
+	"github.com/naveen246/kite-db/file"
+)
+
+/*
+The free space map (fsm) of a data file keeps track of the number of free bytes in each block of the data file,
+so that space freed by deleted data can be reused instead of always appending new blocks to the file.
+
+The free space map of a data file is persisted in the file <filename>.fsm
+It holds 1 Int (the free bytes) per data block. Below is an example where BlockSize is 40, so each fsm block has 5 entries.
++--------------------------------------------------+--------------------------------------------------+
+| free(0) | free(1) | free(2) | free(3) | free(4)  | free(5) | free(6) | free(7) | free(8) | free(9)  |
++--------------------------------------------------+--------------------------------------------------+
+| fsm Block 0                                      | fsm Block 1                                      |
++--------------------------------------------------+--------------------------------------------------+
+
+A data block without an entry (or with an entry of 0) is considered full.
+The fsm is read and modified through the transaction like any other file, with locks and logged SetInt records,
+so changes to it are undone on rollback and recovery.
+*/
+
+const fsmFileSuffix = ".fsm"
+
+var ErrAllocationTooLarge = errors.New("allocation does not fit in a block")
+
+// FreeSpaceMapFile returns the name of the file that holds the free space map of filename
+func FreeSpaceMapFile(filename string) string {
+	return filename + fsmFileSuffix
+}
+
+type freeSpaceMap struct {
+	tx      *Transaction
+	fsmFile string
+}
+
+func newFreeSpaceMap(tx *Transaction, filename string) *freeSpaceMap {
+	return &freeSpaceMap{
+		tx:      tx,
+		fsmFile: FreeSpaceMapFile(filename),
+	}
+}
+
+func (m *freeSpaceMap) entriesPerBlock() int64 {
+	return m.tx.fileMgr.BlockSize / file.IntSize
+}
+
+// entry returns the fsm block and the offset within it that hold the free space of data block blockNum
+func (m *freeSpaceMap) entry(blockNum int64) (file.Block, int64) {
+	fsmBlock := file.GetBlock(m.fsmFile, blockNum/m.entriesPerBlock())
+	offset := (blockNum % m.entriesPerBlock()) * file.IntSize
+	return fsmBlock, offset
+}
+
+// get returns the free space recorded for data block blockNum
+func (m *freeSpaceMap) get(blockNum int64) (int64, error) {
+	fsmBlock, offset := m.entry(blockNum)
+	size, err := m.tx.Size(m.fsmFile)
+	if err != nil {
+		return 0, err
+	}
+	if fsmBlock.Number >= int64(size) {
+		return 0, nil
+	}
+
+	err = m.tx.Pin(fsmBlock)
+	if err != nil {
+		return 0, err
+	}
+	defer m.tx.Unpin(fsmBlock)
+	free, err := m.tx.GetInt(fsmBlock, int(offset))
+	return int64(free), err
+}
+
+// set records free as the free space of data block blockNum, the fsm file is extended if needed
+func (m *freeSpaceMap) set(blockNum int64, free int64) error {
+	fsmBlock, offset := m.entry(blockNum)
+	size, err := m.tx.Size(m.fsmFile)
+	if err != nil {
+		return err
+	}
+	for ; int64(size) <= fsmBlock.Number; size++ {
+		_, err = m.tx.Append(m.fsmFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = m.tx.Pin(fsmBlock)
+	if err != nil {
+		return err
+	}
+	defer m.tx.Unpin(fsmBlock)
+	return m.tx.SetInt(fsmBlock, offset, int(free), true)
+}
+
+// find returns the first of the blockCount data blocks that has at least size free bytes
+func (m *freeSpaceMap) find(blockCount int64, size int64) (int64, bool, error) {
+	fsmSize, err := m.tx.Size(m.fsmFile)
+	if err != nil {
+		return 0, false, err
+	}
+
+	for blockNum := int64(0); blockNum < blockCount; {
+		fsmBlock, _ := m.entry(blockNum)
+		if fsmBlock.Number >= int64(fsmSize) {
+			break
+		}
+
+		err = m.tx.Pin(fsmBlock)
+		if err != nil {
+			return 0, false, err
+		}
+		for ; blockNum < blockCount; blockNum++ {
+			block, offset := m.entry(blockNum)
+			if block != fsmBlock {
+				break
+			}
+			free, err := m.tx.GetInt(fsmBlock, int(offset))
+			if err != nil {
+				m.tx.Unpin(fsmBlock)
+				return 0, false, err
+			}
+			if int64(free) >= size {
+				m.tx.Unpin(fsmBlock)
+				return blockNum, true, nil
+			}
+		}
+		m.tx.Unpin(fsmBlock)
+	}
+	return 0, false, nil
+}
+
+// FreeSpace Return the number of free bytes recorded in the free space map for the block.
+func (tx *Transaction) FreeSpace(block file.Block) (int64, error) {
+	return newFreeSpaceMap(tx, block.Filename).get(block.Number)
+}
+
+// SetFreeSpace Record in the free space map that the block has free bytes available.
+// Clients call this when data is removed from a block, so that the space can be allocated again.
+// The change is logged and undone if the transaction is rolled back.
+func (tx *Transaction) SetFreeSpace(block file.Block, free int64) error {
+	if free < 0 || free > tx.fileMgr.BlockSize {
+		return fmt.Errorf("invalid free space %v for block %v", free, block)
+	}
+	return newFreeSpaceMap(tx, block.Filename).set(block.Number, free)
+}
+
+// AllocateBlock Return a block of the file that has at least size free bytes, and reserve those bytes.
+// A block with enough free space is chosen from the free space map,
+// if there is no such block, a new block is appended to the file.
+// This method first obtains an xLock on the "end of the file" (eofBlock), so allocations in a file are serialized.
+func (tx *Transaction) AllocateBlock(filename string, size int64) (file.Block, error) {
+	if size <= 0 || size > tx.fileMgr.BlockSize {
+		return file.Block{}, ErrAllocationTooLarge
+	}
+
+	eofBlock := file.GetBlock(filename, EndOfFile)
+	err := tx.concurMgr.xLock(eofBlock, tx.TxNum)
+	if err != nil {
+		return file.Block{}, err
+	}
+
+	fsm := newFreeSpaceMap(tx, filename)
+	blockCount, err := tx.blockCount(filename)
+	if err != nil {
+		return file.Block{}, err
+	}
+	blockNum, found, err := fsm.find(blockCount, size)
+	if err != nil {
+		return file.Block{}, err
+	}
+
+	free := tx.fileMgr.BlockSize
+	block := file.GetBlock(filename, blockNum)
+	if found {
+		free, err = fsm.get(blockNum)
+		if err != nil {
+			return file.Block{}, err
+		}
+	} else {
+		block, err = tx.Append(filename)
+		if err != nil {
+			return file.Block{}, err
+		}
+	}
+
+	err = fsm.set(block.Number, free-size)
+	if err != nil {
+		return file.Block{}, err
+	}
+	return block, nil
+}
+
+// TruncateFreeBlocks Remove the blocks at the end of the file that are completely free
+// according to the free space map, and return the number of blocks removed.
+// This method first obtains an xLock on the "end of the file" (eofBlock).
+// The file is truncated with Truncate, so it only shrinks when the transaction commits.
+func (tx *Transaction) TruncateFreeBlocks(filename string) (int64, error) {
+	eofBlock := file.GetBlock(filename, EndOfFile)
+	err := tx.concurMgr.xLock(eofBlock, tx.TxNum)
+	if err != nil {
+		return 0, err
+	}
+
+	fsm := newFreeSpaceMap(tx, filename)
+	blockCount, err := tx.blockCount(filename)
+	if err != nil {
+		return 0, err
+	}
+	newBlockCount := blockCount
+	for newBlockCount > 0 {
+		free, err := fsm.get(newBlockCount - 1)
+		if err != nil {
+			return 0, err
+		}
+		if free != tx.fileMgr.BlockSize {
+			break
+		}
+		newBlockCount--
+	}
+	if newBlockCount == blockCount {
+		return 0, nil
+	}
+
+	err = tx.Truncate(filename, newBlockCount)
+	if err != nil {
+		return 0, err
+	}
+
+	for blockNum := newBlockCount; blockNum < blockCount; blockNum++ {
+		err = fsm.set(blockNum, 0)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return blockCount - newBlockCount, nil
+}
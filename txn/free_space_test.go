@@ -0,0 +1,117 @@
+package txn_test
+
+import (
+	"github.com/naveen246/kite-db/file"
+	"github.com/naveen246/kite-db/server"
+	"github.com/naveen246/kite-db/txn"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAllocateBlock(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// empty file: a new block is appended
+	tx1 := newTx(t, db)
+	block, err := tx1.AllocateBlock(filename, 300)
+	assert.NoError(t, err)
+	assert.Equal(t, file.GetBlock(filename, 0), block)
+	free, _ := tx1.FreeSpace(block)
+	assert.Equal(t, blockTestSize-300, free)
+
+	// the remaining space in block 0 is used
+	block, err = tx1.AllocateBlock(filename, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), block.Number)
+	free, _ = tx1.FreeSpace(block)
+	assert.Equal(t, int64(0), free)
+
+	// block 0 is full so block 1 is appended
+	block, err = tx1.AllocateBlock(filename, 50)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), block.Number)
+
+	_, err = tx1.AllocateBlock(filename, blockTestSize+1)
+	assert.ErrorIs(t, err, txn.ErrAllocationTooLarge)
+	assert.NoError(t, tx1.Commit())
+
+	// space freed in block 0 is reused, but not if the transaction is rolled back
+	tx2 := newTx(t, db)
+	assert.NoError(t, tx2.SetFreeSpace(file.GetBlock(filename, 0), 200))
+	block, err = tx2.AllocateBlock(filename, 150)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), block.Number)
+	assert.NoError(t, tx2.Rollback())
+
+	tx3 := newTx(t, db)
+	free, _ = tx3.FreeSpace(file.GetBlock(filename, 0))
+	assert.Equal(t, int64(0), free)
+	block, err = tx3.AllocateBlock(filename, 150)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), block.Number)
+	assert.NoError(t, tx3.Commit())
+}
+
+func TestFreeSpaceMapSpansBlocks(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// each fsm block holds BlockSize / IntSize entries, block 60 is tracked in the 2nd fsm block
+	tx := newTx(t, db)
+	for i := 0; i <= 60; i++ {
+		_, err = tx.AllocateBlock(filename, blockTestSize)
+		assert.NoError(t, err)
+	}
+	block := file.GetBlock(filename, 60)
+	assert.NoError(t, tx.SetFreeSpace(block, 10))
+	size, _ := tx.Size(txn.FreeSpaceMapFile(filename))
+	assert.Equal(t, 2, size)
+
+	allocated, err := tx.AllocateBlock(filename, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, block, allocated)
+	assert.NoError(t, tx.Commit())
+}
+
+func TestTruncateFreeBlocks(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx1 := newTx(t, db)
+	for i := 0; i < 4; i++ {
+		_, err = tx1.AllocateBlock(filename, blockTestSize)
+		assert.NoError(t, err)
+	}
+	// blocks 1 and 3 become free, only block 3 is at the end of the file
+	assert.NoError(t, tx1.SetFreeSpace(file.GetBlock(filename, 1), blockTestSize))
+	assert.NoError(t, tx1.SetFreeSpace(file.GetBlock(filename, 3), blockTestSize))
+	removed, err := tx1.TruncateFreeBlocks(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+	size, _ := tx1.Size(filename)
+	assert.Equal(t, 3, size)
+
+	// after block 2 is freed, blocks 1 and 2 are removed
+	assert.NoError(t, tx1.SetFreeSpace(file.GetBlock(filename, 2), blockTestSize))
+	removed, err = tx1.TruncateFreeBlocks(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), removed)
+	size, _ = tx1.Size(filename)
+	assert.Equal(t, 1, size)
+
+	removed, err = tx1.TruncateFreeBlocks(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), removed)
+	assert.NoError(t, tx1.Commit())
+
+	// the next allocation appends block 1 again
+	tx2 := newTx(t, db)
+	block, err := tx2.AllocateBlock(filename, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), block.Number)
+	assert.NoError(t, tx2.Commit())
+}
@@ -0,0 +1,95 @@
+package txn
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// recordTypeNames are the names of the log record types, as printed by the String methods of the records
+var recordTypeNames = map[int]string{
+	CheckPoint:   "CHECKPOINT",
+	Start:        "START",
+	Commit:       "COMMIT",
+	Rollback:     "ROLLBACK",
+	SetInt:       "SETINT",
+	SetString:    "SETSTRING",
+	CreateFile:   "CREATEFILE",
+	DropFile:     "DROPFILE",
+	TruncateFile: "TRUNCATEFILE",
+}
+
+// RecordTypeName returns the name of a log record type, such as "SETINT"
+func RecordTypeName(recordType int) string {
+	name, ok := recordTypeNames[recordType]
+	if !ok {
+		return fmt.Sprintf("UNKNOWN(%v)", recordType)
+	}
+	return name
+}
+
+// ParseRecordType returns the log record type with the given name (case-insensitive)
+func ParseRecordType(name string) (int, error) {
+	for recordType, typeName := range recordTypeNames {
+		if strings.EqualFold(name, typeName) {
+			return recordType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log record type %v", name)
+}
+
+// RecordInfo describes a log record, it is used by tools that inspect the log.
+// The fields that do not apply to the type of the record are nil.
+type RecordInfo struct {
+	LSN        int64      `json:"lsn"`
+	Type       int        `json:"-"`
+	TypeName   string     `json:"type"`
+	TxNum      TxID       `json:"tx"`
+	Filename   *string    `json:"file,omitempty"`
+	BlockNum   *int64     `json:"block,omitempty"`
+	Offset     *int64     `json:"offset,omitempty"`
+	OldValue   any        `json:"old_value,omitempty"`
+	NewValue   any        `json:"new_value,omitempty"`
+	BlockCount *int64     `json:"block_count,omitempty"`
+	CommitTime *time.Time `json:"commit_time,omitempty"`
+
+	record LogRecord
+}
+
+// DescribeLogRecord decodes a log record read from the log at the given LSN.
+// Returns ErrInvalidLogRecord if the record cannot be decoded.
+func DescribeLogRecord(lsn int64, bytes []byte) (RecordInfo, error) {
+	record, err := createLogRecord(bytes)
+	if err != nil {
+		return RecordInfo{}, err
+	}
+
+	info := RecordInfo{
+		LSN:      lsn,
+		Type:     record.recordType(),
+		TypeName: RecordTypeName(record.recordType()),
+		TxNum:    record.txNumber(),
+		record:   record,
+	}
+	switch r := record.(type) {
+	case *CommitRecord:
+		info.CommitTime = &r.commitTime
+	case *SetIntRecord:
+		info.Filename, info.BlockNum, info.Offset = &r.block.Filename, &r.block.Number, &r.offset
+		info.OldValue, info.NewValue = r.oldVal, r.newVal
+	case *SetStringRecord:
+		info.Filename, info.BlockNum, info.Offset = &r.block.Filename, &r.block.Number, &r.offset
+		info.OldValue, info.NewValue = r.oldVal, r.newVal
+	case *CreateFileRecord:
+		info.Filename = &r.filename
+	case *DropFileRecord:
+		info.Filename = &r.filename
+	case *TruncateFileRecord:
+		info.Filename, info.BlockCount = &r.filename, &r.blockCount
+	}
+	return info, nil
+}
+
+func (r RecordInfo) String() string {
+	return fmt.Sprintf("%v %v", r.LSN, r.record)
+}
@@ -1,9 +1,11 @@
 package txn
 
 import (
+	"fmt"
 	"github.com/naveen246/kite-db/buffer"
+	"github.com/naveen246/kite-db/common"
 	"github.com/naveen246/kite-db/wal"
-	"log"
+	"math"
 )
 
 // RecoveryMgr Each transaction has its own recovery manager
@@ -12,27 +14,62 @@ type RecoveryMgr struct {
 	bufPool *buffer.BufferPool
 	tx      *Transaction
 	txNum   TxID
+
+	// commitLSN is the LSN of the Commit record of the transaction, 0 until it commits
+	commitLSN int64
+
+	// a read-only transaction has nothing to commit or roll back, so it writes nothing to the log
+	readOnly bool
 }
 
-func NewRecoveryMgr(tx *Transaction, txNum TxID, log *wal.Log, bufPool *buffer.BufferPool) *RecoveryMgr {
-	WriteStartRecToLog(log, txNum)
-	return &RecoveryMgr{log, bufPool, tx, txNum}
+// NewRecoveryMgr writes a Start record for the transaction to the log
+func NewRecoveryMgr(tx *Transaction, txNum TxID, log *wal.Log, bufPool *buffer.BufferPool) (*RecoveryMgr, error) {
+	_, err := WriteStartRecToLog(log, txNum)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryMgr{log: log, bufPool: bufPool, tx: tx, txNum: txNum}, nil
 }
 
 // commit Write a commit record to the log, and flush it to disk.
-func (r *RecoveryMgr) commit() {
-	r.bufPool.FlushAll(int64(r.txNum))
-	lsn := WriteCommitRecToLog(r.log, r.txNum)
-	r.log.Flush(lsn)
+// With asynchronous commit (see wal.WithAsyncCommit) the commit record is flushed later by the log,
+// unless the transaction drops or truncates files: those are removed/truncated right after commit,
+// which recovery could not undo if the commit record was lost.
+func (r *RecoveryMgr) commit() error {
+	if r.readOnly {
+		return nil
+	}
+	err := r.bufPool.FlushAll(int64(r.txNum))
+	if err != nil {
+		return err
+	}
+	lsn, err := WriteCommitRecToLog(r.log, r.txNum)
+	if err != nil {
+		return err
+	}
+	r.commitLSN = lsn
+	if r.log.AsyncCommit() && len(r.tx.pendingDrops) == 0 && len(r.tx.pendingTruncates) == 0 {
+		return nil
+	}
+	return r.log.Flush(lsn)
 }
 
 // rollback Write a rollback record to the log and flush it to disk.
 // rollback the transaction, by iterating through the log records until it finds the transaction's Start record,
 // calling undo() for each of the transaction's log records.
 func (r *RecoveryMgr) rollback() error {
-	iter := r.log.Iterator()
+	if r.readOnly {
+		return nil
+	}
+	iter, err := r.log.Iterator()
+	if err != nil {
+		return err
+	}
 	for iter.HasNext() {
-		record := createLogRecord(iter.Next())
+		record, err := nextLogRecord(iter)
+		if err != nil {
+			return err
+		}
 		if record.txNumber() == r.txNum {
 			if record.recordType() == Start {
 				break
@@ -44,11 +81,15 @@ func (r *RecoveryMgr) rollback() error {
 		}
 	}
 
-	r.bufPool.FlushAll(int64(r.txNum))
-	lsn := WriteRollbackRecToLog(r.log, r.txNum)
-	r.log.Flush(lsn)
-
-	return nil
+	err = r.bufPool.FlushAll(int64(r.txNum))
+	if err != nil {
+		return err
+	}
+	lsn, err := WriteRollbackRecToLog(r.log, r.txNum)
+	if err != nil {
+		return err
+	}
+	return r.log.Flush(lsn)
 }
 
 // recover uncompleted(neither commit nor rollback) transactions from the log
@@ -56,49 +97,169 @@ func (r *RecoveryMgr) rollback() error {
 // The method iterates through the log records.
 // Whenever it finds a log record for an unfinished transaction, it calls undo() on that record.
 // The method stops when it encounters a CheckPoint record or the end of the log.
+// After the new checkpoint is flushed, the log segments older than the checkpoint are removed.
+//
+// Files dropped and truncated by a committed transaction are removed/truncated after the Commit record is flushed,
+// so if the DB crashed in between, the file and its free space map are removed here (unless it was created again later)
+// or truncated here (unless a later record changed the file).
 func (r *RecoveryMgr) recover() error {
-	iter := r.log.Iterator()
+	iter, err := r.log.Iterator()
+	if err != nil {
+		return err
+	}
 	finishedTxs := make(map[TxID]bool)
+	committedTxs := make(map[TxID]bool)
+	createdFiles := make(map[string]bool)
+	// the files changed by the records read so far, which were written after the record being read
+	changedFiles := make(map[string]bool)
+loop:
 	for iter.HasNext() {
-		record := createLogRecord(iter.Next())
+		record, err := nextLogRecord(iter)
+		if err != nil {
+			return err
+		}
 		switch record.recordType() {
 		case CheckPoint:
-			break
-		case Commit, Rollback:
+			// all transactions were finished when the checkpoint was written
+			break loop
+		case Commit:
+			finishedTxs[record.txNumber()] = true
+			committedTxs[record.txNumber()] = true
+		case Rollback:
 			finishedTxs[record.txNumber()] = true
 		default:
 			if _, ok := finishedTxs[record.txNumber()]; !ok {
-				err := record.undo(r.tx)
-				if err != nil {
-					return err
+				err = record.undo(r.tx)
+			} else if committedTxs[record.txNumber()] {
+				switch rec := record.(type) {
+				case *DropFileRecord:
+					if !createdFiles[rec.filename] {
+						err = r.tx.dropFile(rec.filename)
+					}
+				case *TruncateFileRecord:
+					if !changedFiles[rec.filename] {
+						err = r.tx.truncateFile(rec.filename, rec.blockCount)
+					}
 				}
 			}
+			if err != nil {
+				return err
+			}
+
+			if create, ok := record.(*CreateFileRecord); ok {
+				createdFiles[create.filename] = true
+			}
+			changedFiles[recordFilename(record)] = true
 		}
 	}
 
-	r.bufPool.FlushAll(int64(r.txNum))
-	lsn := WriteCheckPointToLog(r.log)
-	r.log.Flush(lsn)
+	err = r.bufPool.FlushAll(int64(r.txNum))
+	if err != nil {
+		return err
+	}
+	lsn, err := WriteCheckPointToLog(r.log)
+	if err != nil {
+		return err
+	}
+	err = r.log.Flush(lsn)
+	if err != nil {
+		return err
+	}
+	_, err = r.log.RemoveSegmentsBefore(lsn)
+	return err
+}
+
+// LastCheckpoint returns the LSN of the latest CheckPoint record in the log, 0 if the log has no CheckPoint record.
+// The records from this LSN onwards (see wal.Log.ForwardIterator) are the ones written since the checkpoint.
+func LastCheckpoint(log *wal.Log) (int64, error) {
+	iter, err := log.ReverseIterator(math.MaxInt64)
+	if err != nil {
+		return 0, err
+	}
+	for iter.HasNext() {
+		record, err := nextLogRecord(iter)
+		if err != nil {
+			return 0, err
+		}
+		if record.recordType() == CheckPoint {
+			return iter.LSN(), nil
+		}
+	}
+	return 0, nil
+}
 
-	return nil
+// OldestActiveStart returns the LSN of the Start record of the oldest transaction that had not finished
+// when the latest record of the log was at lsn, or lsn+1 if every transaction had finished.
+// The log is read backwards from lsn to the latest CheckPoint record.
+func OldestActiveStart(log *wal.Log, lsn int64) (int64, error) {
+	iter, err := log.ReverseIterator(lsn)
+	if err != nil {
+		return 0, err
+	}
+	start := lsn + 1
+	finishedTxs := make(map[TxID]bool)
+	for iter.HasNext() {
+		record, err := nextLogRecord(iter)
+		if err != nil {
+			return 0, err
+		}
+		switch record.recordType() {
+		case CheckPoint:
+			// all transactions were finished when the checkpoint was written
+			return start, nil
+		case Commit, Rollback:
+			finishedTxs[record.txNumber()] = true
+		case Start:
+			if !finishedTxs[record.txNumber()] {
+				start = iter.LSN()
+			}
+		}
+	}
+	return start, nil
+}
+
+// recordFilename returns the name of the file changed by a SetInt, SetString, CreateFile, DropFile or TruncateFile record
+func recordFilename(record LogRecord) string {
+	switch r := record.(type) {
+	case *SetIntRecord:
+		return r.block.Filename
+	case *SetStringRecord:
+		return r.block.Filename
+	case *CreateFileRecord:
+		return r.filename
+	case *DropFileRecord:
+		return r.filename
+	case *TruncateFileRecord:
+		return r.filename
+	}
+	return ""
+}
+
+// nextLogRecord reads and decodes the next record of the log iterator
+func nextLogRecord(iter common.Iterator) (LogRecord, error) {
+	bytes, err := iter.Next()
+	if err != nil {
+		return nil, err
+	}
+	return createLogRecord(bytes)
 }
 
-// setInt Write a setInt record to the log and return its lsn
-func (r *RecoveryMgr) setInt(buf *buffer.Buffer, offset int64) int64 {
+// setInt Write a setInt record with the current and the new value to the log and return its lsn
+func (r *RecoveryMgr) setInt(buf *buffer.Buffer, offset int64, newVal int) (int64, error) {
 	oldVal, err := buf.Contents.GetInt(offset)
 	if err != nil {
-		log.Fatalln("Failed to write setInt record to log:", err)
+		return 0, fmt.Errorf("could not read old value at %v in %v: %w", offset, buf.Block, err)
 	}
 
-	return writeSetIntRecToLog(r.log, r.txNum, buf.Block, offset, int(oldVal))
+	return writeSetIntRecToLog(r.log, r.txNum, buf.Block, offset, int(oldVal), newVal)
 }
 
-// setString Write a setString record to the log and return its lsn
-func (r *RecoveryMgr) setString(buf *buffer.Buffer, offset int64) int64 {
+// setString Write a setString record with the current and the new value to the log and return its lsn
+func (r *RecoveryMgr) setString(buf *buffer.Buffer, offset int64, newVal string) (int64, error) {
 	oldVal, err := buf.Contents.GetString(offset)
 	if err != nil {
-		log.Fatalln("Failed to write setString record to log:", err)
+		return 0, fmt.Errorf("could not read old value at %v in %v: %w", offset, buf.Block, err)
 	}
 
-	return writeSetStringRecToLog(r.log, r.txNum, buf.Block, offset, oldVal)
+	return writeSetStringRecToLog(r.log, r.txNum, buf.Block, offset, oldVal, newVal)
 }
@@ -6,26 +6,29 @@ import (
 	"github.com/naveen246/kite-db/txn"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestRollbackAndRecovery(t *testing.T) {
-	db := server.NewDB(dbDir, blockTestSize, 8)
+	db, err := server.NewDB(dbDir, blockTestSize, 8)
+	assert.NoError(t, err)
 	createFile(db.FileMgr, filename)
 	defer removeFile(db.FileMgr.DbFilePath(filename), dbDir)
 	defer removeFile(db.FileMgr.DbFilePath(db.Log.LogFile), dbDir)
+	defer db.Close()
 
 	// Initialize data in block0 and block1
 	initial := []int64{0, 1, 2, 3, 4, 5}
-	tx1, tx2 := setData(db, initial, initial, "abc", "def")
-	tx1.Commit()
-	tx2.Commit()
+	tx1, tx2 := setData(t, db, initial, initial, "abc", "def")
+	assert.NoError(t, tx1.Commit())
+	assert.NoError(t, tx2.Commit())
 
 	// Test if initial changes are present in block0 and block1
 	verifyData(t, db, initial, initial, "abc", "def")
 
 	// Modify data in block0 and block1
 	newData := []int64{100, 200, 300, 400, 500, 600}
-	tx3, tx4 := setData(db, newData, newData, "uvw", "xyz")
+	tx3, tx4 := setData(t, db, newData, newData, "uvw", "xyz")
 	db.BufPool.FlushAll(int64(tx3.TxNum))
 	db.BufPool.FlushAll(int64(tx4.TxNum))
 
@@ -40,8 +43,8 @@ func TestRollbackAndRecovery(t *testing.T) {
 
 	// Call transaction recover.
 	// initially calling recover will throw an error since tx4 is still holding locks
-	tx := db.NewTx()
-	err := tx.Recover()
+	tx := newTx(t, db)
+	err = tx.Recover()
 	assert.NotNil(t, err)
 	assert.Equal(t, txn.ErrLockAbort, err)
 
@@ -54,11 +57,68 @@ func TestRollbackAndRecovery(t *testing.T) {
 	verifyData(t, db, initial, initial, "abc", "def")
 }
 
-func setData(db *server.DB, b0Data []int64, b1Data []int64, str1 string, str2 string) (*txn.Transaction, *txn.Transaction) {
+func TestRecoveryRemovesLogSegments(t *testing.T) {
+	db, err := server.NewDB(dbDir, blockTestSize, 8, server.WithLogSegmentSize(2))
+	assert.NoError(t, err)
+	createFile(db.FileMgr, filename)
+	defer removeFile(db.FileMgr.DbFilePath(filename), dbDir)
+	defer removeFile(db.FileMgr.DbFilePath(db.Log.LogFile), dbDir)
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		tx1, tx2 := setData(t, db, []int64{0, 1, 2, 3, 4, 5}, []int64{0, 1, 2, 3, 4, 5}, "abc", "def")
+		assert.NoError(t, tx1.Commit())
+		assert.NoError(t, tx2.Commit())
+	}
+	segments, err := db.Log.Segments()
+	assert.NoError(t, err)
+	assert.Greater(t, len(segments), 1)
+
+	// the checkpoint written by recover is in the last segment, the older segments are not needed anymore
+	tx := newTx(t, db)
+	assert.NoError(t, tx.Recover())
+	remaining, err := db.Log.Segments()
+	assert.NoError(t, err)
+	assert.Equal(t, segments[len(segments)-1:], remaining)
+	assert.NoError(t, tx.Commit())
+	verifyData(t, db, []int64{0, 1, 2, 3, 4, 5}, []int64{0, 1, 2, 3, 4, 5}, "abc", "def")
+}
+
+func TestLastCheckpoint(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	lsn, err := txn.LastCheckpoint(db.Log)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), lsn)
+
+	tx1 := newTx(t, db)
+	assert.NoError(t, tx1.Recover())
+	assert.NoError(t, tx1.Commit())
+	tx2 := newTx(t, db)
+	assert.NoError(t, tx2.Commit())
+
+	// the records since the checkpoint are the checkpoint, the commit of tx1, and the start and commit of tx2
+	lsn, err = txn.LastCheckpoint(db.Log)
+	assert.NoError(t, err)
+	iter, err := db.Log.ForwardIterator(lsn)
+	assert.NoError(t, err)
+	var ops []int64
+	for iter.HasNext() {
+		record, err := iter.Next()
+		assert.NoError(t, err)
+		op, _ := file.NewPageWithBytes(record).GetInt(0)
+		ops = append(ops, op)
+	}
+	assert.Equal(t, []int64{txn.CheckPoint, txn.Commit, txn.Start, txn.Commit}, ops)
+}
+
+func setData(t *testing.T, db *server.DB, b0Data []int64, b1Data []int64, str1 string, str2 string) (*txn.Transaction, *txn.Transaction) {
 	block0 := file.GetBlock(filename, 0)
 	block1 := file.GetBlock(filename, 1)
-	tx1 := db.NewTx()
-	tx2 := db.NewTx()
+	tx1 := newTx(t, db)
+	tx2 := newTx(t, db)
 	tx1.Pin(block0)
 	tx2.Pin(block1)
 
@@ -96,3 +156,41 @@ func verifyData(t *testing.T, db *server.DB, b0Data []int64, b1Data []int64, str
 	val, _ = page1.GetString(60)
 	assert.Equal(t, str2, val)
 }
+
+func TestAsyncCommit(t *testing.T) {
+	db, err := server.NewDB(dbDir, blockTestSize, 8, server.WithAsyncCommit(time.Hour))
+	assert.NoError(t, err)
+	createFile(db.FileMgr, filename)
+	defer removeFile(db.FileMgr.DbFilePath(filename), dbDir)
+	defer removeFile(db.FileMgr.DbFilePath(db.Log.LogFile), dbDir)
+	defer db.Close()
+
+	tx1, tx2 := setData(t, db, []int64{0, 1, 2, 3, 4, 5}, []int64{0, 1, 2, 3, 4, 5}, "abc", "def")
+	assert.Equal(t, int64(0), tx1.CommitLSN())
+	assert.NoError(t, tx1.Commit())
+	assert.NoError(t, tx2.Commit())
+
+	// the Commit record of the last transaction is left to the background flusher
+	assert.Greater(t, tx1.CommitLSN(), int64(0))
+	assert.Greater(t, tx2.CommitLSN(), tx1.CommitLSN())
+	assert.Less(t, db.Log.FlushedLSN(), tx2.CommitLSN())
+	verifyData(t, db, []int64{0, 1, 2, 3, 4, 5}, []int64{0, 1, 2, 3, 4, 5}, "abc", "def")
+
+	// the Commit record of a transaction that truncates or drops a file is flushed before the file is changed
+	tx3 := newTx(t, db)
+	assert.NoError(t, tx3.Truncate(filename, 2))
+	assert.NoError(t, tx3.Commit())
+	assert.GreaterOrEqual(t, db.Log.FlushedLSN(), tx3.CommitLSN())
+	tx4 := newTx(t, db)
+	assert.NoError(t, tx4.CreateFile("dropfile"))
+	assert.NoError(t, tx4.Commit())
+	assert.Less(t, db.Log.FlushedLSN(), tx4.CommitLSN())
+	tx5 := newTx(t, db)
+	assert.NoError(t, tx5.DropFile("dropfile"))
+	assert.NoError(t, tx5.Commit())
+	assert.GreaterOrEqual(t, db.Log.FlushedLSN(), tx5.CommitLSN())
+
+	// Close flushes the log
+	assert.NoError(t, db.Close())
+	assert.Equal(t, tx5.CommitLSN(), db.Log.FlushedLSN())
+}
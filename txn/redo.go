@@ -0,0 +1,174 @@
+package txn
+
+import (
+	"cmp"
+	"github.com/naveen246/kite-db/wal"
+	"slices"
+	"time"
+)
+
+/*
+Redo recovers a DB to a point in time, starting from a base backup of its data files and replaying the log.
+The log records are replayed from the oldest to the latest, repeating history:
++==================+===========================================================================+
+| Record           | Replay                                                                    |
++==================+===========================================================================+
+| SetInt/SetString | the new value is written                                                  |
+| CreateFile       | the file is created                                                       |
+| Commit           | the files dropped and truncated by the transaction are removed/truncated  |
+| Rollback         | the changes of the transaction are undone, from the latest to the oldest  |
+| CheckPoint       | the changes of the transactions that did not finish are undone            |
++------------------+---------------------------------------------------------------------------+
+A CheckPoint record is written by recover after a crash, once it has rolled back the transactions that did not finish,
+so those transactions are rolled back here too. Once the target is reached, the transactions that did not finish
+are rolled back the same way.
+
+The backup may have been copied while the DB was in use. The changes of the transactions that finished
+before backupLSN were already on disk when the copy started, so only the records after backupLSN are replayed.
+The records before it are read to know the changes of the transactions running during the backup:
+if such a transaction commits after backupLSN, its earlier changes are replayed when its Commit record is reached
+(its locks kept other transactions from changing the same values in between),
+and if it rolls back or does not finish, all its changes are undone.
+*/
+
+// RecoveryTarget is the point in time a DB is recovered to by Redo.
+// The log is replayed up to the record at LSN, or up to the last transaction committed at or before Time.
+// A zero LSN or Time is not a limit, when both are zero the whole log is replayed.
+type RecoveryTarget struct {
+	LSN  int64
+	Time time.Time
+}
+
+// reached reports whether the record at lsn is past the target, so it and the records after it are not replayed
+func (t RecoveryTarget) reached(lsn int64, record LogRecord) bool {
+	if t.LSN > 0 && lsn > t.LSN {
+		return true
+	}
+	commit, ok := record.(*CommitRecord)
+	return ok && !t.Time.IsZero() && commit.commitTime.After(t.Time)
+}
+
+// loggedRecord is a log record along with its LSN
+type loggedRecord struct {
+	lsn    int64
+	record LogRecord
+}
+
+// Redo replays the records of log onto the data files of the transaction, see above.
+// The data files must be a copy of the DB taken when the latest record of the DB log was at backupLSN,
+// and log must hold all the records of the DB (usually the archive of the log, see wal.WithArchive).
+// The changes are made without logging them, and are written to disk when tx commits.
+// Returns the LSN of the last record replayed.
+func (tx *Transaction) Redo(log *wal.Log, backupLSN int64, target RecoveryTarget) (int64, error) {
+	iter, err := log.ForwardIterator(0)
+	if err != nil {
+		return 0, err
+	}
+
+	// the records of the transactions that have not finished, in the order they were written
+	active := make(map[TxID][]loggedRecord)
+	var lastLSN int64
+	for iter.HasNext() {
+		record, err := nextLogRecord(iter)
+		if err != nil {
+			return lastLSN, err
+		}
+		lsn := iter.LSN()
+		if target.reached(lsn, record) {
+			break
+		}
+		lastLSN = lsn
+		replay := lsn > backupLSN
+
+		txNum := record.txNumber()
+		switch record.recordType() {
+		case Start:
+		case CheckPoint:
+			// recover rolled back the transactions that had not finished before it wrote the checkpoint
+			if replay {
+				err = undoUnfinished(tx, active)
+				if err != nil {
+					return lastLSN, err
+				}
+			}
+			clear(active)
+		case Commit:
+			if replay {
+				err = tx.redoCommitted(active[txNum], backupLSN)
+				if err != nil {
+					return lastLSN, err
+				}
+			}
+			delete(active, txNum)
+		case Rollback:
+			if replay {
+				err = undoRecords(tx, active[txNum])
+				if err != nil {
+					return lastLSN, err
+				}
+			}
+			delete(active, txNum)
+		default:
+			if replay {
+				err = record.redo(tx)
+				if err != nil {
+					return lastLSN, err
+				}
+			}
+			active[txNum] = append(active[txNum], loggedRecord{lsn, record})
+		}
+	}
+
+	// roll back the transactions that did not finish before the target
+	return lastLSN, undoUnfinished(tx, active)
+}
+
+// undoUnfinished undoes the records of the transactions that have not finished, from the latest to the oldest
+func undoUnfinished(tx *Transaction, active map[TxID][]loggedRecord) error {
+	return undoRecords(tx, unfinishedRecords(active))
+}
+
+// unfinishedRecords returns the records of the transactions that have not finished, in LSN order
+func unfinishedRecords(active map[TxID][]loggedRecord) []loggedRecord {
+	var unfinished []loggedRecord
+	for _, records := range active {
+		unfinished = append(unfinished, records...)
+	}
+	slices.SortFunc(unfinished, func(a, b loggedRecord) int {
+		return cmp.Compare(a.lsn, b.lsn)
+	})
+	return unfinished
+}
+
+// undoRecords undoes the records from the latest to the oldest
+func undoRecords(tx *Transaction, records []loggedRecord) error {
+	for i := len(records) - 1; i >= 0; i-- {
+		err := records[i].record.undo(tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redoCommitted replays the records of a committed transaction written before backupLSN,
+// then removes the files dropped and truncates the files truncated by the transaction
+func (tx *Transaction) redoCommitted(records []loggedRecord, backupLSN int64) error {
+	for _, logged := range records {
+		if logged.lsn <= backupLSN {
+			err := logged.record.redo(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch r := logged.record.(type) {
+		case *DropFileRecord:
+			tx.pendingDrops[r.filename] = true
+			delete(tx.pendingTruncates, r.filename)
+		case *TruncateFileRecord:
+			tx.pendingTruncates[r.filename] = r.blockCount
+		}
+	}
+	return tx.applyPendingFileOps()
+}
@@ -1,16 +1,26 @@
 package txn
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/naveen246/kite-db/buffer"
 	"github.com/naveen246/kite-db/file"
 	"github.com/naveen246/kite-db/wal"
 	"github.com/sasha-s/go-deadlock"
-	"log"
 	"time"
 )
 
 const EndOfFile = -1
 
+var (
+	ErrFileExists      = errors.New("file already exists")
+	ErrFileNotFound    = errors.New("file does not exist")
+	ErrPendingTruncate = errors.New("file is truncated by the transaction and cannot be extended before commit")
+	ErrBlockNotPinned  = errors.New("block is not pinned by the transaction")
+	ErrReadOnlyTx      = errors.New("transaction is read-only")
+)
+
 type TxID int64
 
 var nextTxNum struct {
@@ -35,40 +45,86 @@ type Transaction struct {
 	concurMgr   *concurrencyMgr
 	recoveryMgr *RecoveryMgr
 	buffers     *BufferList
+
+	// files dropped and truncated by the transaction, these are applied to the files only after commit.
+	// pendingTruncates maps filename to the number of blocks the file is truncated to.
+	pendingDrops     map[string]bool
+	pendingTruncates map[string]int64
+
+	// readOnly is set for the transactions created by NewReadOnlyTransaction
+	readOnly bool
 }
 
-func NewTransaction(fileMgr *file.FileMgr, log *wal.Log, bufferPool *buffer.BufferPool) *Transaction {
+// NewTransaction creates a transaction and writes its Start record to the log
+func NewTransaction(fileMgr *file.FileMgr, log *wal.Log, bufferPool *buffer.BufferPool) (*Transaction, error) {
 	tx := &Transaction{}
 	tx.bufferPool = bufferPool
 	tx.fileMgr = fileMgr
 	tx.TxNum = nextTxNumber()
 	tx.concurMgr = newConcurrencyMgr()
-	tx.recoveryMgr = NewRecoveryMgr(tx, tx.TxNum, log, bufferPool)
+	recoveryMgr, err := NewRecoveryMgr(tx, tx.TxNum, log, bufferPool)
+	if err != nil {
+		return nil, err
+	}
+	tx.recoveryMgr = recoveryMgr
 	tx.buffers = NewBufferList(bufferPool)
+	tx.pendingDrops = make(map[string]bool)
+	tx.pendingTruncates = make(map[string]int64)
+	return tx, nil
+}
+
+// NewReadOnlyTransaction creates a transaction that can only read blocks, such as the transactions of a follower DB.
+// It writes nothing to the log, and every change fails with ErrReadOnlyTx.
+func NewReadOnlyTransaction(fileMgr *file.FileMgr, log *wal.Log, bufferPool *buffer.BufferPool) *Transaction {
+	tx := &Transaction{}
+	tx.bufferPool = bufferPool
+	tx.fileMgr = fileMgr
+	tx.TxNum = nextTxNumber()
+	tx.concurMgr = newConcurrencyMgr()
+	tx.recoveryMgr = &RecoveryMgr{log: log, bufPool: bufferPool, tx: tx, txNum: tx.TxNum, readOnly: true}
+	tx.buffers = NewBufferList(bufferPool)
+	tx.pendingDrops = make(map[string]bool)
+	tx.pendingTruncates = make(map[string]int64)
+	tx.readOnly = true
 	return tx
 }
 
 // Commit the current transaction.
 // Flush all modified buffers (and their log records),
-// write and flush a Commit record to the log,
-// release all locks, and unpin any pinned buffers.
-func (tx *Transaction) Commit() {
-	tx.recoveryMgr.commit()
-	tx.ReleaseLocks()
+// write and flush a Commit record to the log (unless the log uses asynchronous commit), unpin any pinned buffers,
+// remove the files dropped and truncate the files truncated by the transaction, and release all locks.
+// If the Commit record could not be written, the transaction is left as is, and the caller should Rollback.
+// If a file could not be removed or truncated, the transaction is committed and the error is returned,
+// the operation is applied again by recovery when the DB is restarted.
+func (tx *Transaction) Commit() error {
+	err := tx.recoveryMgr.commit()
+	if err != nil {
+		return err
+	}
 	tx.buffers.unpinAll()
+	err = tx.applyPendingFileOps()
+	tx.ReleaseLocks()
+	return err
+}
+
+// CommitLSN returns the LSN of the Commit record of the transaction, 0 if it did not commit.
+// With asynchronous commit, Log.WaitDurable(tx.CommitLSN()) waits until the commit is durable.
+func (tx *Transaction) CommitLSN() int64 {
+	return tx.recoveryMgr.commitLSN
 }
 
 // Rollback the current transaction.
-// Undo any modified values, flush those buffers,
-// write and flush a Rollback record to the log,
-// release all locks, and unpin any pinned buffers.
+// Unpin any pinned buffers, undo any modified values, flush those buffers,
+// write and flush a Rollback record to the log, and release all locks.
 func (tx *Transaction) Rollback() error {
+	tx.buffers.unpinAll()
 	err := tx.recoveryMgr.rollback()
 	if err != nil {
 		return err
 	}
+	clear(tx.pendingDrops)
+	clear(tx.pendingTruncates)
 	tx.ReleaseLocks()
-	tx.buffers.unpinAll()
 	return nil
 }
 
@@ -76,12 +132,14 @@ func (tx *Transaction) Rollback() error {
 // Then go through the log, rolling back all uncommitted transactions.
 // Finally, write a checkpoint record to the log.
 func (tx *Transaction) Recover() error {
-	tx.bufferPool.FlushAll(int64(tx.TxNum))
-	err := tx.recoveryMgr.recover()
+	if tx.readOnly {
+		return ErrReadOnlyTx
+	}
+	err := tx.bufferPool.FlushAll(int64(tx.TxNum))
 	if err != nil {
 		return err
 	}
-	return nil
+	return tx.recoveryMgr.recover()
 }
 
 func (tx *Transaction) ReleaseLocks() {
@@ -89,8 +147,17 @@ func (tx *Transaction) ReleaseLocks() {
 }
 
 // Pin the specified block. The transaction manages the buffer for the client.
-func (tx *Transaction) Pin(block file.Block) {
-	tx.buffers.pin(block)
+// Returns buffer.ErrBufferAbort if no buffer became available within buffer.MaxPinWait.
+func (tx *Transaction) Pin(block file.Block) error {
+	ctx, cancel := context.WithTimeout(context.Background(), buffer.MaxPinWait)
+	defer cancel()
+	return tx.PinContext(ctx, block)
+}
+
+// PinContext Pin the specified block like Pin, but waits for a buffer until ctx is done.
+// Returns buffer.ErrBufferAbort if no buffer became available before.
+func (tx *Transaction) PinContext(ctx context.Context, block file.Block) error {
+	return tx.buffers.pin(ctx, block)
 }
 
 // Unpin the specified block.
@@ -107,10 +174,13 @@ func (tx *Transaction) GetInt(block file.Block, offset int) (int, error) {
 		return 0, err
 	}
 
-	buf := tx.buffers.getBuffer(block)
+	buf, err := tx.buffers.getBuffer(block)
+	if err != nil {
+		return 0, err
+	}
 	val, err := buf.Contents.GetInt(int64(offset))
 	if err != nil {
-		log.Fatalln("Transaction GetInt err:", err)
+		return 0, fmt.Errorf("could not get int at %v in %v: %w", offset, block, err)
 	}
 
 	return int(val), nil
@@ -124,10 +194,13 @@ func (tx *Transaction) GetString(block file.Block, offset int) (string, error) {
 		return "", err
 	}
 
-	buf := tx.buffers.getBuffer(block)
+	buf, err := tx.buffers.getBuffer(block)
+	if err != nil {
+		return "", err
+	}
 	val, err := buf.Contents.GetString(int64(offset))
 	if err != nil {
-		log.Fatalln("Transaction GetString err:", err)
+		return "", fmt.Errorf("could not get string at %v in %v: %w", offset, block, err)
 	}
 
 	return val, nil
@@ -136,23 +209,32 @@ func (tx *Transaction) GetString(block file.Block, offset int) (string, error) {
 // SetInt Store an integer at the specified offset of the specified block.
 // The method first obtains an xLock on the block.
 // It then reads the current value at that offset,
-// puts it into an update log record, and writes that record to the log.
+// puts it into an update log record along with the new value, and writes that record to the log.
 // Finally, it calls the buffer to store the value, passing in the LSN of the log record and the transaction's id.
 func (tx *Transaction) SetInt(block file.Block, offset int64, val int, okToLog bool) error {
+	if tx.readOnly {
+		return ErrReadOnlyTx
+	}
 	err := tx.concurMgr.xLock(block, tx.TxNum)
 	if err != nil {
 		return err
 	}
 
-	buf := tx.buffers.getBuffer(block)
+	buf, err := tx.buffers.getBuffer(block)
+	if err != nil {
+		return err
+	}
 	var lsn int64 = -1
 	if okToLog {
-		lsn = tx.recoveryMgr.setInt(buf, offset)
+		lsn, err = tx.recoveryMgr.setInt(buf, offset, val)
+		if err != nil {
+			return err
+		}
 	}
 
 	err = buf.Contents.SetInt(offset, int64(val))
 	if err != nil {
-		log.Fatalln("Transaction SetInt err:", err)
+		return fmt.Errorf("could not set int at %v in %v: %w", offset, block, err)
 	}
 
 	buf.SetModified(int64(tx.TxNum), lsn)
@@ -162,23 +244,32 @@ func (tx *Transaction) SetInt(block file.Block, offset int64, val int, okToLog b
 // SetString Store a string at the specified offset of the specified block.
 // The method first obtains an xLock on the block.
 // It then reads the current value at that offset,
-// puts it into an update log record, and writes that record to the log.
+// puts it into an update log record along with the new value, and writes that record to the log.
 // Finally, it calls the buffer to store the value, passing in the LSN of the log record and the transaction's id.
 func (tx *Transaction) SetString(block file.Block, offset int64, val string, okToLog bool) error {
+	if tx.readOnly {
+		return ErrReadOnlyTx
+	}
 	err := tx.concurMgr.xLock(block, tx.TxNum)
 	if err != nil {
 		return err
 	}
 
-	buf := tx.buffers.getBuffer(block)
+	buf, err := tx.buffers.getBuffer(block)
+	if err != nil {
+		return err
+	}
 	var lsn int64 = -1
 	if okToLog {
-		lsn = tx.recoveryMgr.setString(buf, offset)
+		lsn, err = tx.recoveryMgr.setString(buf, offset, val)
+		if err != nil {
+			return err
+		}
 	}
 
 	err = buf.Contents.SetString(int64(offset), val)
 	if err != nil {
-		log.Fatalln("Transaction SetString err:", err)
+		return fmt.Errorf("could not set string at %v in %v: %w", offset, block, err)
 	}
 
 	buf.SetModified(int64(tx.TxNum), lsn)
@@ -199,23 +290,44 @@ func (tx *Transaction) Size(filename string) (int, error) {
 		return 0, err
 	}
 
-	return int(tx.fileMgr.BlockCount(filename)), nil
+	blockCount, err := tx.blockCount(filename)
+	if err != nil {
+		return 0, err
+	}
+	return int(blockCount), nil
 }
 
 // Append a new block to the end of the specified file and returns a reference to it.
 // This method first obtains an xLock on the "end of the file" (eofBlock), before performing the append.
+// If the file does not exist, it is created as with CreateFile.
 func (tx *Transaction) Append(filename string) (file.Block, error) {
+	if tx.readOnly {
+		return file.Block{}, ErrReadOnlyTx
+	}
 	eofBlock := file.GetBlock(filename, EndOfFile)
 	err := tx.concurMgr.xLock(eofBlock, tx.TxNum)
 	if err != nil {
 		return file.Block{}, err
 	}
 
-	block, err := tx.fileMgr.Append(filename)
+	if tx.pendingDrops[filename] {
+		return file.Block{}, fmt.Errorf("%w: %v", ErrFileNotFound, filename)
+	}
+	if _, ok := tx.pendingTruncates[filename]; ok {
+		return file.Block{}, fmt.Errorf("%w: %v", ErrPendingTruncate, filename)
+	}
+	exists, err := tx.fileMgr.Exists(filename)
 	if err != nil {
-		log.Fatalln("Transaction Append err:", err)
+		return file.Block{}, err
+	}
+	if !exists {
+		err = tx.createFile(filename)
+		if err != nil {
+			return file.Block{}, err
+		}
 	}
-	return block, nil
+
+	return tx.fileMgr.Append(filename)
 }
 
 func (tx *Transaction) BlockSize() int {
@@ -240,20 +352,33 @@ func NewBufferList(pool *buffer.BufferPool) *BufferList {
 }
 
 // getBuffer Return the buffer pinned to the specified block.
-func (b *BufferList) getBuffer(block file.Block) *buffer.Buffer {
-	return b.buffers[block]
+// Returns ErrBlockNotPinned if the block is not pinned.
+func (b *BufferList) getBuffer(block file.Block) (*buffer.Buffer, error) {
+	buf := b.buffers[block]
+	if buf == nil {
+		return nil, fmt.Errorf("%w: %v", ErrBlockNotPinned, block)
+	}
+	return buf, nil
 }
 
 // pin the block and keep track of the buffer internally.
-func (b *BufferList) pin(block file.Block) {
-	buf := b.bufPool.PinBuffer(block)
+// Nothing is tracked if the block could not be pinned.
+func (b *BufferList) pin(ctx context.Context, block file.Block) error {
+	buf, err := b.bufPool.PinBufferContext(ctx, block)
+	if err != nil {
+		return err
+	}
 	b.buffers[block] = buf
 	b.pinCount[block] = b.pinCount[block] + 1
+	return nil
 }
 
-// unpin the specified block.
+// unpin the specified block, if it is pinned.
 func (b *BufferList) unpin(block file.Block) {
 	buf := b.buffers[block]
+	if buf == nil {
+		return
+	}
 	b.bufPool.UnpinBuffer(buf)
 
 	b.pinCount[block] = b.pinCount[block] - 1
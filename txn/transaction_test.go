@@ -1,11 +1,17 @@
 package txn_test
 
 import (
+	"context"
+	"github.com/naveen246/kite-db/buffer"
 	"github.com/naveen246/kite-db/file"
 	"github.com/naveen246/kite-db/server"
+	"github.com/naveen246/kite-db/txn"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -19,29 +25,43 @@ func createFile(fileMgr *file.FileMgr, filename string) {
 	f.Truncate(1e5)
 }
 
+func newTx(t *testing.T, db *server.DB) *txn.Transaction {
+	tx, err := db.NewTx()
+	assert.NoError(t, err)
+	return tx
+}
+
+// removeFile removes filename, the segment files of the log filename and dbDir
 func removeFile(filename string, dbDir string) {
 	os.Remove(filename)
+	segmentFiles, _ := filepath.Glob(filename + ".*")
+	for _, segmentFile := range segmentFiles {
+		os.Remove(segmentFile)
+	}
+	os.Remove(filepath.Join(dbDir, file.LockFile))
 	os.Remove(dbDir)
 }
 
 func TestTxn(t *testing.T) {
-	db := server.NewDB(dbDir, blockTestSize, 8)
+	db, err := server.NewDB(dbDir, blockTestSize, 8)
+	assert.NoError(t, err)
 	createFile(db.FileMgr, filename)
 	defer removeFile(db.FileMgr.DbFilePath(filename), dbDir)
 	defer removeFile(db.FileMgr.DbFilePath(db.Log.LogFile), dbDir)
+	defer db.Close()
 
 	blk := file.GetBlock(filename, 1)
 
 	// tx1: set [intVal = 1, stringVal = "one"] in the block
-	tx1 := db.NewTx()
+	tx1 := newTx(t, db)
 	tx1.Pin(blk)
 	tx1.SetInt(blk, 80, 1, false)
 	tx1.SetString(blk, 40, "one", false)
-	tx1.Commit()
+	assert.NoError(t, tx1.Commit())
 
 	// tx2: verify that [intVal = 1, stringVal = "one"] as set by tx1
 	// and change them to new values [intVal = 2, stringVal = "one!"]
-	tx2 := db.NewTx()
+	tx2 := newTx(t, db)
 	tx2.Pin(blk)
 	iVal, _ := tx2.GetInt(blk, 80)
 	sVal, _ := tx2.GetString(blk, 40)
@@ -51,11 +71,11 @@ func TestTxn(t *testing.T) {
 	newSVal := sVal + "!"
 	tx2.SetInt(blk, 80, newIVal, true)
 	tx2.SetString(blk, 40, newSVal, true)
-	tx2.Commit()
+	assert.NoError(t, tx2.Commit())
 
 	// tx3: verify that we can see the changes [intVal = 2, stringVal = "one!"] made by tx2
 	// change int value to [intVal = 9999], verify the change and then rollback
-	tx3 := db.NewTx()
+	tx3 := newTx(t, db)
 	tx3.Pin(blk)
 	iVal, _ = tx3.GetInt(blk, 80)
 	sVal, _ = tx3.GetString(blk, 40)
@@ -67,9 +87,153 @@ func TestTxn(t *testing.T) {
 	tx3.Rollback()
 
 	// tx4: verify that tx3 changes were rolled back, and we can see the old int value [intVal = 2]
-	tx4 := db.NewTx()
+	tx4 := newTx(t, db)
 	tx4.Pin(blk)
 	iVal, _ = tx4.GetInt(blk, 80)
 	assert.Equal(t, 2, iVal)
-	tx4.Commit()
+	assert.NoError(t, tx4.Commit())
+}
+
+func TestTxnInMemory(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx1 := newTx(t, db)
+	blk, err := tx1.Append(filename)
+	assert.NoError(t, err)
+	tx1.Pin(blk)
+	assert.NoError(t, tx1.SetInt(blk, 80, 1, true))
+	assert.NoError(t, tx1.SetString(blk, 40, "one", true))
+	assert.NoError(t, tx1.Commit())
+
+	tx2 := newTx(t, db)
+	tx2.Pin(blk)
+	assert.NoError(t, tx2.SetInt(blk, 80, 2, true))
+	assert.NoError(t, tx2.Rollback())
+
+	tx3 := newTx(t, db)
+	tx3.Pin(blk)
+	iVal, _ := tx3.GetInt(blk, 80)
+	sVal, _ := tx3.GetString(blk, 40)
+	assert.Equal(t, 1, iVal)
+	assert.Equal(t, "one", sVal)
+	assert.NoError(t, tx3.Commit())
+
+	// nothing is written to disk
+	_, err = os.Stat(file.MemoryDir)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestTxnErrors(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx := newTx(t, db)
+	blk, err := tx.Append(filename)
+	assert.NoError(t, err)
+
+	// the block has to be pinned before it is accessed
+	_, err = tx.GetInt(blk, 0)
+	assert.ErrorIs(t, err, txn.ErrBlockNotPinned)
+	assert.ErrorIs(t, tx.SetString(blk, 0, "abc", true), txn.ErrBlockNotPinned)
+
+	// offsets outside the block are returned as errors
+	tx.Pin(blk)
+	_, err = tx.GetInt(blk, int(blockTestSize))
+	assert.ErrorIs(t, err, file.ErrOutOfBounds)
+	assert.ErrorIs(t, tx.SetInt(blk, blockTestSize-1, 1, true), file.ErrOutOfBounds)
+
+	// a block that cannot be read is not pinned
+	missing := file.GetBlock(filename, 5)
+	assert.Error(t, tx.Pin(missing))
+	_, err = tx.GetInt(missing, 0)
+	assert.ErrorIs(t, err, txn.ErrBlockNotPinned)
+	tx.Unpin(missing)
+	assert.NoError(t, tx.Commit())
+}
+
+func TestPinCorruptBlock(t *testing.T) {
+	db, err := server.NewDB(t.TempDir(), blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+	tx1 := newTx(t, db)
+	block, err := tx1.Append(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, tx1.Commit())
+	f, err := os.OpenFile(db.FileMgr.DbFilePath(filename), os.O_RDWR, 0666)
+	assert.NoError(t, err)
+	_, err = f.WriteAt([]byte("x"), 10)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	// the error of the buffer pool reaches the caller of Pin, and the block is not pinned
+	tx2 := newTx(t, db)
+	assert.ErrorIs(t, tx2.Pin(block), file.ErrCorruptBlock)
+	_, err = tx2.GetInt(block, 0)
+	assert.ErrorIs(t, err, txn.ErrBlockNotPinned)
+	assert.ErrorIs(t, tx2.SetInt(block, 0, 1, true), txn.ErrBlockNotPinned)
+	tx2.Unpin(block)
+	assert.NoError(t, tx2.Rollback())
+}
+
+func TestPinContext(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 2)
+	assert.NoError(t, err)
+	defer db.Close()
+	for i := 0; i < 3; i++ {
+		_, err = db.FileMgr.Append(filename)
+		assert.NoError(t, err)
+	}
+
+	tx1 := newTx(t, db)
+	assert.NoError(t, tx1.Pin(file.GetBlock(filename, 0)))
+	assert.NoError(t, tx1.Pin(file.GetBlock(filename, 1)))
+
+	// all the buffers are pinned, the caller chooses how long to wait for one
+	tx2 := newTx(t, db)
+	block := file.GetBlock(filename, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = tx2.PinContext(ctx, block)
+	assert.ErrorIs(t, err, buffer.ErrBufferAbort)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), buffer.MaxPinWait)
+	_, err = tx2.GetInt(block, 0)
+	assert.ErrorIs(t, err, txn.ErrBlockNotPinned)
+
+	assert.NoError(t, tx1.Commit())
+	assert.NoError(t, tx2.PinContext(context.Background(), block))
+	_, err = tx2.GetInt(block, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, tx2.Commit())
+}
+
+func TestLongString(t *testing.T) {
+	db, err := server.NewDB(file.MemoryDir, blockTestSize, 8)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// a string filling the block is logged in a record larger than a log block
+	maxLen := int(blockTestSize - file.IntSize)
+	tx1 := newTx(t, db)
+	blk, err := tx1.Append(filename)
+	assert.NoError(t, err)
+	tx1.Pin(blk)
+	assert.NoError(t, tx1.SetString(blk, 0, strings.Repeat("a", maxLen), true))
+	assert.NoError(t, tx1.Commit())
+
+	tx2 := newTx(t, db)
+	tx2.Pin(blk)
+	assert.NoError(t, tx2.SetString(blk, 0, strings.Repeat("b", maxLen), true))
+	assert.NoError(t, tx2.Rollback())
+
+	tx3 := newTx(t, db)
+	tx3.Pin(blk)
+	val, err := tx3.GetString(blk, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", maxLen), val)
+	assert.NoError(t, tx3.Commit())
 }
@@ -1,10 +1,11 @@
 package txn
 
 import (
+	"errors"
 	"fmt"
 	"github.com/naveen246/kite-db/file"
 	"github.com/naveen246/kite-db/wal"
-	log2 "log"
+	"time"
 )
 
 const (
@@ -14,24 +15,33 @@ const (
 	Rollback
 	SetInt
 	SetString
+	CreateFile
+	DropFile
+	TruncateFile
 )
 
+// ErrInvalidLogRecord is returned when a log record read from the log cannot be decoded
+var ErrInvalidLogRecord = errors.New("invalid log record")
+
 // LogRecord The interface implemented by each type of log record
 type LogRecord interface {
 	recordType() int
 	txNumber() TxID
 	undo(tx *Transaction) error
+	redo(tx *Transaction) error
 }
 
-func createLogRecord(bytes []byte) LogRecord {
+// createLogRecord decodes a log record read from the log.
+// Returns ErrInvalidLogRecord if the record type is unknown or the record is truncated.
+func createLogRecord(bytes []byte) (LogRecord, error) {
 	page := file.NewPageWithBytes(bytes)
 	recordType, err := page.GetInt(0)
 	if err != nil {
-		log2.Fatalln("Failed to create log record: ", err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLogRecord, err)
 	}
 	switch recordType {
 	case CheckPoint:
-		return newCheckpointRecord()
+		return newCheckpointRecord(), nil
 	case Start:
 		return newStartRecord(page)
 	case Commit:
@@ -42,8 +52,19 @@ func createLogRecord(bytes []byte) LogRecord {
 		return newSetIntRecord(page)
 	case SetString:
 		return newSetStringRecord(page)
+	case CreateFile:
+		return newCreateFileRecord(page)
+	case DropFile:
+		return newDropFileRecord(page)
+	case TruncateFile:
+		return newTruncateFileRecord(page)
 	}
-	return nil
+	return nil, fmt.Errorf("%w: unknown record type %v", ErrInvalidLogRecord, recordType)
+}
+
+// invalidRecord wraps an error that occurred while decoding a log record of the given type
+func invalidRecord(recordType string, err error) error {
+	return fmt.Errorf("%w: %v record, %w", ErrInvalidLogRecord, recordType, err)
 }
 
 /*************** CheckpointRecord ********************************************/
@@ -72,6 +93,11 @@ func (c *CheckpointRecord) undo(tx *Transaction) error {
 	return nil
 }
 
+// Does nothing, because a checkpoint record contains no redo information.
+func (c *CheckpointRecord) redo(tx *Transaction) error {
+	return nil
+}
+
 func (c *CheckpointRecord) String() string {
 	return "<CHECKPOINT>"
 }
@@ -79,12 +105,12 @@ func (c *CheckpointRecord) String() string {
 // WriteCheckPointToLog write a CheckPoint record to the log.
 // This log record contains the CheckPoint operator, and nothing else.
 // returns lsn of the appended CheckPoint record
-func WriteCheckPointToLog(log *wal.Log) int64 {
+func WriteCheckPointToLog(log *wal.Log) (int64, error) {
 	record := make([]byte, file.IntSize)
 	page := file.NewPageWithBytes(record)
 	err := page.SetInt(0, CheckPoint)
 	if err != nil {
-		log2.Fatalln("Failed to write CheckPoint record to Log: ", err)
+		return 0, fmt.Errorf("could not write CheckPoint record: %w", err)
 	}
 	return log.Append(record)
 }
@@ -97,14 +123,14 @@ type StartRecord struct {
 	txNum TxID
 }
 
-func newStartRecord(page *file.Page) *StartRecord {
+func newStartRecord(page *file.Page) (*StartRecord, error) {
 	txNumber, err := page.GetInt(file.IntSize)
 	if err != nil {
-		log2.Fatalln("Failed to create start record: ", err)
+		return nil, invalidRecord("Start", err)
 	}
 	return &StartRecord{
 		txNum: TxID(txNumber),
-	}
+	}, nil
 }
 
 func (s *StartRecord) recordType() int {
@@ -120,6 +146,11 @@ func (s *StartRecord) undo(tx *Transaction) error {
 	return nil
 }
 
+// Does nothing, because a start record contains no redo information.
+func (s *StartRecord) redo(tx *Transaction) error {
+	return nil
+}
+
 func (s *StartRecord) String() string {
 	return fmt.Sprintf("<START %v>", s.txNum)
 }
@@ -127,18 +158,10 @@ func (s *StartRecord) String() string {
 // WriteStartRecToLog write a Start record to the log.
 // This log record contains the Start operator, followed by the transaction id.
 // returns lsn of the appended Start record
-func WriteStartRecToLog(log *wal.Log, txNum TxID) int64 {
-	record := make([]byte, 2*file.IntSize)
-	page := file.NewPageWithBytes(record)
-
-	err := page.SetInt(0, Start)
-	if err != nil {
-		log2.Fatalln("Failed to write Start record to Log: ", err)
-	}
-
-	err = page.SetInt(file.IntSize, int64(txNum))
+func WriteStartRecToLog(log *wal.Log, txNum TxID) (int64, error) {
+	record, err := txRecord(Start, txNum)
 	if err != nil {
-		log2.Fatalln("Failed to write Start record to Log: ", err)
+		return 0, fmt.Errorf("could not write Start record: %w", err)
 	}
 	return log.Append(record)
 }
@@ -146,19 +169,27 @@ func WriteStartRecToLog(log *wal.Log, txNum TxID) int64 {
 /*************** CommitRecord ************************************************/
 
 // CommitRecord in log ->
-// <Commit, TxID>
+// <Commit, TxID, commitTime>
+// commitTime is the wall-clock time of the commit in nanoseconds since the Unix epoch,
+// it is used to recover the DB to a point in time (see Redo).
 type CommitRecord struct {
-	txNum TxID
+	txNum      TxID
+	commitTime time.Time
 }
 
-func newCommitRecord(page *file.Page) *CommitRecord {
+func newCommitRecord(page *file.Page) (*CommitRecord, error) {
 	txNumber, err := page.GetInt(file.IntSize)
 	if err != nil {
-		log2.Fatalln("Failed to create commit record: ", err)
+		return nil, invalidRecord("Commit", err)
 	}
-	return &CommitRecord{
-		txNum: TxID(txNumber),
+	commitTime, err := page.GetInt(2 * file.IntSize)
+	if err != nil {
+		return nil, invalidRecord("Commit", err)
 	}
+	return &CommitRecord{
+		txNum:      TxID(txNumber),
+		commitTime: time.Unix(0, commitTime),
+	}, nil
 }
 
 func (c *CommitRecord) recordType() int {
@@ -174,25 +205,30 @@ func (c *CommitRecord) undo(tx *Transaction) error {
 	return nil
 }
 
+// Does nothing, the files dropped and truncated by the transaction are handled by Redo.
+func (c *CommitRecord) redo(tx *Transaction) error {
+	return nil
+}
+
 func (c *CommitRecord) String() string {
-	return fmt.Sprintf("<COMMIT %v>", c.txNum)
+	return fmt.Sprintf("<COMMIT %v %v>", c.txNum, c.commitTime.UTC().Format(time.RFC3339Nano))
 }
 
 // WriteCommitRecToLog write a Commit record to the log.
-// This log record contains the Commit operator, followed by the transaction id.
+// This log record contains the Commit operator, followed by the transaction id and the current time.
 // returns lsn of the appended Commit record
-func WriteCommitRecToLog(log *wal.Log, txNum TxID) int64 {
-	record := make([]byte, 2*file.IntSize)
+func WriteCommitRecToLog(log *wal.Log, txNum TxID) (int64, error) {
+	record := make([]byte, 3*file.IntSize)
 	page := file.NewPageWithBytes(record)
-
 	err := page.SetInt(0, Commit)
-	if err != nil {
-		log2.Fatalln("Failed to write Commit record to Log: ", err)
+	if err == nil {
+		err = page.SetInt(file.IntSize, int64(txNum))
+	}
+	if err == nil {
+		err = page.SetInt(2*file.IntSize, time.Now().UnixNano())
 	}
-
-	err = page.SetInt(file.IntSize, int64(txNum))
 	if err != nil {
-		log2.Fatalln("Failed to write Commit record to Log: ", err)
+		return 0, fmt.Errorf("could not write Commit record: %w", err)
 	}
 	return log.Append(record)
 }
@@ -205,14 +241,14 @@ type RollbackRecord struct {
 	txNum TxID
 }
 
-func newRollbackRecord(page *file.Page) *RollbackRecord {
+func newRollbackRecord(page *file.Page) (*RollbackRecord, error) {
 	txNumber, err := page.GetInt(file.IntSize)
 	if err != nil {
-		log2.Fatalln("Failed to create Rollback record: ", err)
+		return nil, invalidRecord("Rollback", err)
 	}
 	return &RollbackRecord{
 		txNum: TxID(txNumber),
-	}
+	}, nil
 }
 
 func (r *RollbackRecord) recordType() int {
@@ -228,6 +264,11 @@ func (r *RollbackRecord) undo(tx *Transaction) error {
 	return nil
 }
 
+// Does nothing, the changes of the transaction are undone by Redo.
+func (r *RollbackRecord) redo(tx *Transaction) error {
+	return nil
+}
+
 func (r *RollbackRecord) String() string {
 	return fmt.Sprintf("<ROLLBACK %v>", r.txNum)
 }
@@ -235,72 +276,65 @@ func (r *RollbackRecord) String() string {
 // WriteRollbackRecToLog write a Rollback record to the log.
 // This log record contains the Rollback operator, followed by the transaction id.
 // returns lsn of the appended Rollback record
-func WriteRollbackRecToLog(log *wal.Log, txNum TxID) int64 {
-	errMsg := "Failed to write Rollback record to Log: "
+func WriteRollbackRecToLog(log *wal.Log, txNum TxID) (int64, error) {
+	record, err := txRecord(Rollback, txNum)
+	if err != nil {
+		return 0, fmt.Errorf("could not write Rollback record: %w", err)
+	}
+	return log.Append(record)
+}
+
+// txRecord returns a log record containing the operator, followed by the transaction id.
+func txRecord(operator int, txNum TxID) ([]byte, error) {
 	record := make([]byte, 2*file.IntSize)
 	page := file.NewPageWithBytes(record)
 
-	err := page.SetInt(0, Rollback)
+	err := page.SetInt(0, int64(operator))
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, err
 	}
 
 	err = page.SetInt(file.IntSize, int64(txNum))
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, err
 	}
-	return log.Append(record)
+	return record, nil
 }
 
 /*************** SetIntRecord ************************************************/
 
 // SetIntRecord in log ->
-// <SetInt, TxID, filename, blockNumber, offset, value>
+// <SetInt, TxID, filename, blockNumber, offset, oldValue, newValue>
 type SetIntRecord struct {
 	txNum  TxID
 	offset int64
-	val    int
+	oldVal int
+	newVal int
 	block  file.Block
 }
 
-func newSetIntRecord(page *file.Page) *SetIntRecord {
-	errMsg := "Failed to create SetInt record: "
-	position := int64(file.IntSize)
-	txNumber, err := page.GetInt(position)
+func newSetIntRecord(page *file.Page) (*SetIntRecord, error) {
+	txNum, block, offset, position, err := readUpdateRecord(page)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, invalidRecord("SetInt", err)
 	}
 
-	position += file.IntSize
-	filename, err := page.GetString(position)
+	oldVal, err := page.GetInt(position)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, invalidRecord("SetInt", err)
 	}
-
-	position += file.MaxLen(len(filename))
-	blockNum, err := page.GetInt(position)
+	newVal, err := page.GetInt(position + file.IntSize)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
-	}
-
-	position += file.IntSize
-	offset, err := page.GetInt(position)
-	if err != nil {
-		log2.Fatalln(errMsg, err)
-	}
-
-	position += file.IntSize
-	val, err := page.GetInt(position)
-	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, invalidRecord("SetInt", err)
 	}
 
 	return &SetIntRecord{
-		txNum:  TxID(txNumber),
+		txNum:  txNum,
 		offset: offset,
-		val:    int(val),
-		block:  file.GetBlock(filename, blockNum),
-	}
+		oldVal: int(oldVal),
+		newVal: int(newVal),
+		block:  block,
+	}, nil
 }
 
 func (s *SetIntRecord) recordType() int {
@@ -315,8 +349,29 @@ func (s *SetIntRecord) txNumber() TxID {
 // The method pins a buffer to the specified block,
 // calls setInt to restore the saved value, and unpins the buffer.
 func (s *SetIntRecord) undo(tx *Transaction) error {
-	tx.Pin(s.block)
-	err := tx.SetInt(s.block, s.offset, s.val, false)
+	err := tx.Pin(s.block)
+	if err != nil {
+		return err
+	}
+	err = tx.SetInt(s.block, s.offset, s.oldVal, false)
+	if err != nil {
+		return err
+	}
+	tx.Unpin(s.block)
+	return nil
+}
+
+// redo Store the new value saved in the log record, appending blocks to the file if the block does not exist yet.
+func (s *SetIntRecord) redo(tx *Transaction) error {
+	err := tx.extendTo(s.block)
+	if err != nil {
+		return err
+	}
+	err = tx.Pin(s.block)
+	if err != nil {
+		return err
+	}
+	err = tx.SetInt(s.block, s.offset, s.newVal, false)
 	if err != nil {
 		return err
 	}
@@ -325,182 +380,422 @@ func (s *SetIntRecord) undo(tx *Transaction) error {
 }
 
 func (s *SetIntRecord) String() string {
-	return fmt.Sprintf("<SETINT %v %v %v %v>", s.txNum, s.block, s.offset, s.val)
+	return fmt.Sprintf("<SETINT %v %v %v %v %v>", s.txNum, s.block, s.offset, s.oldVal, s.newVal)
 }
 
 // writeSetIntRecToLog write a SetInt record to the log.
 // This log record contains the SetInt operator,
 // followed by transaction id, filename, blockNumber,
-// offset of the modified block, and the previous integer value at that offset.
+// offset of the modified block, the previous integer value at that offset and the new value.
 // returns the LSN of the appended SetInt record
-func writeSetIntRecToLog(log *wal.Log, txNum TxID, block file.Block, offset int64, val int) int64 {
-	errMsg := "Failed to write SetInt record to Log: "
+func writeSetIntRecToLog(log *wal.Log, txNum TxID, block file.Block, offset int64, oldVal int, newVal int) (int64, error) {
+	record, position, err := updateRecord(SetInt, txNum, block, offset, 2*file.IntSize)
+	if err != nil {
+		return 0, fmt.Errorf("could not write SetInt record: %w", err)
+	}
+
+	page := file.NewPageWithBytes(record)
+	err = page.SetInt(position, int64(oldVal))
+	if err == nil {
+		err = page.SetInt(position+file.IntSize, int64(newVal))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not write SetInt record: %w", err)
+	}
+
+	return log.Append(record)
+}
+
+/*************** SetStringRecord *********************************************/
+
+// SetStringRecord in log ->
+// <SetString, TxID, filename, blockNumber, offset, oldValue, newValue>
+type SetStringRecord struct {
+	txNum  TxID
+	offset int64
+	oldVal string
+	newVal string
+	block  file.Block
+}
+
+func newSetStringRecord(page *file.Page) (*SetStringRecord, error) {
+	txNum, block, offset, position, err := readUpdateRecord(page)
+	if err != nil {
+		return nil, invalidRecord("SetString", err)
+	}
+
+	oldVal, err := page.GetString(position)
+	if err != nil {
+		return nil, invalidRecord("SetString", err)
+	}
+	newVal, err := page.GetString(position + file.MaxLen(len(oldVal)))
+	if err != nil {
+		return nil, invalidRecord("SetString", err)
+	}
+
+	return &SetStringRecord{
+		txNum:  txNum,
+		offset: offset,
+		oldVal: oldVal,
+		newVal: newVal,
+		block:  block,
+	}, nil
+}
+
+func (s *SetStringRecord) recordType() int {
+	return SetString
+}
+
+func (s *SetStringRecord) txNumber() TxID {
+	return s.txNum
+}
+
+// undo Replace the specified data value with the value saved in the log record.
+// The method pins a buffer to the specified block,
+// calls SetString to restore the saved value, and unpins the buffer.
+func (s *SetStringRecord) undo(tx *Transaction) error {
+	err := tx.Pin(s.block)
+	if err != nil {
+		return err
+	}
+	err = tx.SetString(s.block, s.offset, s.oldVal, false)
+	if err != nil {
+		return err
+	}
+	tx.Unpin(s.block)
+	return nil
+}
+
+// redo Store the new value saved in the log record, appending blocks to the file if the block does not exist yet.
+func (s *SetStringRecord) redo(tx *Transaction) error {
+	err := tx.extendTo(s.block)
+	if err != nil {
+		return err
+	}
+	err = tx.Pin(s.block)
+	if err != nil {
+		return err
+	}
+	err = tx.SetString(s.block, s.offset, s.newVal, false)
+	if err != nil {
+		return err
+	}
+	tx.Unpin(s.block)
+	return nil
+}
+
+func (s *SetStringRecord) String() string {
+	return fmt.Sprintf("<SETSTRING %v %v %v %v %v>", s.txNum, s.block, s.offset, s.oldVal, s.newVal)
+}
+
+// writeSetStringRecToLog write a SetString record to the log.
+// This log record contains the SetString operator,
+// followed by transaction id, filename, blockNumber,
+// offset of the modified block, the previous string value at that offset and the new value.
+// returns the LSN of the appended SetString record
+func writeSetStringRecToLog(log *wal.Log, txNum TxID, block file.Block, offset int64, oldVal string, newVal string) (int64, error) {
+	oldLen := file.MaxLen(len(oldVal))
+	record, position, err := updateRecord(SetString, txNum, block, offset, oldLen+file.MaxLen(len(newVal)))
+	if err != nil {
+		return 0, fmt.Errorf("could not write SetString record: %w", err)
+	}
+
+	page := file.NewPageWithBytes(record)
+	err = page.SetString(position, oldVal)
+	if err == nil {
+		err = page.SetString(position+oldLen, newVal)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not write SetString record: %w", err)
+	}
+
+	return log.Append(record)
+}
+
+// updateRecord returns a log record containing the operator,
+// followed by transaction id, filename, blockNumber and offset, with room for a value of valueLen bytes.
+// The position of the value in the record is also returned.
+func updateRecord(operator int, txNum TxID, block file.Block, offset int64, valueLen int64) ([]byte, int64, error) {
 	filenameLen := file.MaxLen(len(block.Filename))
-	record := make([]byte, 5*file.IntSize+filenameLen)
+	record := make([]byte, 4*file.IntSize+filenameLen+valueLen)
 	page := file.NewPageWithBytes(record)
 
 	position := int64(0)
-	err := page.SetInt(position, SetInt)
+	err := page.SetInt(position, int64(operator))
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, 0, err
 	}
 
 	position += file.IntSize
 	err = page.SetInt(position, int64(txNum))
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, 0, err
 	}
 
 	position += file.IntSize
 	err = page.SetString(position, block.Filename)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, 0, err
 	}
 
 	position += filenameLen
 	err = page.SetInt(position, block.Number)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, 0, err
 	}
 
 	position += file.IntSize
 	err = page.SetInt(position, offset)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, 0, err
 	}
 
 	position += file.IntSize
-	err = page.SetInt(position, int64(val))
-	if err != nil {
-		log2.Fatalln(errMsg, err)
-	}
-
-	return log.Append(record)
+	return record, position, nil
 }
 
-/*************** SetStringRecord *********************************************/
-
-// SetStringRecord in log ->
-// <SetString, TxID, filename, blockNumber, offset, value>
-type SetStringRecord struct {
-	txNum  TxID
-	offset int64
-	val    string
-	block  file.Block
-}
-
-func newSetStringRecord(page *file.Page) *SetStringRecord {
-	errMsg := "Failed to create SetString record: "
+// readUpdateRecord returns the transaction id, block and offset of a record created by updateRecord,
+// along with the position of the value in the record.
+func readUpdateRecord(page *file.Page) (TxID, file.Block, int64, int64, error) {
 	position := int64(file.IntSize)
 	txNumber, err := page.GetInt(position)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return 0, file.Block{}, 0, 0, err
 	}
 
 	position += file.IntSize
 	filename, err := page.GetString(position)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return 0, file.Block{}, 0, 0, err
 	}
 
 	position += file.MaxLen(len(filename))
 	blockNum, err := page.GetInt(position)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return 0, file.Block{}, 0, 0, err
 	}
 
 	position += file.IntSize
 	offset, err := page.GetInt(position)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return 0, file.Block{}, 0, 0, err
 	}
 
 	position += file.IntSize
-	val, err := page.GetString(position)
+	return TxID(txNumber), file.GetBlock(filename, blockNum), offset, position, nil
+}
+
+/*************** CreateFileRecord ********************************************/
+
+// CreateFileRecord in log ->
+// <CreateFile, TxID, filename>
+type CreateFileRecord struct {
+	txNum    TxID
+	filename string
+}
+
+func newCreateFileRecord(page *file.Page) (*CreateFileRecord, error) {
+	txNum, filename, err := readFileRecord(page)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, invalidRecord("CreateFile", err)
 	}
+	return &CreateFileRecord{
+		txNum:    txNum,
+		filename: filename,
+	}, nil
+}
 
-	return &SetStringRecord{
-		txNum:  TxID(txNumber),
-		offset: offset,
-		val:    val,
-		block:  file.GetBlock(filename, blockNum),
+func (c *CreateFileRecord) recordType() int {
+	return CreateFile
+}
+
+func (c *CreateFileRecord) txNumber() TxID {
+	return c.txNum
+}
+
+// undo Remove the file created by the transaction, along with any buffers assigned to its blocks.
+func (c *CreateFileRecord) undo(tx *Transaction) error {
+	return tx.removeFile(c.filename)
+}
+
+// redo Create the file if it does not exist.
+func (c *CreateFileRecord) redo(tx *Transaction) error {
+	return tx.fileMgr.Create(c.filename)
+}
+
+func (c *CreateFileRecord) String() string {
+	return fmt.Sprintf("<CREATEFILE %v %v>", c.txNum, c.filename)
+}
+
+// writeCreateFileRecToLog write a CreateFile record to the log.
+// This log record contains the CreateFile operator, followed by transaction id and filename.
+// returns the LSN of the appended CreateFile record
+func writeCreateFileRecToLog(log *wal.Log, txNum TxID, filename string) (int64, error) {
+	record, err := fileRecord(CreateFile, txNum, filename, 0)
+	if err != nil {
+		return 0, fmt.Errorf("could not write CreateFile record: %w", err)
 	}
+	return log.Append(record)
 }
 
-func (s *SetStringRecord) recordType() int {
-	return SetString
+/*************** DropFileRecord **********************************************/
+
+// DropFileRecord in log ->
+// <DropFile, TxID, filename>
+type DropFileRecord struct {
+	txNum    TxID
+	filename string
 }
 
-func (s *SetStringRecord) txNumber() TxID {
-	return s.txNum
+func newDropFileRecord(page *file.Page) (*DropFileRecord, error) {
+	txNum, filename, err := readFileRecord(page)
+	if err != nil {
+		return nil, invalidRecord("DropFile", err)
+	}
+	return &DropFileRecord{
+		txNum:    txNum,
+		filename: filename,
+	}, nil
 }
 
-// undo Replace the specified data value with the value saved in the log record.
-// The method pins a buffer to the specified block,
-// calls SetString to restore the saved value, and unpins the buffer.
-func (s *SetStringRecord) undo(tx *Transaction) error {
-	tx.Pin(s.block)
-	err := tx.SetString(s.block, s.offset, s.val, false)
+func (d *DropFileRecord) recordType() int {
+	return DropFile
+}
+
+func (d *DropFileRecord) txNumber() TxID {
+	return d.txNum
+}
+
+// Does nothing, because the file is only removed once the transaction commits.
+func (d *DropFileRecord) undo(tx *Transaction) error {
+	return nil
+}
+
+// Does nothing, the file is removed by Redo when it reaches the Commit record of the transaction.
+func (d *DropFileRecord) redo(tx *Transaction) error {
+	return nil
+}
+
+func (d *DropFileRecord) String() string {
+	return fmt.Sprintf("<DROPFILE %v %v>", d.txNum, d.filename)
+}
+
+// writeDropFileRecToLog write a DropFile record to the log.
+// This log record contains the DropFile operator, followed by transaction id and filename.
+// returns the LSN of the appended DropFile record
+func writeDropFileRecToLog(log *wal.Log, txNum TxID, filename string) (int64, error) {
+	record, err := fileRecord(DropFile, txNum, filename, 0)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("could not write DropFile record: %w", err)
 	}
-	tx.Unpin(s.block)
+	return log.Append(record)
+}
+
+/*************** TruncateFileRecord ******************************************/
+
+// TruncateFileRecord in log ->
+// <TruncateFile, TxID, filename, blockCount>
+type TruncateFileRecord struct {
+	txNum      TxID
+	filename   string
+	blockCount int64
+}
+
+func newTruncateFileRecord(page *file.Page) (*TruncateFileRecord, error) {
+	txNum, filename, err := readFileRecord(page)
+	if err != nil {
+		return nil, invalidRecord("TruncateFile", err)
+	}
+	position := 2*file.IntSize + file.MaxLen(len(filename))
+	blockCount, err := page.GetInt(position)
+	if err != nil {
+		return nil, invalidRecord("TruncateFile", err)
+	}
+	return &TruncateFileRecord{
+		txNum:      txNum,
+		filename:   filename,
+		blockCount: blockCount,
+	}, nil
+}
+
+func (t *TruncateFileRecord) recordType() int {
+	return TruncateFile
+}
+
+func (t *TruncateFileRecord) txNumber() TxID {
+	return t.txNum
+}
+
+// Does nothing, because the file is only truncated once the transaction commits.
+func (t *TruncateFileRecord) undo(tx *Transaction) error {
 	return nil
 }
 
-func (s *SetStringRecord) String() string {
-	return fmt.Sprintf("<SETSTRING %v %v %v %v>", s.txNum, s.block, s.offset, s.val)
+// Does nothing, the file is truncated by Redo when it reaches the Commit record of the transaction.
+func (t *TruncateFileRecord) redo(tx *Transaction) error {
+	return nil
 }
 
-// writeSetStringRecToLog write a SetString record to the log.
-// This log record contains the SetString operator,
-// followed by transaction id, filename, blockNumber,
-// offset of the modified block, and the previous string value at that offset.
-// returns the LSN of the appended SetInt record
-func writeSetStringRecToLog(log *wal.Log, txNum TxID, block file.Block, offset int64, val string) int64 {
-	errMsg := "Failed to write SetString record to Log: "
-	filenameLen := file.MaxLen(len(block.Filename))
-	valueLen := file.MaxLen(len(val))
-	record := make([]byte, 5*file.IntSize+filenameLen+valueLen)
+func (t *TruncateFileRecord) String() string {
+	return fmt.Sprintf("<TRUNCATEFILE %v %v %v>", t.txNum, t.filename, t.blockCount)
+}
+
+// writeTruncateFileRecToLog write a TruncateFile record to the log.
+// This log record contains the TruncateFile operator,
+// followed by transaction id, filename and the number of blocks the file is truncated to.
+// returns the LSN of the appended TruncateFile record
+func writeTruncateFileRecToLog(log *wal.Log, txNum TxID, filename string, blockCount int64) (int64, error) {
+	record, err := fileRecord(TruncateFile, txNum, filename, file.IntSize)
+	if err != nil {
+		return 0, fmt.Errorf("could not write TruncateFile record: %w", err)
+	}
+
+	page := file.NewPageWithBytes(record)
+	err = page.SetInt(int64(len(record))-file.IntSize, blockCount)
+	if err != nil {
+		return 0, fmt.Errorf("could not write TruncateFile record: %w", err)
+	}
+	return log.Append(record)
+}
+
+// fileRecord returns a log record containing the operator, followed by transaction id and filename,
+// with room for extraLen more bytes at the end of the record.
+func fileRecord(operator int, txNum TxID, filename string, extraLen int64) ([]byte, error) {
+	record := make([]byte, 2*file.IntSize+file.MaxLen(len(filename))+extraLen)
 	page := file.NewPageWithBytes(record)
 
 	position := int64(0)
-	err := page.SetInt(position, SetString)
+	err := page.SetInt(position, int64(operator))
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, err
 	}
 
 	position += file.IntSize
 	err = page.SetInt(position, int64(txNum))
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, err
 	}
 
 	position += file.IntSize
-	err = page.SetString(position, block.Filename)
-	if err != nil {
-		log2.Fatalln(errMsg, err)
-	}
-
-	position += filenameLen
-	err = page.SetInt(position, block.Number)
+	err = page.SetString(position, filename)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return nil, err
 	}
+	return record, nil
+}
 
-	position += file.IntSize
-	err = page.SetInt(position, offset)
+// readFileRecord returns the transaction id and filename of a record created by fileRecord
+func readFileRecord(page *file.Page) (TxID, string, error) {
+	position := int64(file.IntSize)
+	txNumber, err := page.GetInt(position)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return 0, "", err
 	}
 
 	position += file.IntSize
-	err = page.SetString(position, val)
+	filename, err := page.GetString(position)
 	if err != nil {
-		log2.Fatalln(errMsg, err)
+		return 0, "", err
 	}
-
-	return log.Append(record)
+	return TxID(txNumber), filename, nil
 }
@@ -0,0 +1,95 @@
+package wal
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/naveen246/kite-db/file"
+)
+
+/*
+Archiving copies every completed segment file of the log to an archive,
+which is a FileMgr opened on another directory (with the same block size).
+A segment is completed when the log moves on to the next segment, Append archives it right away.
+A completed segment that was not archived, because archiving failed or the DB crashed, is archived
+when the log is opened and before RemoveSegmentsBefore deletes it, so every record reaches the archive.
+
+The archived segments keep their names, so the archive can be opened as a read-only log with NewLog
+to replay the archived records (see txn.Redo). The last segment of the log is not in the archive until it is completed.
+*/
+
+// WithArchive copies every completed segment file of the log to archive.
+// The archive is not closed by the log.
+func WithArchive(archive *file.FileMgr) Option {
+	return func(l *Log) {
+		l.archive = archive
+	}
+}
+
+// archiveSegment copies the completed segment file with the given number to the archive
+func (l *Log) archiveSegment(segment int64) error {
+	filename := l.segments.filename(segment)
+	err := file.CopyFile(l.fileMgr, l.archive, filename)
+	if err != nil {
+		return fmt.Errorf("could not archive log segment %v: %w", filename, err)
+	}
+	return nil
+}
+
+// archived reports whether the segment file with the given number is in the archive.
+// A copy that was interrupted has fewer blocks, or a different last block, than the segment.
+func (l *Log) archived(segment int64) (bool, error) {
+	filename := l.segments.filename(segment)
+	blockCount, err := l.fileMgr.BlockCount(filename)
+	if err != nil {
+		return false, err
+	}
+	archivedCount, err := l.archive.BlockCount(filename)
+	if err != nil {
+		return false, err
+	}
+	if blockCount != archivedCount {
+		return false, nil
+	}
+	if blockCount == 0 {
+		return true, nil
+	}
+
+	page := file.NewPageWithSize(l.fileMgr.BlockSize)
+	archivedPage := file.NewPageWithSize(l.fileMgr.BlockSize)
+	err = l.fileMgr.Read(file.GetBlock(filename, blockCount-1), page)
+	if err != nil {
+		return false, err
+	}
+	err = l.archive.Read(file.GetBlock(filename, blockCount-1), archivedPage)
+	if err != nil {
+		return false, nil
+	}
+	return bytes.Equal(page.Buffer, archivedPage.Buffer), nil
+}
+
+// archivePending archives the completed segments of the log that are not in the archive
+func (l *Log) archivePending() error {
+	if l.archive == nil || l.fileMgr.ReadOnly() {
+		return nil
+	}
+	numbers, err := l.segments.list()
+	if err != nil {
+		return fmt.Errorf("could not list segments of log file %v: %w", l.LogFile, err)
+	}
+	for _, number := range numbers {
+		if number >= l.currentBlock/l.segments.size {
+			break
+		}
+		archived, err := l.archived(number)
+		if err != nil {
+			return fmt.Errorf("could not check archived log segment %v: %w", l.segments.filename(number), err)
+		}
+		if !archived {
+			err = l.archiveSegment(number)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
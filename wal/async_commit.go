@@ -0,0 +1,121 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	log2 "log"
+	"time"
+)
+
+/*
+With asynchronous commit, committing transactions do not wait for their Commit record to reach the disk.
+A background flusher flushes the log every flushInterval instead, so a crash can lose the commits
+of the last flushInterval. Those transactions are rolled back by recovery, as their Commit record is missing.
+
+Callers that occasionally need a commit to be durable call WaitDurable with the LSN of its Commit record,
+which returns once the flusher has flushed the log up to that LSN.
+*/
+
+var ErrLogClosed = errors.New("log is closed")
+
+// WithAsyncCommit makes AsyncCommit true and starts a background flusher that flushes the log every flushInterval
+func WithAsyncCommit(flushInterval time.Duration) Option {
+	return func(l *Log) {
+		l.asyncCommit = true
+		l.flushInterval = flushInterval
+	}
+}
+
+// AsyncCommit reports whether committing transactions should leave the flush of their Commit record
+// to the background flusher, see WithAsyncCommit
+func (l *Log) AsyncCommit() bool {
+	return l.asyncCommit
+}
+
+// startFlusher starts the background flusher, which runs until Close
+func (l *Log) startFlusher() error {
+	if l.flushInterval <= 0 {
+		return fmt.Errorf("invalid flush interval %v for log file %v", l.flushInterval, l.LogFile)
+	}
+	l.stopFlusher = make(chan struct{})
+	l.flusherDone = make(chan struct{})
+	go l.runFlusher()
+	return nil
+}
+
+func (l *Log) runFlusher() {
+	defer close(l.flusherDone)
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stopFlusher:
+			return
+		case <-ticker.C:
+		}
+
+		err := l.Flush(l.latestLogSeqNum.Load())
+		if err != nil {
+			// the callers of WaitDurable get the error, the next tick tries again
+			log2.Printf("Background flush of log file %v failed: %v\n", l.LogFile, err)
+		}
+	}
+}
+
+// WaitDurable waits until the log record corresponding to logSeqNum is written to disk.
+// If the log has a background flusher, WaitDurable waits for it instead of flushing, otherwise it is the same as Flush.
+// Returns the error of a failed flush, or ErrLogClosed if the log is closed before the record is written.
+func (l *Log) WaitDurable(logSeqNum int64) error {
+	if l.stopFlusher == nil {
+		return l.Flush(logSeqNum)
+	}
+
+	logSeqNum = min(logSeqNum, l.latestLogSeqNum.Load())
+	g := &l.group
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	round := g.round
+	for logSeqNum > l.lastSavedLogSeqNum.Load() {
+		if g.closed {
+			return ErrLogClosed
+		}
+		if g.round != round && g.err != nil {
+			return g.err
+		}
+		round = g.round
+		g.cond.Wait()
+	}
+	return nil
+}
+
+// Close stops the background flusher and flushes the log. Records cannot be appended after Close.
+// If the log is archived, its last segment is archived too, so the archive holds every record of the log.
+// The FileMgr of the log (and of the archive) must be closed after the log.
+func (l *Log) Close() error {
+	l.Lock()
+	closed := l.closed
+	l.closed = true
+	l.Unlock()
+	if closed {
+		return nil
+	}
+
+	if l.stopFlusher != nil {
+		close(l.stopFlusher)
+		<-l.flusherDone
+	}
+	err := l.Flush(l.latestLogSeqNum.Load())
+	if err == nil && l.archive != nil && !l.fileMgr.ReadOnly() {
+		// the copy of the last segment is replaced when the segment is completed
+		l.Lock()
+		err = l.archiveSegment(l.currentBlock / l.segments.size)
+		l.Unlock()
+	}
+
+	g := &l.group
+	g.mu.Lock()
+	g.closed = true
+	g.cond.Broadcast()
+	g.mu.Unlock()
+	return err
+}
@@ -0,0 +1,204 @@
+package wal
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/naveen246/kite-db/common"
+	"github.com/naveen246/kite-db/file"
+	"io"
+)
+
+// ForwardLogIterator provides the ability to move from oldest to latest log record, which is needed to redo changes.
+// Since records are appended in reverse order in each block, the iterator collects the positions of
+// the records of a block when it moves to the block, and returns them from the last position to the first.
+// The fragments of a record are reassembled, so Next always returns whole records.
+type ForwardLogIterator struct {
+	fileMgr  *file.FileMgr
+	segments segments
+	blockNum int64
+	page     *file.Page
+
+	// positions of the fragments in the block that were not read yet, the oldest fragment is the last one
+	positions []int64
+
+	// the iterator stops at lastBlock, and does not return records newer than endLSN
+	lastBlock int64
+	endLSN    int64
+	// lastPage is a copy of the logPage of lastBlock taken when the iterator was created.
+	// lastBlock is read from it, since the block on disk may be rewritten by a flush while it is read.
+	lastPage []byte
+	// records older than startLSN are skipped
+	startLSN int64
+
+	// the record returned by the next call to Next and its LSN, read ahead by HasNext
+	next    []byte
+	nextLSN int64
+	nextErr error
+	fetched bool
+	done    bool
+
+	// lsn is the LSN of the record returned by the last call to Next
+	lsn int64
+}
+
+var _ common.Iterator = (*ForwardLogIterator)(nil)
+
+// newForwardIterator returns an iterator positioned at the oldest record with an LSN >= startLSN.
+// lastBlock and firstBlock are the numbers of the last and first blocks of the log, lastPage holds the contents of lastBlock
+// and endLSN is the LSN of the latest record to return.
+func newForwardIterator(segments segments, lastBlock int64, lastPage []byte, firstBlock int64, startLSN int64, endLSN int64) (*ForwardLogIterator, error) {
+	blockSize := segments.fileMgr.BlockSize
+	iter := &ForwardLogIterator{
+		fileMgr:   segments.fileMgr,
+		segments:  segments,
+		page:      file.NewPageWithSize(blockSize),
+		lastBlock: lastBlock,
+		endLSN:    endLSN,
+		lastPage:  lastPage,
+		startLSN:  startLSN,
+	}
+
+	// the record at startLSN may have started in an earlier block,
+	// so move back while the oldest fragment of the block continues a record from the block before it
+	blockNum := max(min(startLSN/blockSize, lastBlock), firstBlock)
+	for {
+		err := iter.moveToBlock(blockNum)
+		if err != nil {
+			return nil, err
+		}
+		if blockNum == firstBlock || len(iter.positions) == 0 {
+			break
+		}
+		fragment, _, err := getRecord(iter.page, iter.positions[len(iter.positions)-1])
+		if err != nil {
+			return nil, fmt.Errorf("could not read log record in %v: %w", segments.block(blockNum), err)
+		}
+		if fragment != middleFragment && fragment != lastFragment {
+			break
+		}
+		blockNum--
+	}
+	return iter, nil
+}
+
+// HasNext reports whether there is another record. Since the fragments of an incomplete record are skipped,
+// HasNext reads ahead to the next complete record, a read error is returned by the next call to Next.
+func (l *ForwardLogIterator) HasNext() bool {
+	if !l.fetched {
+		l.next, l.nextLSN, l.done, l.nextErr = l.readRecord()
+		l.fetched = true
+	}
+	return !l.done || l.nextErr != nil
+}
+
+// Next returns the next record, io.EOF if there are no more records
+func (l *ForwardLogIterator) Next() ([]byte, error) {
+	if !l.HasNext() {
+		return nil, io.EOF
+	}
+	l.fetched = false
+	l.lsn = l.nextLSN
+	return l.next, l.nextErr
+}
+
+// LSN returns the LSN of the record returned by the last call to Next
+func (l *ForwardLogIterator) LSN() int64 {
+	return l.lsn
+}
+
+// readRecord reads the fragments of the next record, from its first fragment to its last, and joins them.
+// Fragments without a first fragment, or whose record has no last fragment, are skipped.
+// Returns the record and its LSN (the LSN of its last fragment), or done if the end of the log is reached.
+func (l *ForwardLogIterator) readRecord() ([]byte, int64, bool, error) {
+	var fragments [][]byte
+	for {
+		fragment, data, lsn, ok, err := l.nextFragment()
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if !ok {
+			return nil, 0, true, nil
+		}
+
+		var record []byte
+		switch fragment {
+		case fullFragment:
+			fragments = nil
+			record = data
+		case firstFragment:
+			fragments = [][]byte{data}
+			continue
+		case middleFragment:
+			if fragments != nil {
+				fragments = append(fragments, data)
+			}
+			continue
+		case lastFragment:
+			if fragments == nil {
+				continue
+			}
+			record = bytes.Join(append(fragments, data), nil)
+			fragments = nil
+		}
+
+		if lsn > l.endLSN {
+			return nil, 0, true, nil
+		}
+		if lsn >= l.startLSN {
+			return record, lsn, false, nil
+		}
+	}
+}
+
+// nextFragment returns the type, data and LSN of the next fragment in the block.
+// If there are no more fragments in the block, then move to the next block and return its oldest fragment.
+// ok is false if there are no more blocks.
+func (l *ForwardLogIterator) nextFragment() (int16, []byte, int64, bool, error) {
+	for len(l.positions) == 0 {
+		if l.blockNum >= l.lastBlock {
+			return 0, nil, 0, false, nil
+		}
+		err := l.moveToBlock(l.blockNum + 1)
+		if err != nil {
+			return 0, nil, 0, false, err
+		}
+	}
+
+	pos := l.positions[len(l.positions)-1]
+	l.positions = l.positions[:len(l.positions)-1]
+	fragment, data, err := getRecord(l.page, pos)
+	if err != nil {
+		return 0, nil, 0, false, fmt.Errorf("could not read log record at %v in %v: %w", pos, l.segments.block(l.blockNum), err)
+	}
+	// data is part of the page, which is overwritten when the iterator moves to another block
+	return fragment, bytes.Clone(data), logSeqNum(l.fileMgr.BlockSize, l.blockNum, pos), true, nil
+}
+
+// moveToBlock Moves to block blockNum of the log and collects the positions of its fragments
+func (l *ForwardLogIterator) moveToBlock(blockNum int64) error {
+	block := l.segments.block(blockNum)
+	if blockNum == l.lastBlock {
+		copy(l.page.Buffer, l.lastPage)
+	} else {
+		err := l.fileMgr.Read(block, l.page)
+		if err != nil {
+			return fmt.Errorf("could not read log block %v: %w", block, err)
+		}
+	}
+	l.blockNum = blockNum
+
+	pos, err := l.page.GetInt(0)
+	if err != nil {
+		return err
+	}
+	l.positions = l.positions[:0]
+	for pos < l.fileMgr.BlockSize {
+		l.positions = append(l.positions, pos)
+		_, data, err := getRecord(l.page, pos)
+		if err != nil {
+			return fmt.Errorf("could not read log record at %v in %v: %w", pos, block, err)
+		}
+		pos += recordSize(int64(len(data)))
+	}
+	return nil
+}
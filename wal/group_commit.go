@@ -0,0 +1,179 @@
+package wal
+
+import (
+	"github.com/sasha-s/go-deadlock"
+	"sync"
+	"time"
+)
+
+/*
+Group commit lets concurrent callers of Log.Flush (usually committing transactions) share a single flush.
+
+The first caller that needs a flush becomes the leader, the callers that arrive while the leader is
+waiting or flushing are followers. The leader waits up to maxDelay for more followers
+(or until there are maxBatch callers waiting), then flushes everything appended to the log so far,
+which covers the LSNs of all the callers waiting at that time, and wakes up the followers.
+A follower whose LSN was appended after the flush started becomes the leader of the next flush.
+
+With maxDelay 0 the leader does not wait, the callers that arrive during a flush are still
+coalesced into the next one.
+*/
+
+// Option configures a Log created by NewLog
+type Option func(l *Log)
+
+// WithGroupCommit sets how long the leader of a group commit waits for more callers of Flush before flushing,
+// the leader stops waiting early when maxBatch callers are waiting (maxBatch <= 0 means no limit).
+func WithGroupCommit(maxDelay time.Duration, maxBatch int) Option {
+	return func(l *Log) {
+		l.group.maxDelay = maxDelay
+		l.group.maxBatch = maxBatch
+	}
+}
+
+// GroupCommitStats counts the flushes done by Log.Flush and the callers served by them
+type GroupCommitStats struct {
+	Flushes  int64
+	Commits  int64
+	MaxBatch int64
+}
+
+// CommitsPerFlush returns the average number of callers of Flush that were served by a single flush
+func (s GroupCommitStats) CommitsPerFlush() float64 {
+	if s.Flushes == 0 {
+		return 0
+	}
+	return float64(s.Commits) / float64(s.Flushes)
+}
+
+type groupCommit struct {
+	mu       deadlock.Mutex
+	cond     *sync.Cond
+	maxDelay time.Duration
+	maxBatch int
+
+	// flushing is true while a leader is waiting for followers or flushing
+	flushing bool
+	// waiters is the number of callers waiting for a flush that has not started yet,
+	// batch is incremented when a flush starts, the callers that joined an earlier batch are served by it
+	waiters int
+	batch   int64
+	// batchFull is closed when maxBatch callers are waiting, a new one is made when a flush starts
+	batchFull chan struct{}
+	// round is incremented after every flush, err is the result of the last flush
+	round int64
+	err   error
+	// closed is set when the log is closed
+	closed bool
+
+	stats GroupCommitStats
+}
+
+func (g *groupCommit) init() {
+	g.cond = sync.NewCond(&g.mu)
+	g.batchFull = make(chan struct{})
+}
+
+// addWaiter registers a caller waiting for a flush and returns the batch it joined, g.mu must be held
+func (g *groupCommit) addWaiter() int64 {
+	g.waiters++
+	if g.maxBatch > 0 && g.waiters >= g.maxBatch {
+		select {
+		case <-g.batchFull:
+		default:
+			close(g.batchFull)
+		}
+	}
+	return g.batch
+}
+
+// removeWaiter unregisters a caller that joined batch, unless a flush started since, g.mu must be held
+func (g *groupCommit) removeWaiter(batch int64) {
+	if g.batch == batch {
+		g.waiters--
+	}
+}
+
+// Flush ensures that log record corresponding to logSeqNum is written to disk.
+// Concurrent callers share flushes, see group commit.
+func (l *Log) Flush(logSeqNum int64) error {
+	// a flush covers all the records appended so far, so there is nothing more to wait for
+	logSeqNum = min(logSeqNum, l.latestLogSeqNum.Load())
+	if logSeqNum <= l.lastSavedLogSeqNum.Load() {
+		return nil
+	}
+
+	g := &l.group
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	batch := g.addWaiter()
+	defer g.removeWaiter(batch)
+
+	for logSeqNum > l.lastSavedLogSeqNum.Load() {
+		if g.flushing {
+			round := g.round
+			for g.round == round {
+				g.cond.Wait()
+			}
+			if g.err != nil && logSeqNum > l.lastSavedLogSeqNum.Load() {
+				return g.err
+			}
+			continue
+		}
+
+		err := l.leadFlush()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// leadFlush waits for more callers of Flush, flushes the log and wakes up the callers waiting for the flush.
+// g.mu must be held, it is released while waiting and flushing.
+func (l *Log) leadFlush() error {
+	g := &l.group
+	g.flushing = true
+	batchFull := g.batchFull
+	if g.maxDelay > 0 && (g.maxBatch <= 0 || g.waiters < g.maxBatch) {
+		g.mu.Unlock()
+		timer := time.NewTimer(g.maxDelay)
+		select {
+		case <-batchFull:
+		case <-timer.C:
+		}
+		timer.Stop()
+		g.mu.Lock()
+	}
+
+	// all the callers waiting now appended their records before the flush, so they are served by it.
+	// The callers that arrive from now on wait for the next flush.
+	batch := int64(g.waiters)
+	g.waiters = 0
+	g.batch++
+	g.batchFull = make(chan struct{})
+	g.mu.Unlock()
+	l.Lock()
+	var err error
+	if l.lastSavedLogSeqNum.Load() < l.latestLogSeqNum.Load() {
+		err = l.flush()
+	}
+	l.Unlock()
+	g.mu.Lock()
+
+	g.flushing = false
+	g.err = err
+	g.round++
+	g.stats.Flushes++
+	g.stats.Commits += batch
+	g.stats.MaxBatch = max(g.stats.MaxBatch, batch)
+	g.cond.Broadcast()
+	return err
+}
+
+// GroupCommitStats returns the number of flushes done by Flush and the number of callers they served
+func (l *Log) GroupCommitStats() GroupCommitStats {
+	l.group.mu.Lock()
+	defer l.group.mu.Unlock()
+	return l.group.stats
+}
@@ -0,0 +1,137 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/naveen246/kite-db/file"
+	"hash/crc32"
+)
+
+/*
+Each log record is framed with a checksum and its length, so that a record that was only partly
+written to disk (for example when the process dies during a flush) is detected instead of decoded.
+
++==========+==========+===========+=============+
+| checksum | fragment | len(data) | data        |
++==========+==========+===========+=============+
+| 4 bytes  | 2 bytes  | 8 bytes   | len bytes   |
++----------+----------+-----------+-------------+
+
+The checksum is the CRC32C of the fragment type, len(data) and data.
+
+A record that does not fit in an empty block is split into fragments, which are written to consecutive blocks.
+The first fragment fills the rest of the current block, middle fragments fill whole blocks,
+and the last fragment holds the rest of the record.
++================+=================+=================+===============+
+| ...            | Block n         | Block n+1       | Block n+2     |
++================+=================+=================+===============+
+| fullFragment   | firstFragment   | middleFragment  | lastFragment  |
++----------------+-----------------+-----------------+---------------+
+
+A record that fits in one block is a fullFragment. LogIterator reassembles the fragments of a record,
+and skips the fragments of a record whose last fragment never reached the disk.
+*/
+
+const recordHeaderSize = file.Int32Size + file.Int16Size + file.IntSize
+
+// fragment types of a log record
+const (
+	fullFragment int16 = iota + 1
+	firstFragment
+	middleFragment
+	lastFragment
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorruptRecord is returned when the checksum of a log record does not match its contents
+var ErrCorruptRecord = errors.New("corrupt log record")
+
+// setRecord writes the framed fragment of a record holding data at position pos of page
+func setRecord(page *file.Page, pos int64, fragment int16, data []byte) error {
+	err := page.SetInt16(pos+file.Int32Size, fragment)
+	if err != nil {
+		return err
+	}
+	err = page.SetBytes(pos+file.Int32Size+file.Int16Size, data)
+	if err != nil {
+		return err
+	}
+	return page.SetInt32(pos, recordChecksum(page, pos, int64(len(data))))
+}
+
+// getRecord returns the fragment type and the data of the framed fragment at position pos of page.
+// Returns ErrCorruptRecord if the record length or fragment type is invalid, or its checksum does not match.
+func getRecord(page *file.Page, pos int64) (int16, []byte, error) {
+	if pos < 0 || pos+recordHeaderSize > page.Size {
+		return 0, nil, fmt.Errorf("%w: position %v", ErrCorruptRecord, pos)
+	}
+	data, err := page.GetBytes(pos + file.Int32Size + file.Int16Size)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: position %v, %w", ErrCorruptRecord, pos, err)
+	}
+	stored, err := page.GetInt32(pos)
+	if err != nil {
+		return 0, nil, err
+	}
+	if stored != recordChecksum(page, pos, int64(len(data))) {
+		return 0, nil, fmt.Errorf("%w: position %v, checksum mismatch", ErrCorruptRecord, pos)
+	}
+	fragment, err := page.GetInt16(pos + file.Int32Size)
+	if err != nil {
+		return 0, nil, err
+	}
+	if fragment < fullFragment || fragment > lastFragment {
+		return 0, nil, fmt.Errorf("%w: position %v, invalid fragment type %v", ErrCorruptRecord, pos, fragment)
+	}
+	return fragment, data, nil
+}
+
+func recordChecksum(page *file.Page, pos int64, dataLen int64) int32 {
+	start := pos + file.Int32Size
+	return int32(crc32.Checksum(page.Buffer[start:start+file.Int16Size+file.IntSize+dataLen], castagnoli))
+}
+
+// recordSize returns the number of bytes used in a block by a record holding dataLen bytes
+func recordSize(dataLen int64) int64 {
+	return recordHeaderSize + dataLen
+}
+
+// validChain reports whether the records starting at pos are all valid,
+// and end exactly at the end of the page
+func validChain(page *file.Page, pos int64) bool {
+	for pos < page.Size {
+		_, data, err := getRecord(page, pos)
+		if err != nil {
+			return false
+		}
+		pos += recordSize(int64(len(data)))
+	}
+	return pos == page.Size
+}
+
+// recoverTail finds the valid records of the last block of the log, which is in page.
+// If the process died while the block was being written, the newest records in the block may be invalid.
+// The records are chained from lastRecordPos (the newest) to the end of the block (the oldest),
+// so if the chain from lastRecordPos is broken, the newest position from which a valid chain reaches
+// the end of the block is used, which drops the first invalid record and all the records after it.
+// Returns the position of the newest valid record and the number of bytes discarded.
+func recoverTail(page *file.Page) (int64, int64) {
+	lastRecordPos, _ := page.GetInt(0)
+	if lastRecordPos == 0 {
+		// the block was appended, but its first write never reached the disk
+		return page.Size, 0
+	}
+
+	// if lastRecordPos itself is garbage, the whole block is scanned
+	start := int64(file.IntSize)
+	if lastRecordPos >= start && lastRecordPos <= page.Size {
+		start = lastRecordPos
+	}
+
+	pos := start
+	for pos < page.Size && !validChain(page, pos) {
+		pos++
+	}
+	return pos, pos - start
+}
@@ -0,0 +1,130 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/naveen246/kite-db/file"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+The log is split into segment files, each holding a fixed number of blocks (the segment size).
+A segment file is named LogFile.<segment number>, below is an example with a segment size of 4 blocks
+
++===================+===================+===================+
+| simpledb.log.0000 | simpledb.log.0001 | simpledb.log.0002 |
++===================+===================+===================+
+| Blocks 0 - 3      | Blocks 4 - 7      | Blocks 8 - 9      |
++-------------------+-------------------+-------------------+
+
+Blocks are numbered across segments, so block n of the log is block (n % segmentSize) of segment (n / segmentSize),
+and the LSNs do not depend on the segment size.
+When the last segment is full, the next block is appended to a new segment.
+
+Segments that only hold records older than a checkpoint are not needed for recovery,
+they are removed with RemoveSegmentsBefore. The oldest remaining segment is where iterators stop.
+*/
+
+// ErrLogRemoved is returned when the log records to read were removed with their segments, see Log.FirstLSN
+var ErrLogRemoved = errors.New("log records were removed")
+
+// DefaultSegmentSize is the number of blocks in a log segment file, unless set by WithSegmentSize
+const DefaultSegmentSize int64 = 256
+
+// WithSegmentSize sets the number of blocks in a log segment file.
+// An existing log must be opened with the segment size it was created with.
+func WithSegmentSize(blocks int64) Option {
+	return func(l *Log) {
+		l.segments.size = blocks
+	}
+}
+
+// segments maps the block numbers of the log to the blocks of its segment files
+type segments struct {
+	fileMgr *file.FileMgr
+	logFile string
+	size    int64
+}
+
+// filename returns the name of the segment file with the given number
+func (s segments) filename(segment int64) string {
+	return fmt.Sprintf("%v.%04d", s.logFile, segment)
+}
+
+// block returns the block of the segment file that holds block blockNum of the log
+func (s segments) block(blockNum int64) file.Block {
+	return file.GetBlock(s.filename(blockNum/s.size), blockNum%s.size)
+}
+
+// list returns the numbers of the existing segment files in ascending order
+func (s segments) list() ([]int64, error) {
+	filenames, err := s.fileMgr.List()
+	if err != nil {
+		return nil, err
+	}
+	var numbers []int64
+	prefix := s.logFile + "."
+	for _, filename := range filenames {
+		suffix, ok := strings.CutPrefix(filename, prefix)
+		if !ok {
+			continue
+		}
+		number, err := strconv.ParseInt(suffix, 10, 64)
+		if err != nil || number < 0 {
+			continue
+		}
+		numbers = append(numbers, number)
+	}
+	slices.Sort(numbers)
+	return numbers, nil
+}
+
+// Segments returns the names of the segment files of the log, from the oldest to the latest
+func (l *Log) Segments() ([]string, error) {
+	numbers, err := l.segments.list()
+	if err != nil {
+		return nil, fmt.Errorf("could not list segments of log file %v: %w", l.LogFile, err)
+	}
+	filenames := make([]string, len(numbers))
+	for i, number := range numbers {
+		filenames[i] = l.segments.filename(number)
+	}
+	return filenames, nil
+}
+
+// RemoveSegmentsBefore deletes the segment files that only hold records older than the record at logSeqNum,
+// the segment holding that record is kept. It is used after a checkpoint, whose LSN is passed,
+// since the records before a checkpoint are not needed to recover the DB.
+// If the log is archived, the segment files are archived before they are deleted.
+// Returns the number of segment files deleted.
+func (l *Log) RemoveSegmentsBefore(logSeqNum int64) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	err := l.archivePending()
+	if err != nil {
+		return 0, err
+	}
+
+	// the block of a record is derived from its LSN, see the LSN in wal.go
+	keep := min(logSeqNum/l.fileMgr.BlockSize, l.currentBlock) / l.segments.size
+	numbers, err := l.segments.list()
+	if err != nil {
+		return 0, fmt.Errorf("could not list segments of log file %v: %w", l.LogFile, err)
+	}
+
+	removed := 0
+	for _, number := range numbers {
+		if number >= keep {
+			break
+		}
+		err = l.fileMgr.Delete(l.segments.filename(number))
+		if err != nil {
+			return removed, fmt.Errorf("could not remove log segment %v: %w", l.segments.filename(number), err)
+		}
+		removed++
+	}
+	l.firstBlock = max(l.firstBlock, keep*l.segments.size)
+	return removed, nil
+}
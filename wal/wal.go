@@ -1,11 +1,17 @@
 package wal
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/naveen246/kite-db/common"
 	"github.com/naveen246/kite-db/file"
 	"github.com/sasha-s/go-deadlock"
 	log2 "log"
+	"math"
+	"os"
 	"sync/atomic"
+	"time"
 )
 
 /*
@@ -31,117 +37,346 @@ This is because the dataSize for each item can vary
 
 There will be 1 logPage(in memory) which holds the data of the last block (Block 2 in above example)
 The block whose data is held in logPage is called currentBlock
+The blocks are stored in segment files (see segment.go)
 
-Below is an example of a block of size 40 bytes where we append "abc" first and "defgh" next
+Below is an example of a block of size 48 bytes where we append "abc" first and "defgh" next
 The first 8 bytes of all blocks are reserved for the position/offset of the last added record in that block
+Each record is framed with a checksum, its fragment type and the length of its data (see record.go)
 
-+===============+==========+==================+=============+=================+============+
-| lastRecordPos |  empty   | len(secondValue) | secondValue | len(firstValue) | firstValue |
-+===============+==========+==================+=============+=================+============+
-| 16            |          | 5                | defgh       | 3               | abc        |
-+---------------+----------+------------------+-------------+-----------------+------------+
-| 8 bytes       | 8 bytes  | 8 bytes          | 5 bytes     | 8 bytes         | 3 bytes    |
-+---------------+----------+------------------+-------------+-----------------+------------+
-0               8          16                 24            29                37           40
++===============+==========+========+==================+=============+========+=================+============+
+| lastRecordPos |  empty   | header | len(secondValue) | secondValue | header | len(firstValue) | firstValue |
++===============+==========+========+==================+=============+========+=================+============+
+| 12            |          |        | 5                | defgh       |        | 3               | abc        |
++---------------+----------+--------+------------------+-------------+--------+-----------------+------------+
+| 8 bytes       | 4 bytes  | 6 bytes| 8 bytes          | 5 bytes     | 6 bytes| 8 bytes         | 3 bytes    |
++---------------+----------+--------+------------------+-------------+--------+-----------------+------------+
+0               8          12       18                 26            31       37                45           48
+
+The header holds the checksum and the fragment type of the record.
+
+The log sequence number (LSN) of a record is derived from its position in the LogFile,
+LSN = blockNumber * BlockSize + (BlockSize - recordPos)
+In the above example, if the block is Block 2, "abc" has LSN 2*48 + (48-31) = 113 and "defgh" has LSN 2*48 + (48-12) = 132.
+Since records are written right to left in a block, and each block adds BlockSize,
+LSNs increase with every appended record, and the LSNs of an existing LogFile are recovered when it is opened.
+So LSNs are monotonic across restarts.
+
+When an existing LogFile is opened, the records of its last block are verified,
+and the block is truncated at the first invalid record (see recoverTail).
 */
 
 // Log is responsible for writing log records into a log file.
 // New records are appended to memory(logPage) and flushed to disk(LogFile) when needed
+// LogFile is the name shared by the segment files of the log.
 type Log struct {
 	deadlock.Mutex
-	fileMgr      *file.FileMgr
-	LogFile      string
-	currentBlock file.Block
-	logPage      *file.Page
+	fileMgr  *file.FileMgr
+	LogFile  string
+	logPage  *file.Page
+	segments segments
 
-	// latestLogSeqNum is incremented every time logRecord is written to logPage
+	// currentBlock is the number of the last block of the log, blocks are numbered across segments
+	currentBlock int64
+
+	// firstBlock is the number of the first block of the oldest segment
+	firstBlock int64
+
+	// latestLogSeqNum is the LSN of the last logRecord written to logPage
 	latestLogSeqNum atomic.Int64
 
 	// lastSavedLogSeqNum is updated to latestLogSeqNum when the logPage is flushed to disk
 	lastSavedLogSeqNum atomic.Int64
+
+	// discardedBytes is the number of bytes of invalid records removed from the last block when the log was opened
+	discardedBytes int64
+
+	// group coordinates concurrent callers of Flush (see group_commit.go)
+	group groupCommit
+
+	// asyncCommit and the background flusher (see async_commit.go)
+	asyncCommit   bool
+	flushInterval time.Duration
+	stopFlusher   chan struct{}
+	flusherDone   chan struct{}
+
+	// closed is set by Close, records cannot be appended after it
+	closed bool
+
+	// archive receives a copy of every completed segment (see archive.go)
+	archive *file.FileMgr
 }
 
 // NewLog creates manager for specified LogFile
-// if LogFile does not exist, create file with an empty first block
-func NewLog(fileMgr *file.FileMgr, logFile string) *Log {
+// if LogFile has no segments, create the first segment with an empty first block
+// if LogFile exists, the LSN of its last record is recovered, so new records get higher LSNs
+func NewLog(fileMgr *file.FileMgr, logFile string, opts ...Option) (*Log, error) {
 	page := file.NewPageWithSize(fileMgr.BlockSize)
 	log := &Log{
 		fileMgr: fileMgr,
 		LogFile: logFile,
 		logPage: page,
+		segments: segments{
+			fileMgr: fileMgr,
+			logFile: logFile,
+			size:    DefaultSegmentSize,
+		},
+	}
+	log.group.init()
+	for _, opt := range opts {
+		opt(log)
+	}
+	if log.segments.size <= 0 {
+		return nil, fmt.Errorf("invalid segment size %v for log file %v", log.segments.size, logFile)
+	}
+	if log.archive != nil && log.archive.BlockSize != fileMgr.BlockSize {
+		return nil, fmt.Errorf("archive of log file %v has block size %v, expected %v", logFile, log.archive.BlockSize, fileMgr.BlockSize)
 	}
 
-	blockCount := fileMgr.BlockCount(logFile)
-	if blockCount == 0 {
-		// LogFile is a new file so we append new block to file
-		log.currentBlock = log.appendNewBlock()
+	numbers, err := log.segments.list()
+	if err != nil {
+		return nil, fmt.Errorf("could not list segments of log file %v: %w", logFile, err)
+	}
+	if len(numbers) == 0 && fileMgr.ReadOnly() {
+		return nil, fmt.Errorf("could not open log file %v: %w", logFile, os.ErrNotExist)
+	}
+	if len(numbers) == 0 {
+		// LogFile is new so we create the first segment with a new block
+		err = log.appendNewBlock(0)
+		if err != nil {
+			return nil, err
+		}
 	} else {
-		// LogFile is an existing file so we get the last block of the file
-		// and read the last block contents to logPage
-		log.currentBlock = file.GetBlock(logFile, blockCount-1)
-		err := fileMgr.Read(log.currentBlock, log.logPage)
+		err = log.openLastSegment(numbers[0], numbers[len(numbers)-1])
 		if err != nil {
-			log2.Fatalf("Read failed for block %v - %v\n", log.currentBlock, err)
+			return nil, err
 		}
 	}
 
-	return log
+	lastRecordPos, err := log.lastRecordPos()
+	if err != nil {
+		return nil, err
+	}
+	lsn := log.logSeqNum(log.currentBlock, lastRecordPos)
+	log.latestLogSeqNum.Store(lsn)
+	log.lastSavedLogSeqNum.Store(lsn)
+	err = log.archivePending()
+	if err != nil {
+		return nil, err
+	}
+	if log.asyncCommit && !fileMgr.ReadOnly() {
+		err = log.startFlusher()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return log, nil
+}
+
+// openLastSegment makes the last block of the last segment the currentBlock
+// and reads the last block contents to logPage
+func (l *Log) openLastSegment(first int64, last int64) error {
+	filename := l.segments.filename(last)
+	blockCount, err := l.fileMgr.BlockCount(filename)
+	if err != nil {
+		return err
+	}
+	if blockCount > l.segments.size {
+		return fmt.Errorf("log segment %v has %v blocks, more than the segment size %v", filename, blockCount, l.segments.size)
+	}
+
+	l.firstBlock = first * l.segments.size
+	if blockCount == 0 {
+		// the segment was created, but its first block never reached the disk
+		return l.appendNewBlock(last * l.segments.size)
+	}
+	l.currentBlock = last*l.segments.size + blockCount - 1
+	return l.recoverTail()
+}
+
+// recoverTail reads the last block of the LogFile into logPage and removes the invalid records at its end.
+// A block that was partly written fails its checksum (file.ErrCorruptBlock), its records are still recovered.
+// If any records are removed, the block is written back to disk.
+func (l *Log) recoverTail() error {
+	block := l.segments.block(l.currentBlock)
+	err := l.fileMgr.Read(block, l.logPage)
+	corrupt := errors.Is(err, file.ErrCorruptBlock)
+	if err != nil && !corrupt {
+		return fmt.Errorf("could not read last block %v of log file %v: %w", block, l.LogFile, err)
+	}
+
+	lastRecordPos, _ := l.lastRecordPos()
+	recordPos, discarded := recoverTail(l.logPage)
+	if !corrupt && recordPos == lastRecordPos {
+		return nil
+	}
+
+	clear(l.logPage.Buffer[:recordPos])
+	err = l.saveLastRecordPos(recordPos)
+	if err != nil {
+		return err
+	}
+	err = l.flush()
+	if err != nil {
+		return err
+	}
+	l.discardedBytes = discarded
+	if discarded > 0 {
+		log2.Printf("Discarded %v bytes of invalid records at the end of log file %v\n", discarded, block.Filename)
+	}
+	return nil
+}
+
+// DiscardedBytes returns the number of bytes of invalid records
+// that were removed from the end of the LogFile when it was opened
+func (l *Log) DiscardedBytes() int64 {
+	return l.discardedBytes
+}
+
+// logSeqNum returns the LSN of the record at recordPos in block blockNum of the log
+func (l *Log) logSeqNum(blockNum int64, recordPos int64) int64 {
+	return logSeqNum(l.fileMgr.BlockSize, blockNum, recordPos)
+}
+
+func logSeqNum(blockSize int64, blockNum int64, recordPos int64) int64 {
+	return blockNum*blockSize + blockSize - recordPos
+}
+
+// LatestLSN returns the LSN of the last record appended to the log
+func (l *Log) LatestLSN() int64 {
+	return l.latestLogSeqNum.Load()
+}
+
+// FlushedLSN returns the LSN of the last record written to disk
+func (l *Log) FlushedLSN() int64 {
+	return l.lastSavedLogSeqNum.Load()
+}
+
+// FirstLSN returns the LSN the log starts at, 0 if no segment was removed.
+// The records with a lower LSN were removed with their segments (see RemoveSegmentsBefore).
+func (l *Log) FirstLSN() int64 {
+	l.Lock()
+	defer l.Unlock()
+	return l.firstBlock * l.fileMgr.BlockSize
 }
 
 // Append logRecord to logPage(memory), returns logSeqNumber of the appended record
 // Log records are written right to left in the logPage.
 // Storing the records backwards makes it easy to read latest records first.
-func (l *Log) Append(logRecord []byte) int64 {
+// A record larger than an empty block is split into fragments written to consecutive blocks (see record.go),
+// its logSeqNumber is the LSN of its last fragment.
+func (l *Log) Append(logRecord []byte) (int64, error) {
 	l.Lock()
 	defer l.Unlock()
+	if l.fileMgr.ReadOnly() {
+		return 0, file.ErrReadOnly
+	}
+	if l.closed {
+		return 0, ErrLogClosed
+	}
 
 	lastRecordPos, err := l.lastRecordPos()
 	if err != nil {
-		return l.latestLogSeqNum.Load()
+		return 0, err
 	}
-	bytesNeeded := len(logRecord) + file.IntSize
 
-	// if logRecord does not fit in current page,
+	// blockCapacity is the size of the largest record that fits in an empty block
+	blockCapacity := l.fileMgr.BlockSize - file.IntSize - recordHeaderSize
+	data := logRecord
+	split := false
+
+	// if data does not fit in current page,
 	// then flush logPage(memory) to currentBlock(disk)
 	// and append new block to file and make it the currentBlock
-	if int(lastRecordPos)-bytesNeeded < file.IntSize { // logRecord doesn't fit
-		l.flush()
-		l.currentBlock = l.appendNewBlock()
-		lastRecordPos, _ = l.lastRecordPos()
+	for int64(len(data)) > lastRecordPos-file.IntSize-recordHeaderSize {
+		// a record that fits in an empty block is not split, it is written to the new block
+		room := lastRecordPos - file.IntSize - recordHeaderSize
+		if room > 0 && (split || int64(len(logRecord)) > blockCapacity) {
+			fragment := firstFragment
+			if split {
+				fragment = middleFragment
+			}
+			err = l.writeFragment(lastRecordPos-recordSize(room), fragment, data[:room])
+			if err != nil {
+				return 0, err
+			}
+			data = data[room:]
+			split = true
+		}
+
+		err = l.flush()
+		if err != nil {
+			return 0, err
+		}
+		err = l.appendNewBlock(l.currentBlock + 1)
+		if err != nil {
+			return 0, err
+		}
+		lastRecordPos = l.fileMgr.BlockSize
+		if l.archive != nil && l.currentBlock%l.segments.size == 0 {
+			// the previous segment is completed
+			err = l.archiveSegment(l.currentBlock/l.segments.size - 1)
+			if err != nil {
+				return 0, err
+			}
+		}
 	}
 
-	// calculate new record position and write the record to logPage
-	recordPos := lastRecordPos - int64(bytesNeeded)
-	err = l.logPage.SetBytes(recordPos, logRecord)
+	fragment := fullFragment
+	if split {
+		fragment = lastFragment
+	}
+	recordPos := lastRecordPos - recordSize(int64(len(data)))
+	err = l.writeFragment(recordPos, fragment, data)
 	if err != nil {
-		log2.Fatalf("Failed to write Log record to page - %v\n", err)
+		return 0, err
 	}
+	lsn := l.logSeqNum(l.currentBlock, recordPos)
+	l.latestLogSeqNum.Store(lsn)
+	return lsn, nil
+}
 
-	l.saveLastRecordPos(recordPos)
-	l.latestLogSeqNum.Add(1)
-	return l.latestLogSeqNum.Load()
+// writeFragment writes a fragment of a record at recordPos of logPage
+func (l *Log) writeFragment(recordPos int64, fragment int16, data []byte) error {
+	err := setRecord(l.logPage, recordPos, fragment, data)
+	if err != nil {
+		return fmt.Errorf("could not write log record to page: %w", err)
+	}
+	return l.saveLastRecordPos(recordPos)
 }
 
-func (l *Log) appendNewBlock() file.Block {
-	block, err := l.fileMgr.Append(l.LogFile)
+// appendNewBlock appends block blockNum to its segment, creating the segment if it is the first block,
+// and makes it the currentBlock
+func (l *Log) appendNewBlock(blockNum int64) error {
+	expected := l.segments.block(blockNum)
+	block, err := l.fileMgr.Append(expected.Filename)
 	if err != nil {
-		log2.Fatalf("Failed to create new block in file %v - %v\n", l.LogFile, err)
+		return fmt.Errorf("could not append block to log file %v: %w", expected.Filename, err)
+	}
+	if block != expected {
+		return fmt.Errorf("appended block %v to log file, expected %v", block, expected)
 	}
 
-	l.saveLastRecordPos(l.fileMgr.BlockSize)
+	// the page still holds the records of the previous block, which must not be written to the new block
+	clear(l.logPage.Buffer)
+	err = l.saveLastRecordPos(l.fileMgr.BlockSize)
+	if err != nil {
+		return err
+	}
 	err = l.fileMgr.Write(block, l.logPage)
 	if err != nil {
-		log2.Fatalf("Failed to write page to newly created block in file %v - %v\n", l.LogFile, err)
+		return fmt.Errorf("could not write new block of log file %v: %w", block.Filename, err)
 	}
-	return block
+	l.currentBlock = blockNum
+	return nil
 }
 
 // The first 8 bytes of page holds the position of last written record
-func (l *Log) saveLastRecordPos(pos int64) {
+func (l *Log) saveLastRecordPos(pos int64) error {
 	err := l.logPage.SetInt(0, pos)
 	if err != nil {
-		log2.Fatalf("Failed to save last record position - %v", err)
+		return fmt.Errorf("could not save last record position: %w", err)
 	}
+	return nil
 }
 
 func (l *Log) lastRecordPos() (int64, error) {
@@ -152,27 +387,66 @@ func (l *Log) lastRecordPos() (int64, error) {
 	return lastRecordPos, nil
 }
 
-func (l *Log) flush() {
-	err := l.fileMgr.Write(l.currentBlock, l.logPage)
+// flush writes logPage to currentBlock. A read-only log has nothing to flush,
+// and the invalid records found by recoverTail are only removed from logPage.
+func (l *Log) flush() error {
+	if l.fileMgr.ReadOnly() {
+		return nil
+	}
+	block := l.segments.block(l.currentBlock)
+	err := l.fileMgr.Write(block, l.logPage)
 	if err != nil {
-		log2.Fatalf("Failed to flush to file %v - %v\n", l.LogFile, err)
+		return fmt.Errorf("could not flush log file %v: %w", block.Filename, err)
+	}
+	err = l.fileMgr.Sync(block.Filename)
+	if err != nil {
+		return fmt.Errorf("could not sync log file %v: %w", block.Filename, err)
 	}
 	l.lastSavedLogSeqNum.Store(l.latestLogSeqNum.Load())
+
+	// wake up the callers of WaitDurable, l.flush is also called outside of group commit
+	l.group.mu.Lock()
+	l.group.cond.Broadcast()
+	l.group.mu.Unlock()
+	return nil
+}
+
+// Iterator flushes the log and returns an iterator that moves from the latest to the oldest log record
+func (l *Log) Iterator() (common.Iterator, error) {
+	return l.ReverseIterator(math.MaxInt64)
 }
 
-// Flush ensures that log record corresponding to logSeqNum is written to disk
-func (l *Log) Flush(logSeqNum int64) {
+// ReverseIterator flushes the log and returns an iterator that moves from the latest record
+// with an LSN <= logSeqNum to the oldest log record
+func (l *Log) ReverseIterator(logSeqNum int64) (*LogIterator, error) {
 	l.Lock()
 	defer l.Unlock()
-	lastSavedLogSeqNum := l.lastSavedLogSeqNum.Load()
-	if logSeqNum > lastSavedLogSeqNum {
-		l.flush()
+	err := l.flush()
+	if err != nil {
+		return nil, err
+	}
+	return newIterator(l.segments, l.currentBlock, l.firstBlock, logSeqNum)
+}
+
+// ForwardIterator flushes the log and returns an iterator that moves from the oldest record
+// with an LSN >= logSeqNum to the latest log record. Records appended after the iterator is created are not returned.
+// Use logSeqNum 0 to start at the oldest record of the log.
+func (l *Log) ForwardIterator(logSeqNum int64) (*ForwardLogIterator, error) {
+	l.Lock()
+	defer l.Unlock()
+	err := l.flush()
+	if err != nil {
+		return nil, err
 	}
+	return newForwardIterator(l.segments, l.currentBlock, bytes.Clone(l.logPage.Buffer), l.firstBlock, logSeqNum, l.latestLogSeqNum.Load())
 }
 
-func (l *Log) Iterator() common.Iterator {
+// FlushedIterator returns an iterator like ForwardIterator, except that it does not flush the log:
+// it stops at the last record written to disk (see FlushedLSN). Readers that poll the log use it,
+// so they do not force a flush every time they poll, which would defeat group commit and async commit.
+// The last block is read from a copy of logPage, a flush may be rewriting the block on disk while the iterator reads it.
+func (l *Log) FlushedIterator(logSeqNum int64) (*ForwardLogIterator, error) {
 	l.Lock()
 	defer l.Unlock()
-	l.flush()
-	return NewIterator(l.fileMgr, l.currentBlock)
+	return newForwardIterator(l.segments, l.currentBlock, bytes.Clone(l.logPage.Buffer), l.firstBlock, logSeqNum, l.lastSavedLogSeqNum.Load())
 }
@@ -1,57 +1,160 @@
 package wal
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/naveen246/kite-db/common"
 	"github.com/naveen246/kite-db/file"
-	log2 "log"
+	"io"
+	"slices"
 )
 
 // LogIterator provides the ability to move from latest to oldest log record
 // This becomes easy since data is appended in reverse order in each block of the LogFile
+// The iterator moves across segments, and stops at the first block of the oldest segment.
+// The fragments of a record are reassembled, so Next always returns whole records.
 type LogIterator struct {
 	fileMgr    *file.FileMgr
-	block      file.Block
+	segments   segments
+	blockNum   int64
+	firstBlock int64
 	page       *file.Page
 	currentPos int64
+
+	// the record returned by the next call to Next and its LSN, read ahead by HasNext
+	next    []byte
+	nextLSN int64
+	nextErr error
+	fetched bool
+	done    bool
+
+	// lsn is the LSN of the record returned by the last call to Next
+	lsn int64
 }
 
-func NewIterator(fileMgr *file.FileMgr, block file.Block) *LogIterator {
-	page := file.NewPageWithSize(fileMgr.BlockSize)
+var _ common.Iterator = (*LogIterator)(nil)
+
+// newIterator returns an iterator positioned at the latest record with an LSN <= logSeqNum.
+// lastBlock and firstBlock are the numbers of the last and first blocks of the log.
+func newIterator(segments segments, lastBlock int64, firstBlock int64, logSeqNum int64) (*LogIterator, error) {
+	blockSize := segments.fileMgr.BlockSize
+	page := file.NewPageWithSize(blockSize)
 	iter := &LogIterator{
-		fileMgr: fileMgr,
-		block:   block,
-		page:    page,
+		fileMgr:    segments.fileMgr,
+		segments:   segments,
+		firstBlock: firstBlock,
+		page:       page,
+	}
+
+	blockNum := max(min(logSeqNum/blockSize, lastBlock), firstBlock)
+	err := iter.moveToBlock(blockNum)
+	if err != nil {
+		return nil, err
+	}
+
+	// skip the records of the block that are newer than logSeqNum, the newest records come first
+	targetPos := blockSize - (logSeqNum - blockNum*blockSize)
+	for iter.currentPos < targetPos && iter.currentPos < blockSize {
+		_, _, _, err = iter.nextFragment()
+		if err != nil {
+			return nil, err
+		}
 	}
-	iter.moveToBlock(block)
-	return iter
+	return iter, nil
 }
 
+// HasNext reports whether there is another record. Since the fragments of an incomplete record are skipped,
+// HasNext reads ahead to the next complete record, a read error is returned by the next call to Next.
 func (l *LogIterator) HasNext() bool {
-	return l.currentPos < l.fileMgr.BlockSize || l.block.Number > 0
+	if !l.fetched {
+		l.next, l.nextLSN, l.done, l.nextErr = l.readRecord()
+		l.fetched = true
+	}
+	return !l.done || l.nextErr != nil
+}
+
+// Next returns the next record, io.EOF if there are no more records
+func (l *LogIterator) Next() ([]byte, error) {
+	if !l.HasNext() {
+		return nil, io.EOF
+	}
+	l.fetched = false
+	l.lsn = l.nextLSN
+	return l.next, l.nextErr
+}
+
+// LSN returns the LSN of the record returned by the last call to Next
+func (l *LogIterator) LSN() int64 {
+	return l.lsn
+}
+
+// readRecord reads the fragments of the next record, from its last fragment to its first, and joins them.
+// Fragments without a last fragment belong to a record that was not completely written, they are skipped.
+// Returns the record and its LSN (the LSN of its last fragment), or done if the start of the log is reached.
+func (l *LogIterator) readRecord() ([]byte, int64, bool, error) {
+	var fragments [][]byte
+	var recordLSN int64
+	for l.hasFragment() {
+		fragment, data, lsn, err := l.nextFragment()
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		switch fragment {
+		case fullFragment:
+			return data, lsn, false, nil
+		case lastFragment:
+			fragments = [][]byte{data}
+			recordLSN = lsn
+		case middleFragment:
+			if fragments != nil {
+				fragments = append(fragments, data)
+			}
+		case firstFragment:
+			if fragments != nil {
+				fragments = append(fragments, data)
+				slices.Reverse(fragments)
+				return bytes.Join(fragments, nil), recordLSN, false, nil
+			}
+		}
+	}
+	return nil, 0, true, nil
+}
+
+func (l *LogIterator) hasFragment() bool {
+	return l.currentPos < l.fileMgr.BlockSize || l.blockNum > l.firstBlock
 }
 
-// Next Moves to the next log record in the block.
-// If there are no more log records in the block,
-// then move to the previous block and return the latest log record from there.
-func (l *LogIterator) Next() []byte {
+// nextFragment Moves to the next fragment in the block, and returns its type, data and LSN.
+// If there are no more fragments in the block,
+// then move to the previous block and return the latest fragment from there.
+func (l *LogIterator) nextFragment() (int16, []byte, int64, error) {
 	if l.currentPos >= l.fileMgr.BlockSize {
-		l.block = file.GetBlock(l.block.Filename, l.block.Number-1)
-		l.moveToBlock(l.block)
+		err := l.moveToBlock(l.blockNum - 1)
+		if err != nil {
+			return 0, nil, 0, err
+		}
 	}
 
-	record, err := l.page.GetBytes(l.currentPos)
+	fragment, data, err := getRecord(l.page, l.currentPos)
 	if err != nil {
-		return nil
+		return 0, nil, 0, fmt.Errorf("could not read log record at %v in %v: %w", l.currentPos, l.segments.block(l.blockNum), err)
 	}
-	l.currentPos += int64(len(record)) + file.IntSize
-	return record
+	lsn := logSeqNum(l.fileMgr.BlockSize, l.blockNum, l.currentPos)
+	l.currentPos += recordSize(int64(len(data)))
+	// data is part of the page, which is overwritten when the iterator moves to another block
+	return fragment, bytes.Clone(data), lsn, nil
 }
 
-// moveToBlock Moves to the specified log block
+// moveToBlock Moves to block blockNum of the log
 // and positions it at the first record in that block
-func (l *LogIterator) moveToBlock(block file.Block) {
+func (l *LogIterator) moveToBlock(blockNum int64) error {
+	block := l.segments.block(blockNum)
 	err := l.fileMgr.Read(block, l.page)
 	if err != nil {
-		log2.Fatalln("Failed to moveToBlock", err)
+		return fmt.Errorf("could not read log block %v: %w", block, err)
 	}
-	l.currentPos, _ = l.page.GetInt(0)
+	l.blockNum = blockNum
+	l.currentPos, err = l.page.GetInt(0)
+	return err
 }
@@ -1,60 +1,84 @@
 package wal
 
 import (
+	"fmt"
 	"github.com/naveen246/kite-db/file"
 	"github.com/stretchr/testify/assert"
+	"io"
 	log2 "log"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
-const blockTestSize int64 = 28
+const blockTestSize int64 = 40
 
 var tempFileName = "temp.log"
-var initialText = "abcdefghijkl"
+var initialText = "abcdefghijklmnopqr"
 var dbDir = "temp_dir"
 
-// createFile creates file temp_dir/filename
+// createFile creates the first segment temp_dir/filename.0000 of the log filename
 // and adds 1 logRecord which fills the complete first block in the file
 func createFile(filename string) *file.FileMgr {
-	fileMgr := file.NewFileMgr(dbDir, blockTestSize)
-	_, err := os.Create(fileMgr.DbFilePath(filename))
+	fileMgr, err := file.NewFileMgr(dbDir, blockTestSize)
+	if err != nil {
+		log2.Fatal(err)
+	}
+	segmentFile := segments{logFile: filename}.filename(0)
+	_, err = os.Create(fileMgr.DbFilePath(segmentFile))
 	if err != nil {
 		log2.Fatal(err)
 	}
 
 	page := file.NewPageWithSize(blockTestSize)
 	page.SetInt(0, file.IntSize)
-	page.SetString(file.IntSize, initialText)
-	fileMgr.Write(file.GetBlock(tempFileName, 0), page)
+	setRecord(page, file.IntSize, fullFragment, []byte(initialText))
+	fileMgr.Write(file.GetBlock(segmentFile, 0), page)
 	return fileMgr
 }
 
+// removeFile removes filename, the segment files of the log filename and dbDir
 func removeFile(filename string, dbDir string) {
 	os.Remove(filename)
+	segmentFiles, _ := filepath.Glob(filename + ".*")
+	for _, segmentFile := range segmentFiles {
+		os.Remove(segmentFile)
+	}
+	os.Remove(filepath.Join(dbDir, file.LockFile))
 	os.Remove(dbDir)
 }
 
 func TestNewLog(t *testing.T) {
-	fileMgr := file.NewFileMgr(dbDir, blockTestSize)
-	log := NewLog(fileMgr, tempFileName)
-	assert.Equal(t, int64(0), log.currentBlock.Number)
+	fileMgr, err := file.NewFileMgr(dbDir, blockTestSize)
+	assert.NoError(t, err)
+	log, err := NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), log.currentBlock)
 	assert.Equal(t, blockTestSize, log.logPage.Size)
 	assert.Equal(t, tempFileName, log.LogFile)
+	fileMgr.Close()
 	removeFile(fileMgr.DbFilePath(tempFileName), fileMgr.DbDir)
 
 	fileMgr = createFile(tempFileName)
-	log = NewLog(fileMgr, tempFileName)
-	assert.Equal(t, int64(0), log.currentBlock.Number)
+	log, err = NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), log.currentBlock)
 	assert.Equal(t, blockTestSize, log.logPage.Size)
 	assert.Equal(t, tempFileName, log.LogFile)
+	fileMgr.Close()
 	removeFile(fileMgr.DbFilePath(tempFileName), fileMgr.DbDir)
 }
 
 func TestLogAppend(t *testing.T) {
 	fileMgr := createFile(tempFileName)
 	defer removeFile(fileMgr.DbFilePath(tempFileName), fileMgr.DbDir)
-	log := NewLog(fileMgr, tempFileName)
+	defer fileMgr.Close()
+	log, err := NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
 
 	text := []string{"abcde", "fgh", "i", "opq"}
 	tests := []struct {
@@ -64,20 +88,23 @@ func TestLogAppend(t *testing.T) {
 		lsn        int64
 	}{
 		// TODO: These values depend on block size. Remove hardcoded values and calculate values
-		{text: text[0], blockNum: 1, lastRecPos: 15, lsn: 1},
-		{text: text[1], blockNum: 2, lastRecPos: 17, lsn: 2},
-		{text: text[2], blockNum: 2, lastRecPos: 8, lsn: 3},
-		{text: text[3], blockNum: 3, lastRecPos: 17, lsn: 4},
+		// lsn = blockNum * blockTestSize + (blockTestSize - lastRecPos)
+		{text: text[0], blockNum: 1, lastRecPos: 21, lsn: 59},
+		{text: text[1], blockNum: 2, lastRecPos: 23, lsn: 97},
+		{text: text[2], blockNum: 2, lastRecPos: 8, lsn: 112},
+		{text: text[3], blockNum: 3, lastRecPos: 23, lsn: 137},
 	}
 
 	for _, tt := range tests {
-		log.Append([]byte(tt.text))
-		assert.Equal(t, tt.blockNum, log.currentBlock.Number)
+		lsn, err := log.Append([]byte(tt.text))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.lsn, lsn)
+		assert.Equal(t, tt.blockNum, log.currentBlock)
 		assert.Equal(t, blockTestSize, log.logPage.Size)
 		recordPos, _ := log.lastRecordPos()
 		assert.Equal(t, tt.lastRecPos, recordPos)
 
-		data, _ := log.logPage.GetBytes(recordPos)
+		_, data, _ := getRecord(log.logPage, recordPos)
 		assert.Equal(t, tt.text, string(data))
 		assert.Equal(t, tt.lsn, log.latestLogSeqNum.Load())
 	}
@@ -86,12 +113,18 @@ func TestLogAppend(t *testing.T) {
 func TestLogAppendNewBlock(t *testing.T) {
 	fileMgr := createFile(tempFileName)
 	defer removeFile(fileMgr.DbFilePath(tempFileName), fileMgr.DbDir)
-	log := NewLog(fileMgr, tempFileName)
+	defer fileMgr.Close()
+	log, err := NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
 
-	initialBlockCount := log.fileMgr.BlockCount(tempFileName)
-	log.appendNewBlock()
-	newBlockCount := log.fileMgr.BlockCount(tempFileName)
+	segmentFile := log.segments.filename(0)
+	initialBlockCount, err := log.fileMgr.BlockCount(segmentFile)
+	assert.NoError(t, err)
+	assert.NoError(t, log.appendNewBlock(log.currentBlock+1))
+	newBlockCount, err := log.fileMgr.BlockCount(segmentFile)
+	assert.NoError(t, err)
 	assert.Equal(t, initialBlockCount+1, newBlockCount)
+	assert.Equal(t, initialBlockCount, log.currentBlock)
 
 	recordPos, _ := log.lastRecordPos()
 	assert.Equal(t, blockTestSize, recordPos)
@@ -100,37 +133,572 @@ func TestLogAppendNewBlock(t *testing.T) {
 func TestLogFlush(t *testing.T) {
 	fileMgr := createFile(tempFileName)
 	defer removeFile(fileMgr.DbFilePath(tempFileName), fileMgr.DbDir)
-	log := NewLog(fileMgr, tempFileName)
+	defer fileMgr.Close()
+	log, err := NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
 
-	assert.Equal(t, int64(0), log.latestLogSeqNum.Load())
-	assert.Equal(t, int64(0), log.lastSavedLogSeqNum.Load())
+	// the record in block 0 written by createFile is at position 8, its lsn is 40 - 8
+	assert.Equal(t, int64(32), log.LatestLSN())
+	assert.Equal(t, int64(32), log.FlushedLSN())
 
-	log.Append([]byte("abcde"))
-	assert.Equal(t, int64(1), log.latestLogSeqNum.Load())
-	assert.Equal(t, int64(0), log.lastSavedLogSeqNum.Load())
+	lsn, err := log.Append([]byte("abcde"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(59), log.LatestLSN())
+	assert.Equal(t, int64(32), log.FlushedLSN())
 
-	log.Flush(1)
-	assert.Equal(t, int64(1), log.latestLogSeqNum.Load())
-	assert.Equal(t, int64(1), log.lastSavedLogSeqNum.Load())
+	assert.NoError(t, log.Flush(lsn))
+	assert.Equal(t, int64(59), log.LatestLSN())
+	assert.Equal(t, int64(59), log.FlushedLSN())
+}
+
+func TestLogReopen(t *testing.T) {
+	fileMgr := createFile(tempFileName)
+	defer removeFile(fileMgr.DbFilePath(tempFileName), fileMgr.DbDir)
+	defer fileMgr.Close()
+	log, err := NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+
+	var lastLSN int64
+	for _, text := range []string{"abcde", "fgh", "i"} {
+		lastLSN, err = log.Append([]byte(text))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, log.Flush(lastLSN))
+
+	// the LSNs continue from the last record in the file when the log is opened again
+	log, err = NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, lastLSN, log.LatestLSN())
+	assert.Equal(t, lastLSN, log.FlushedLSN())
+
+	lsn, err := log.Append([]byte("opq"))
+	assert.NoError(t, err)
+	assert.Greater(t, lsn, lastLSN)
 }
 
 func TestLogIterator(t *testing.T) {
 	fileMgr := createFile(tempFileName)
 	defer removeFile(fileMgr.DbFilePath(tempFileName), fileMgr.DbDir)
-	log := NewLog(fileMgr, tempFileName)
+	defer fileMgr.Close()
+	log, err := NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
 
 	text := []string{"abcde", "fgh", "ijklmn", "opq"}
 	for _, t := range text {
 		log.Append([]byte(t))
 	}
 
-	iter := log.Iterator()
+	iter, err := log.Iterator()
+	assert.NoError(t, err)
 	for i := 3; i >= 0; i-- {
 		assert.True(t, iter.HasNext())
-		assert.Equal(t, text[i], string(iter.Next()))
+		record, err := iter.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, text[i], string(record))
 	}
 
 	assert.True(t, iter.HasNext())
-	assert.Equal(t, initialText, string(iter.Next()))
+	record, err := iter.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, initialText, string(record))
+	assert.False(t, iter.HasNext())
+}
+
+func TestLogLargeRecord(t *testing.T) {
+	fileMgr := createFile(tempFileName)
+	defer removeFile(fileMgr.DbFilePath(tempFileName), fileMgr.DbDir)
+	defer fileMgr.Close()
+	log, err := NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+
+	// a record fits in a block if there is room for the lastRecordPos header and the record header
+	maxRecordSize := blockTestSize - file.IntSize - recordHeaderSize
+	fullBlock := strings.Repeat("x", int(maxRecordSize))
+	lsn, err := log.Append([]byte(fullBlock))
+	assert.NoError(t, err)
+	assert.Equal(t, 2*blockTestSize-file.IntSize, lsn)
+	_, err = log.Append([]byte("ab"))
+	assert.NoError(t, err)
+
+	// "ab" leaves room for 2 bytes in block 2, the rest of the record is split over blocks 3, 4 and 5
+	large := strings.Repeat("0123456789", 5)
+	lsn, err = log.Append([]byte(large))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), log.currentBlock)
+	assert.Equal(t, 5*blockTestSize+recordSize(12), lsn)
+
+	assertRecords := func(log *Log, expected ...string) {
+		iter, err := log.Iterator()
+		assert.NoError(t, err)
+		for _, text := range expected {
+			assert.True(t, iter.HasNext())
+			record, err := iter.Next()
+			assert.NoError(t, err)
+			assert.Equal(t, text, string(record))
+		}
+		assert.False(t, iter.HasNext())
+		_, err = iter.Next()
+		assert.ErrorIs(t, err, io.EOF)
+	}
+	assertRecords(log, large, "ab", fullBlock, initialText)
+
+	log, err = NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, lsn, log.LatestLSN())
+	assertRecords(log, large, "ab", fullBlock, initialText)
+
+	// the last fragment of a record is lost, the fragments before it are skipped by the iterator
+	_, err = log.Append([]byte(large))
+	assert.NoError(t, err)
+	assert.NoError(t, log.Flush(log.LatestLSN()))
+	assert.NoError(t, fileMgr.Truncate(log.segments.filename(0), log.currentBlock))
+	log, err = NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+	assertRecords(log, large, "ab", fullBlock, initialText)
+
+	_, err = log.Append([]byte("cd"))
+	assert.NoError(t, err)
+	assertRecords(log, "cd", large, "ab", fullBlock, initialText)
+}
+
+func TestLogIteratorFromLSN(t *testing.T) {
+	fileMgr, err := file.NewFileMgr(file.MemoryDir, blockTestSize)
+	assert.NoError(t, err)
+	defer fileMgr.Close()
+	log, err := NewLog(fileMgr, tempFileName, WithSegmentSize(2))
+	assert.NoError(t, err)
+
+	// the third record is split into fragments over 4 blocks and 2 segments
+	text := []string{"a", "bb", strings.Repeat("0123456789", 5), "ccc", "d"}
+	lsns := make([]int64, len(text))
+	for i, record := range text {
+		lsns[i], err = log.Append([]byte(record))
+		assert.NoError(t, err)
+	}
+
+	type iterator interface {
+		HasNext() bool
+		Next() ([]byte, error)
+		LSN() int64
+	}
+	assertRecords := func(iter iterator, indexes ...int) {
+		for _, i := range indexes {
+			assert.True(t, iter.HasNext())
+			record, err := iter.Next()
+			assert.NoError(t, err)
+			assert.Equal(t, text[i], string(record))
+			assert.Equal(t, lsns[i], iter.LSN())
+		}
+		assert.False(t, iter.HasNext())
+	}
+
+	forward := func(lsn int64, indexes ...int) {
+		iter, err := log.ForwardIterator(lsn)
+		assert.NoError(t, err)
+		assertRecords(iter, indexes...)
+	}
+	forward(0, 0, 1, 2, 3, 4)
+	forward(lsns[2], 2, 3, 4)
+	forward(lsns[1]+1, 2, 3, 4)
+	forward(lsns[4], 4)
+	forward(lsns[4] + 1)
+
+	reverse := func(lsn int64, indexes ...int) {
+		iter, err := log.ReverseIterator(lsn)
+		assert.NoError(t, err)
+		assertRecords(iter, indexes...)
+	}
+	reverse(math.MaxInt64, 4, 3, 2, 1, 0)
+	reverse(lsns[2], 2, 1, 0)
+	reverse(lsns[3]-1, 2, 1, 0)
+	reverse(lsns[0], 0)
+	reverse(lsns[0] - 1)
+
+	// the iterators start at the oldest segment that was not removed
+	_, err = log.RemoveSegmentsBefore(lsns[3])
+	assert.NoError(t, err)
+	forward(0, 3, 4)
+	reverse(lsns[4], 4, 3)
+
+	// records appended after the forward iterator is created are not returned
+	iter, err := log.ForwardIterator(lsns[3])
+	assert.NoError(t, err)
+	_, err = log.Append([]byte("e"))
+	assert.NoError(t, err)
+	assertRecords(iter, 3, 4)
+}
+
+func TestTornTail(t *testing.T) {
+	fileMgr := createFile(tempFileName)
+	defer removeFile(fileMgr.DbFilePath(tempFileName), fileMgr.DbDir)
+	defer fileMgr.Close()
+	log, err := NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+
+	// block 1 holds "ab" at position 24 and "cd" at position 8
+	lsn, _ := log.Append([]byte("ab"))
+	log.Append([]byte("cd"))
+	assert.NoError(t, log.Flush(log.LatestLSN()))
+
+	// overwrite the data of "cd" as if the process died while the block was written
+	f, err := os.OpenFile(fileMgr.DbFilePath(log.segments.filename(0)), os.O_RDWR, 0666)
+	assert.NoError(t, err)
+	f.WriteAt([]byte("xy"), 1*fileMgr.FrameSize()+8+recordHeaderSize)
+	f.Close()
+
+	log, err = NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(16), log.DiscardedBytes())
+	assert.Equal(t, lsn, log.LatestLSN())
+
+	iter, err := log.Iterator()
+	assert.NoError(t, err)
+	for _, expected := range []string{"ab", initialText} {
+		record, err := iter.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(record))
+	}
+	assert.False(t, iter.HasNext())
+
+	// the repaired block is written back, so nothing is discarded the next time the log is opened
+	log, err = NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), log.DiscardedBytes())
+	assert.Equal(t, lsn, log.LatestLSN())
+}
+
+// TestFlushedIteratorTornRead checks that the last block is not read from disk,
+// where a flush may be rewriting it while the iterator reads it
+func TestFlushedIteratorTornRead(t *testing.T) {
+	fileMgr := createFile(tempFileName)
+	defer removeFile(fileMgr.DbFilePath(tempFileName), fileMgr.DbDir)
+	defer fileMgr.Close()
+	log, err := NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+
+	// block 1 holds "ab" at position 24 and "cd" at position 8,
+	// the iterators start at block 0 and read block 1 after they are created
+	lsn, _ := log.Append([]byte("ab"))
+	assert.NoError(t, log.Flush(lsn))
+	iter, err := log.FlushedIterator(0)
+	assert.NoError(t, err)
+	log.Append([]byte("cd"))
+	forwardIter, err := log.ForwardIterator(0)
+	assert.NoError(t, err)
+
+	// overwrite the data of "cd" as if the block was being written
+	f, err := os.OpenFile(fileMgr.DbFilePath(log.segments.filename(0)), os.O_RDWR, 0666)
+	assert.NoError(t, err)
+	f.WriteAt([]byte("xy"), 1*fileMgr.FrameSize()+8+recordHeaderSize)
+	f.Close()
+
+	for _, expected := range []string{initialText, "ab"} {
+		record, err := iter.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(record))
+	}
 	assert.False(t, iter.HasNext())
+	for _, expected := range []string{initialText, "ab", "cd"} {
+		record, err := forwardIter.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(record))
+	}
+	assert.False(t, forwardIter.HasNext())
+}
+
+func TestRecoverTail(t *testing.T) {
+	// a block with "ab" at position 24 and "cd" at position 8
+	newPage := func() *file.Page {
+		page := file.NewPageWithSize(blockTestSize)
+		page.SetInt(0, 8)
+		setRecord(page, 24, fullFragment, []byte("ab"))
+		setRecord(page, 8, fullFragment, []byte("cd"))
+		return page
+	}
+
+	tests := []struct {
+		name      string
+		corrupt   func(page *file.Page)
+		pos       int64
+		discarded int64
+	}{
+		{"valid", func(page *file.Page) {}, 8, 0},
+		{"torn newest record", func(page *file.Page) { page.Buffer[23] ^= 1 }, 24, 16},
+		{"torn oldest record", func(page *file.Page) { page.Buffer[39] ^= 1 }, 40, 32},
+		{"invalid length", func(page *file.Page) { page.SetInt(14, -5) }, 24, 16},
+		{"invalid fragment type", func(page *file.Page) { page.SetInt16(12, 9) }, 24, 16},
+		{"garbage lastRecordPos", func(page *file.Page) { page.SetInt(0, 1000) }, 8, 0},
+		{"empty block", func(page *file.Page) { page.SetInt(0, blockTestSize) }, 40, 0},
+		{"unwritten block", func(page *file.Page) { clear(page.Buffer) }, 40, 0},
+	}
+
+	for _, tt := range tests {
+		page := newPage()
+		tt.corrupt(page)
+		pos, discarded := recoverTail(page)
+		assert.Equal(t, tt.pos, pos, tt.name)
+		assert.Equal(t, tt.discarded, discarded, tt.name)
+	}
+}
+
+func TestLogSegments(t *testing.T) {
+	fileMgr, err := file.NewFileMgr(file.MemoryDir, blockTestSize)
+	assert.NoError(t, err)
+	defer fileMgr.Close()
+
+	_, err = NewLog(fileMgr, tempFileName, WithSegmentSize(0))
+	assert.Error(t, err)
+
+	// each record fills a block, so record i is in block i, and segment i holds blocks 2i and 2i+1
+	log, err := NewLog(fileMgr, tempFileName, WithSegmentSize(2))
+	assert.NoError(t, err)
+	text := []string{"aaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbb", "cccccccccccccccccc", "dddddddddddddddddd", "eeeeeeeeeeeeeeeeee"}
+	lsns := make([]int64, len(text))
+	for i, t := range text {
+		lsns[i], _ = log.Append([]byte(t))
+	}
+	assert.Equal(t, int64(4), log.currentBlock)
+	assert.Equal(t, lsns[4], log.logSeqNum(4, file.IntSize))
+
+	segmentFiles, err := log.Segments()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"temp.log.0000", "temp.log.0001", "temp.log.0002"}, segmentFiles)
+	assertRecords := func(log *Log, expected []string) {
+		iter, err := log.Iterator()
+		assert.NoError(t, err)
+		for i := len(expected) - 1; i >= 0; i-- {
+			assert.True(t, iter.HasNext())
+			record, err := iter.Next()
+			assert.NoError(t, err)
+			assert.Equal(t, expected[i], string(record))
+		}
+		assert.False(t, iter.HasNext())
+	}
+	assertRecords(log, text)
+
+	// the LSNs continue across segments when the log is opened again
+	log, err = NewLog(fileMgr, tempFileName, WithSegmentSize(2))
+	assert.NoError(t, err)
+	assert.Equal(t, lsns[4], log.LatestLSN())
+	assertRecords(log, text)
+	assert.Equal(t, int64(0), log.FirstLSN())
+
+	// record 3 is in segment 1, so only segment 0 is removed
+	removed, err := log.RemoveSegmentsBefore(lsns[3])
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	segmentFiles, _ = log.Segments()
+	assert.Equal(t, []string{"temp.log.0001", "temp.log.0002"}, segmentFiles)
+	assertRecords(log, text[2:])
+	assert.Greater(t, log.FirstLSN(), lsns[1])
+	assert.LessOrEqual(t, log.FirstLSN(), lsns[2])
+
+	log, err = NewLog(fileMgr, tempFileName, WithSegmentSize(2))
+	assert.NoError(t, err)
+	assertRecords(log, text[2:])
+	assert.Equal(t, 2*blockTestSize, log.FirstLSN())
+	removed, err = log.RemoveSegmentsBefore(log.LatestLSN())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assertRecords(log, text[4:])
+	assert.Equal(t, 4*blockTestSize, log.FirstLSN())
+}
+
+func TestGroupCommit(t *testing.T) {
+	fileMgr, err := file.NewFileMgr(file.MemoryDir, 400)
+	assert.NoError(t, err)
+	defer fileMgr.Close()
+
+	// the leader waits until all the committers are waiting, so they share a single flush
+	committers := 8
+	log, err := NewLog(fileMgr, tempFileName, WithGroupCommit(10*time.Second, committers))
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < committers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lsn, err := log.Append([]byte(fmt.Sprintf("commit %v", i)))
+			assert.NoError(t, err)
+			assert.NoError(t, log.Flush(lsn))
+			assert.GreaterOrEqual(t, log.FlushedLSN(), lsn)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, log.LatestLSN(), log.FlushedLSN())
+	stats := log.GroupCommitStats()
+	assert.Equal(t, int64(1), stats.Flushes)
+	assert.Equal(t, int64(committers), stats.Commits)
+	assert.Equal(t, int64(committers), stats.MaxBatch)
+	assert.Equal(t, float64(committers), stats.CommitsPerFlush())
+
+	// a flushed LSN does not need another flush
+	assert.NoError(t, log.Flush(log.LatestLSN()))
+	assert.Equal(t, int64(1), log.GroupCommitStats().Flushes)
+
+	// without a delay every flush is done right away
+	log, err = NewLog(fileMgr, tempFileName)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		lsn, err := log.Append([]byte("abc"))
+		assert.NoError(t, err)
+		assert.NoError(t, log.Flush(lsn))
+	}
+	stats = log.GroupCommitStats()
+	assert.Equal(t, int64(3), stats.Flushes)
+	assert.Equal(t, int64(3), stats.Commits)
+	assert.Equal(t, int64(1), stats.MaxBatch)
+
+	// every caller is a full batch, the consecutive batches do not wait for the delay
+	log, err = NewLog(fileMgr, tempFileName, WithGroupCommit(10*time.Second, 1))
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		lsn, err := log.Append([]byte("abc"))
+		assert.NoError(t, err)
+		assert.NoError(t, log.Flush(lsn))
+	}
+	for round := 0; round < 3; round++ {
+		for i := 0; i < committers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				lsn, err := log.Append([]byte("abc"))
+				assert.NoError(t, err)
+				assert.NoError(t, log.Flush(lsn))
+			}()
+		}
+		wg.Wait()
+	}
+	assert.Equal(t, log.LatestLSN(), log.FlushedLSN())
+	stats = log.GroupCommitStats()
+	assert.Equal(t, int64(3+3*committers), stats.Commits)
+}
+
+func TestAsyncCommit(t *testing.T) {
+	fileMgr, err := file.NewFileMgr(file.MemoryDir, 400)
+	assert.NoError(t, err)
+	defer fileMgr.Close()
+
+	_, err = NewLog(fileMgr, tempFileName, WithAsyncCommit(0))
+	assert.Error(t, err)
+
+	log, err := NewLog(fileMgr, tempFileName, WithAsyncCommit(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, log.AsyncCommit())
+	lsn, err := log.Append([]byte("abc"))
+	assert.NoError(t, err)
+	assert.Less(t, log.FlushedLSN(), lsn)
+
+	// WaitDurable waits for the flusher, which does not flush before the interval
+	done := make(chan error)
+	go func() { done <- log.WaitDurable(lsn) }()
+	select {
+	case <-done:
+		assert.Fail(t, "WaitDurable returned before the log was flushed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// FlushedIterator does not flush the log, it only returns the records written to disk
+	iter, err := log.FlushedIterator(0)
+	assert.NoError(t, err)
+	assert.False(t, iter.HasNext())
+	assert.Less(t, log.FlushedLSN(), lsn)
+
+	// a flush done by someone else also wakes up WaitDurable
+	assert.NoError(t, log.Flush(lsn))
+	assert.NoError(t, <-done)
+	iter, err = log.FlushedIterator(0)
+	assert.NoError(t, err)
+	assert.True(t, iter.HasNext())
+	record, err := iter.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(record))
+	assert.Equal(t, lsn, iter.LSN())
+	assert.False(t, iter.HasNext())
+	assert.NoError(t, log.Close())
+
+	log, err = NewLog(fileMgr, tempFileName, WithAsyncCommit(5*time.Millisecond))
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		lsn, err = log.Append([]byte(fmt.Sprintf("commit %v", i)))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, log.WaitDurable(lsn))
+	assert.GreaterOrEqual(t, log.FlushedLSN(), lsn)
+
+	// Close flushes the log, no records can be appended after it
+	lsn, err = log.Append([]byte("def"))
+	assert.NoError(t, err)
+	assert.NoError(t, log.Close())
+	assert.Equal(t, lsn, log.FlushedLSN())
+	assert.NoError(t, log.WaitDurable(lsn))
+	_, err = log.Append([]byte("ghi"))
+	assert.ErrorIs(t, err, ErrLogClosed)
+	assert.NoError(t, log.Close())
+}
+
+func TestLogArchive(t *testing.T) {
+	fileMgr, err := file.NewFileMgr(file.MemoryDir, blockTestSize)
+	assert.NoError(t, err)
+	defer fileMgr.Close()
+	archive, err := file.NewFileMgr(file.MemoryDir, blockTestSize)
+	assert.NoError(t, err)
+	defer archive.Close()
+
+	other, err := file.NewFileMgr(file.MemoryDir, 2*blockTestSize)
+	assert.NoError(t, err)
+	defer other.Close()
+	_, err = NewLog(fileMgr, tempFileName, WithArchive(other))
+	assert.Error(t, err)
+
+	// each record fills a block, segment i holds records 2i and 2i+1
+	log, err := NewLog(fileMgr, tempFileName, WithSegmentSize(2), WithArchive(archive))
+	assert.NoError(t, err)
+	text := []string{"aaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbb", "cccccccccccccccccc", "dddddddddddddddddd", "eeeeeeeeeeeeeeeeee"}
+	for _, s := range text[:3] {
+		_, err = log.Append([]byte(s))
+		assert.NoError(t, err)
+	}
+	archived, err := archive.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"temp.log.0000"}, archived)
+	for _, s := range text[3:] {
+		_, err = log.Append([]byte(s))
+		assert.NoError(t, err)
+	}
+	archived, _ = archive.List()
+	assert.Equal(t, []string{"temp.log.0000", "temp.log.0001"}, archived)
+
+	// the archive can be read as a log, it holds the records of the completed segments
+	archiveLog, err := NewLog(archive, tempFileName, WithSegmentSize(2))
+	assert.NoError(t, err)
+	iter, err := archiveLog.ForwardIterator(0)
+	assert.NoError(t, err)
+	for _, s := range text[:4] {
+		assert.True(t, iter.HasNext())
+		record, err := iter.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, s, string(record))
+	}
+	assert.False(t, iter.HasNext())
+
+	// a segment missing from the archive, or whose copy was interrupted, is archived when the log is opened
+	assert.NoError(t, archive.Delete("temp.log.0000"))
+	assert.NoError(t, archive.Truncate("temp.log.0001", 1))
+	log, err = NewLog(fileMgr, tempFileName, WithSegmentSize(2), WithArchive(archive))
+	assert.NoError(t, err)
+	archived, _ = archive.List()
+	assert.Equal(t, []string{"temp.log.0000", "temp.log.0001"}, archived)
+	count, _ := archive.BlockCount("temp.log.0001")
+	assert.Equal(t, int64(2), count)
+
+	// and before it is removed
+	assert.NoError(t, archive.Delete("temp.log.0001"))
+	removed, err := log.RemoveSegmentsBefore(log.LatestLSN())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	archived, _ = archive.List()
+	assert.Equal(t, []string{"temp.log.0000", "temp.log.0001"}, archived)
 }